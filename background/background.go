@@ -0,0 +1,80 @@
+// Package background runs the program detached from the terminal for -B:
+// the command is started again as a separate process that survives the
+// shell exiting, with its output going to a log file.
+package background
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// childEnv marks the detached copy of the program in its environment.
+const childEnv = "WGET_BACKGROUND_CHILD"
+
+// IsChild reports whether this process is the detached copy started by Start.
+func IsChild() bool {
+	return os.Getenv(childEnv) == "1"
+}
+
+// LogName returns base if no such file exists yet, otherwise the first of
+// base.1, base.2, ... that doesn't, so earlier logs are kept.
+func LogName(base string) string {
+	name := base
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+}
+
+// Start runs the program again with the same arguments, detached from the
+// terminal, with its output going to a new log file named after logBase.
+// The PID of the new process is written to pidFile unless it is empty. It
+// returns the PID and the name of the log file.
+func Start(logBase, pidFile string) (int, string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to locate executable: %v", err)
+	}
+
+	logName := LogName(logBase)
+	logFile, err := os.OpenFile(logName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create log file: %v", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedAttr()
+	if err := cmd.Start(); err != nil {
+		return 0, "", fmt.Errorf("failed to start background process: %v", err)
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	if pidFile != "" {
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+			return pid, logName, fmt.Errorf("failed to write PID file: %v", err)
+		}
+	}
+	return pid, logName, nil
+}
+
+// RemovePIDFile deletes pidFile if it holds the PID of this process, leaving
+// a file that was since reused by another run alone.
+func RemovePIDFile(pidFile string) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(string(data)) == strconv.Itoa(os.Getpid()) {
+		os.Remove(pidFile)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package background
+
+import "syscall"
+
+// detachedAttr has nothing to set on this platform; the process still runs
+// on after the command returns.
+func detachedAttr() *syscall.SysProcAttr {
+	return nil
+}
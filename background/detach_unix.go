@@ -0,0 +1,11 @@
+//go:build unix
+
+package background
+
+import "syscall"
+
+// detachedAttr starts the process in a new session, without a controlling
+// terminal, so closing the terminal doesn't send it SIGHUP.
+func detachedAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
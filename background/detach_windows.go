@@ -0,0 +1,17 @@
+//go:build windows
+
+package background
+
+import "syscall"
+
+// detachedProcess is the DETACHED_PROCESS process creation flag.
+const detachedProcess = 0x00000008
+
+// detachedAttr starts the process without a console and in its own process
+// group, so closing the console window or pressing Ctrl-C doesn't stop it.
+func detachedAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Section holds the settings of a [host PATTERN] or [url PATTERN] section of
+// the config file, applied to the requests of matching URLs in every mode.
+type Section struct {
+	Host string // Host pattern, e.g. *.internal.corp
+	URL  string // URL prefix, * matching any characters, e.g. https://example.com/api/
+
+	Headers   []string // Extra request headers in "Name: value" form
+	User      string   // Basic authentication user
+	Password  string   // Basic authentication password
+	RateLimit string   // Maximum download speed (e.g., 200k, 2M)
+	MaxRPS    float64  // Requests sent per second to the matching URLs
+
+	// TLS options, only allowed in host sections as connections are per host.
+	NoCheckCertificate bool
+	CACertificate      string
+	Certificate        string
+	PrivateKey         string
+	SecureProtocol     string
+}
+
+// HasTLS reports whether the section changes the TLS options.
+func (s Section) HasTLS() bool {
+	return s.NoCheckCertificate || s.CACertificate != "" || s.Certificate != "" || s.PrivateKey != "" || s.SecureProtocol != ""
+}
+
+// DefaultConfigPath returns the location of the config file read without
+// --config, in the user's configuration directory.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting config directory: %v", err)
+	}
+	return filepath.Join(dir, "wget", "config"), nil
+}
+
+// loadConfigFile reads a config file. The settings before the first section
+// are long flag names and values ("rate-limit = 200k"), set on fs unless the
+// command line gave them; the sections are returned. A missing file is only
+// an error when required is set.
+func loadConfigFile(name string, required bool, fs *flag.FlagSet) ([]Section, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	defer file.Close()
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var sections []Section
+	var current *Section
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			section, err := parseSectionHeader(text)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+			}
+			sections = append(sections, section)
+			current = &sections[len(sections)-1]
+			continue
+		}
+
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected name = value", name, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if current == nil {
+			if fs.Lookup(key) == nil {
+				return nil, fmt.Errorf("%s:%d: unknown setting %q", name, line, key)
+			}
+			if given[key] {
+				continue
+			}
+			if err := fs.Set(key, value); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid %s: %v", name, line, key, err)
+			}
+			continue
+		}
+		if err := current.set(key, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	for _, s := range sections {
+		if s.URL != "" && s.HasTLS() {
+			return nil, fmt.Errorf("%s: TLS settings are only allowed in host sections, not in [url %s]", name, s.URL)
+		}
+	}
+	return sections, nil
+}
+
+// parseSectionHeader parses "[host PATTERN]" or "[url PATTERN]".
+func parseSectionHeader(text string) (Section, error) {
+	if !strings.HasSuffix(text, "]") {
+		return Section{}, fmt.Errorf("unterminated section %s", text)
+	}
+	kind, pattern, _ := strings.Cut(strings.TrimSpace(text[1:len(text)-1]), " ")
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return Section{}, fmt.Errorf("section %s has no pattern", text)
+	}
+	switch strings.ToLower(kind) {
+	case "host":
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Section{}, fmt.Errorf("invalid host pattern %q", pattern)
+		}
+		return Section{Host: strings.ToLower(pattern)}, nil
+	case "url":
+		return Section{URL: pattern}, nil
+	}
+	return Section{}, fmt.Errorf("unknown section kind %q, expected host or url", kind)
+}
+
+// set applies a setting of a section. The names are those of the matching
+// flags.
+func (s *Section) set(name, value string) error {
+	var err error
+	switch name {
+	case "header":
+		s.Headers = append(s.Headers, value)
+	case "user":
+		s.User = value
+	case "password":
+		s.Password = value
+	case "rate-limit":
+		s.RateLimit = value
+	case "max-rps":
+		if s.MaxRPS, err = strconv.ParseFloat(value, 64); err != nil || s.MaxRPS < 0 {
+			return fmt.Errorf("invalid max-rps %q", value)
+		}
+	case "no-check-certificate":
+		if s.NoCheckCertificate, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid no-check-certificate %q", value)
+		}
+	case "ca-certificate":
+		s.CACertificate = value
+	case "certificate":
+		s.Certificate = value
+	case "private-key":
+		s.PrivateKey = value
+	case "secure-protocol":
+		s.SecureProtocol = value
+	default:
+		return fmt.Errorf("unknown section setting %q", name)
+	}
+	return nil
+}
@@ -15,14 +15,163 @@ type Flags struct {
 	RateLimit    string
 	Background   bool
 	InputFile    string
+	InputSitemap string
 	Mirror       bool
 	Reject       string
 	Exclude      string
 	RejectTypes []string
 	ExcludePaths []string
+	AcceptTypes  []string
+	AcceptRegex  string
+	RejectRegex  string
+	NoParent     bool
 	ConvertLinks bool
+	AdjustExt    bool
+	BackupOrig   bool
 	UseDynamic   bool
+	Listing      bool
+	Method       string
+	PostData     string
+	BodyFile     string
+	Headers      []string
 	URLs         []string // Added to store URLs from the input file
+
+	ContentDisposition bool
+
+	ExtractLinksOnly bool
+	LinkRegex        string
+	LinkExts         []string
+	LinksOutput      string
+
+	NewerThan    string
+	Timestamping bool
+
+	AtomicPublish bool
+	KeepSnapshots int
+
+	NoClobber bool
+	Collision string
+	Checksum  string
+	Conflict  string
+	Quota     string
+	Spider    bool
+
+	Level          string
+	DepthRules     string
+	PageRequisites bool
+	SingleFile     bool
+
+	Transforms    []string
+	TransformExec string
+	ConsentBypass bool
+
+	StripQueryParams []string
+	KeepQueryParams  []string
+	StripTracking    bool
+	NoRobots         bool
+	IgnoreNofollow   bool
+
+	SpanHosts      bool
+	Domains        []string
+	ExcludeDomains []string
+
+	ScanScripts       bool
+	RestrictFileNames string
+
+	Incremental       bool
+	ContinueMirror    bool
+	MaxFileSize       string
+	MaxTotalSize      string
+	Dedup             string
+	ArchiveOutput     string
+	ArchiveOnly       bool
+	DryRun            bool
+	NoHostDirectories bool
+	CutDirs           int
+	NoDirectories     bool
+
+	ServerResponse bool
+	InetFamily     string
+	PreferFamily   string
+
+	NoCheckCertificate bool
+	CACertificate      string
+	Certificate        string
+	PrivateKey         string
+	SecureProtocol     string
+	PinSHA256          []string
+	OCSPStaple         string
+
+	HTTP2 bool
+	HTTP3 bool
+
+	AuthNegotiate bool
+
+	Compression bool
+
+	MaxRedirect      int
+	TrustServerNames bool
+
+	MaxIdlePerHost  int
+	NoKeepAlive     bool
+	ConnectTimeout  float64
+	ResponseTimeout float64
+
+	Exec       string
+	IfModified bool
+
+	MonthlyQuota string
+	HistoryFile  string
+
+	MaxConcurrent      int
+	ConcurrentRequests int
+
+	RelayTo string
+
+	Progress string
+
+	Continue bool
+
+	Sparse bool
+
+	CacheDir string
+	Warm     bool
+
+	MaxRPS        float64
+	MaxRPSPerHost float64
+
+	AutoConcurrency      bool
+	MaxConcurrentPerHost int
+
+	Wait       float64
+	RandomWait bool
+
+	StateFile  string
+	URLDB      string
+	ReportFile string
+
+	SafeMode bool
+
+	PIDFile string
+
+	TUI bool
+
+	TempDir string
+
+	Fsync  bool
+	Direct bool
+
+	AltURLs []string
+
+	ConfigFile string
+
+	RecordDir string
+	ReplayDir string
+	Sections   []Section // [host] and [url] sections of the config file
+
+	WarcFile   string
+	NoWarcGzip bool
+	WarcOnly   bool
 }
 
 // InitFlags initializes and parses command-line flags.
@@ -31,24 +180,190 @@ func InitFlags() *Flags {
 	flags := &Flags{}
 
 	// Initialize flags with their default values and descriptions
-	fs.StringVar(&flags.OutputFile, "O", "", "Save the file with a different name")
+	fs.StringVar(&flags.OutputFile, "O", "", "Save the file with a different name (- for stdout)")
 	fs.StringVar(&flags.OutputDir, "P", ".", "Save the file in a specific directory")
-	fs.StringVar(&flags.RateLimit, "rate-limit", "", "Limit the download speed (e.g., 200k, 2M)")
+	fs.StringVar(&flags.RateLimit, "rate-limit", "", "Limit the download speed (e.g., 200k, 2M), of each file, or of the whole crawl when mirroring")
 	fs.BoolVar(&flags.Background, "B", false, "Download in the background")
 	fs.StringVar(&flags.InputFile, "i", "", "File containing multiple URLs to download")
+	fs.StringVar(&flags.InputSitemap, "input-sitemap", "", "Download every page listed in the sitemap at this URL, following sitemap indexes")
 	fs.BoolVar(&flags.Mirror, "mirror", false, "Mirror a website")
-	flag.BoolVar(&flags.Background, "background", false, "Run download in background mode without showing progress")
+	fs.BoolVar(&flags.Background, "background", false, "Run download in background mode without showing progress")
 	
 	var rejectListShort, rejectListLong string
 	fs.StringVar(&rejectListShort, "R", "", "Reject file types (comma-separated list)")
 	fs.StringVar(&rejectListLong, "reject", "", "Reject file types (comma-separated list)")
 
+	var acceptListShort, acceptListLong string
+	fs.StringVar(&acceptListShort, "A", "", "Only save these file types or names when mirroring (comma-separated list, e.g., pdf,*.tar.gz)")
+	fs.StringVar(&acceptListLong, "accept", "", "Only save these file types or names when mirroring (comma-separated list, e.g., pdf,*.tar.gz)")
+	fs.StringVar(&flags.AcceptRegex, "accept-regex", "", "Only save files whose URL path matches this regular expression when mirroring")
+	fs.StringVar(&flags.RejectRegex, "reject-regex", "", "Don't fetch URLs whose path matches this regular expression when mirroring")
+
 	var excludeListShort, excludeListLong string
 	fs.StringVar(&excludeListShort, "X", "", "Exclude directories (comma-separated list)")
 	fs.StringVar(&excludeListLong, "exclude", "", "Exclude directories (comma-separated list)")
 
-	fs.BoolVar(&flags.ConvertLinks, "convert-links", false, "Convert links for offline viewing")
-	fs.BoolVar(&flags.UseDynamic, "dynamic", true, "Enable javascript rendering")
+	fs.BoolVar(&flags.NoParent, "np", false, "Don't ascend to the parent directory of the start URL when mirroring")
+	fs.BoolVar(&flags.NoParent, "no-parent", false, "Don't ascend to the parent directory of the start URL when mirroring")
+
+	fs.BoolVar(&flags.ConvertLinks, "k", false, "Convert links for offline viewing once the mirror is done")
+	fs.BoolVar(&flags.ConvertLinks, "convert-links", false, "Convert links for offline viewing once the mirror is done")
+	fs.BoolVar(&flags.BackupOrig, "K", false, "Keep the original of each file whose links are converted as file.orig")
+	fs.BoolVar(&flags.BackupOrig, "backup-converted", false, "Keep the original of each file whose links are converted as file.orig")
+	fs.BoolVar(&flags.AdjustExt, "E", false, "Save HTML pages and stylesheets whose URLs lack a .html or .css extension with one when mirroring")
+	fs.BoolVar(&flags.AdjustExt, "adjust-extension", false, "Save HTML pages and stylesheets whose URLs lack a .html or .css extension with one when mirroring")
+	fs.BoolVar(&flags.Incremental, "incremental", false, "Remember the ETag and Last-Modified of mirrored files and only fetch them again if they changed")
+	fs.BoolVar(&flags.ContinueMirror, "continue-mirror", false, "Resume an interrupted mirror from the frontier it saved in the output directory")
+	fs.StringVar(&flags.MaxFileSize, "max-file-size", "", "Skip files larger than this when mirroring (e.g., 50m)")
+	fs.StringVar(&flags.MaxTotalSize, "max-total-size", "", "Stop mirroring once the files saved add up to this (e.g., 2g), keeping the frontier for --continue-mirror")
+	fs.StringVar(&flags.Dedup, "dedup", "", "Replace mirrored files identical to one saved before by links to it: hardlink or symlink")
+	fs.StringVar(&flags.ArchiveOutput, "archive-output", "", "Also write the mirrored tree to this .zip, .tar.gz or .tgz archive once the crawl ends")
+	fs.BoolVar(&flags.ArchiveOnly, "archive-only", false, "Keep the mirrored files in the --archive-output archive only")
+	fs.BoolVar(&flags.DryRun, "dry-run", false, "Crawl without saving anything, printing the files the mirror would save, where, and the URLs it would skip and why")
+	fs.BoolVar(&flags.NoHostDirectories, "nH", false, "Don't create a directory named after the host when mirroring")
+	fs.BoolVar(&flags.NoHostDirectories, "no-host-directories", false, "Don't create a directory named after the host when mirroring")
+	fs.IntVar(&flags.CutDirs, "cut-dirs", 0, "Leave out this many leading directories of URL paths when mirroring (e.g., 2 saves /a/b/c/f.html as c/f.html)")
+	fs.BoolVar(&flags.NoDirectories, "nd", false, "Save all mirrored files in the output directory itself, without creating directories")
+	fs.BoolVar(&flags.NoDirectories, "no-directories", false, "Save all mirrored files in the output directory itself, without creating directories")
+	fs.StringVar(&flags.RestrictFileNames, "restrict-file-names", "", "Restrict the names of mirrored files: unix, windows, ascii, lowercase or uppercase (comma-separated)")
+	fs.BoolVar(&flags.UseDynamic, "dynamic", false, "Render HTML pages in headless Chrome, running their JavaScript, before extracting links when mirroring (needs Chrome or Chromium)")
+	fs.BoolVar(&flags.Listing, "listing", false, "Recursively download the files of a directory listing")
+	fs.StringVar(&flags.Method, "method", "", "HTTP method to use (e.g., POST, PUT)")
+	fs.StringVar(&flags.PostData, "post-data", "", "Send the given string as the request body")
+	fs.StringVar(&flags.BodyFile, "body-file", "", "Send the contents of a file as the request body")
+	fs.BoolVar(&flags.ContentDisposition, "content-disposition", false, "Use the file name suggested by the Content-Disposition header")
+	fs.Var((*stringList)(&flags.Headers), "header", "Add a request header (e.g., 'Content-Type: application/json'), can be repeated")
+
+	fs.BoolVar(&flags.ExtractLinksOnly, "extract-links-only", false, "Crawl like --mirror but only print the discovered URLs")
+	fs.StringVar(&flags.LinkRegex, "link-regex", "", "Only print discovered URLs matching this regular expression")
+	var stripQueryParams, keepQueryParams string
+	fs.StringVar(&stripQueryParams, "strip-query-params", "", "Drop these query parameters from mirrored URLs (comma-separated, e.g., utm_*,fbclid)")
+	fs.StringVar(&keepQueryParams, "keep-query-params", "", "Only keep these query parameters in mirrored URLs (comma-separated, e.g., page,id)")
+	fs.BoolVar(&flags.StripTracking, "strip-tracking", false, "Drop tracking query parameters (utm_*, fbclid, gclid, ...) from downloaded and mirrored URLs")
+
+	fs.BoolVar(&flags.NoRobots, "no-robots", false, "Ignore the Disallow rules and Crawl-delay of robots.txt, and nofollow, when mirroring")
+	fs.BoolVar(&flags.IgnoreNofollow, "ignore-nofollow", false, "Follow links marked rel=nofollow and those of pages whose meta robots tag says nofollow when mirroring")
+
+	fs.BoolVar(&flags.SpanHosts, "H", false, "Follow links to other hosts when mirroring")
+	fs.BoolVar(&flags.SpanHosts, "span-hosts", false, "Follow links to other hosts when mirroring")
+	var domains, excludeDomains string
+	fs.StringVar(&domains, "D", "", "Only follow links to these domains and their subdomains (comma-separated, e.g., cdn.example.com), implies -H")
+	fs.StringVar(&domains, "domains", "", "Only follow links to these domains and their subdomains (comma-separated, e.g., cdn.example.com), implies -H")
+	fs.StringVar(&excludeDomains, "exclude-domains", "", "Never follow links to these domains and their subdomains (comma-separated)")
+	fs.BoolVar(&flags.ScanScripts, "scan-scripts", false, "Also follow the asset URLs found in string literals of JavaScript and JSON responses when mirroring")
+
+	var linkExts string
+	fs.StringVar(&linkExts, "link-ext", "", "Only print discovered URLs with these extensions (comma-separated list)")
+	fs.StringVar(&flags.LinksOutput, "links-output", "", "Write discovered URLs to a file instead of stdout")
+
+	fs.BoolVar(&flags.Timestamping, "N", false, "Don't re-download files unless newer than the local copy")
+	fs.StringVar(&flags.NewerThan, "newer-than", "", "Only fetch content modified after this date (e.g., 2024-01-01)")
+
+	fs.BoolVar(&flags.AtomicPublish, "atomic", false, "Mirror into a new snapshot and switch the 'current' symlink only on success")
+	fs.IntVar(&flags.KeepSnapshots, "keep-snapshots", 2, "Number of previous snapshots to keep with --atomic")
+
+	fs.BoolVar(&flags.NoClobber, "nc", false, "Skip downloads that would overwrite existing files")
+	fs.StringVar(&flags.Collision, "collision", "number", "What to do when a file already exists: number, overwrite or skip")
+
+	fs.StringVar(&flags.Checksum, "checksum", "", "Verify the download against checksums (e.g., sha256:HEX, also md5 and sha1; separate several with commas)")
+
+	fs.StringVar(&flags.Conflict, "conflict", "overwrite", "What to do with existing mirror files: overwrite, skip, rename or newer")
+
+	fs.StringVar(&flags.Quota, "Q", "", "Stop starting new downloads after this many bytes (e.g., 100m, 2g)")
+
+	fs.BoolVar(&flags.Spider, "spider", false, "Only check that the URLs exist, without downloading them")
+
+	fs.StringVar(&flags.Level, "l", "5", "Levels of links to follow when mirroring (inf or 0 for no limit)")
+	fs.StringVar(&flags.Level, "level", "5", "Levels of links to follow when mirroring (inf or 0 for no limit)")
+	fs.StringVar(&flags.DepthRules, "depth-rules", "", "Per resource class recursion depths (e.g., html:3,image:inf)")
+	fs.BoolVar(&flags.PageRequisites, "p", false, "Fetch the CSS, images, scripts, fonts and media of saved pages at any depth")
+	fs.BoolVar(&flags.SingleFile, "single-file", false, "Save the page with its images, stylesheets and fonts inlined in one HTML file (MHTML with -O name.mhtml)")
+	fs.Var((*stringList)(&flags.Transforms), "transform", "Rewrite saved pages: banner[=TEXT] ({url}, {date}), strip=SELECTOR (e.g., iframe[src*=ads]) or base[=URL], can be repeated")
+	fs.StringVar(&flags.TransformExec, "transform-exec", "", "Pipe saved pages through this shell command, which prints the new HTML (WGET_URL and WGET_FILE are set)")
+	fs.BoolVar(&flags.ConsentBypass, "consent-bypass", false, "Send the cookies of common consent managers and remove cookie dialogs from saved pages")
+
+	fs.BoolVar(&flags.ServerResponse, "S", false, "Print the request and response headers of every transfer")
+	fs.BoolVar(&flags.ServerResponse, "server-response", false, "Print the request and response headers of every transfer")
+
+	var inet4Only, inet6Only bool
+	fs.BoolVar(&inet4Only, "4", false, "Only connect to IPv4 addresses")
+	fs.BoolVar(&inet6Only, "6", false, "Only connect to IPv6 addresses")
+	fs.StringVar(&flags.PreferFamily, "prefer-family", "none", "Connect to addresses of this family first: IPv4, IPv6 or none")
+
+	fs.BoolVar(&flags.NoCheckCertificate, "no-check-certificate", false, "Don't verify the server's TLS certificate")
+	fs.StringVar(&flags.CACertificate, "ca-certificate", "", "File with additional trusted certificate authorities (PEM)")
+	fs.StringVar(&flags.Certificate, "certificate", "", "Client certificate for mutual TLS (PEM)")
+	fs.StringVar(&flags.PrivateKey, "private-key", "", "Private key of the client certificate (PEM)")
+	fs.StringVar(&flags.SecureProtocol, "secure-protocol", "", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	fs.Var((*stringList)(&flags.PinSHA256), "pin-sha256", "Only accept these public keys for a host: host=BASE64 (SHA-256 of the key, comma-separated for backups), can be repeated")
+	fs.StringVar(&flags.OCSPStaple, "ocsp-staple", "", "Check stapled OCSP responses: verify (when stapled) or require")
+
+	fs.BoolVar(&flags.HTTP2, "http2", true, "Allow HTTP/2 (use --http2=false to force HTTP/1.1)")
+	fs.BoolVar(&flags.HTTP3, "http3", false, "Use HTTP/3 (QUIC) with servers that advertise it (experimental)")
+
+	fs.BoolVar(&flags.AuthNegotiate, "auth-negotiate", false, "Authenticate with Kerberos/SPNEGO using the tickets from kinit")
+
+	fs.BoolVar(&flags.Compression, "compression", false, "Request gzip, brotli or zstd compressed responses and decode them")
+
+	fs.IntVar(&flags.MaxRedirect, "max-redirect", 20, "Maximum number of redirects to follow per request")
+	fs.IntVar(&flags.MaxIdlePerHost, "max-idle-per-host", 0, "Idle connections kept open to each host for reuse (default 32)")
+	fs.BoolVar(&flags.NoKeepAlive, "no-http-keep-alive", false, "Open a new connection for every request")
+	fs.Float64Var(&flags.ConnectTimeout, "connect-timeout", 0, "Seconds allowed to connect to a server (default 30)")
+	fs.Float64Var(&flags.ResponseTimeout, "response-timeout", 0, "Seconds allowed for the response headers to arrive once a request is sent (0 for no limit)")
+	fs.BoolVar(&flags.TrustServerNames, "trust-server-names", false, "Name the output file after the final URL of a redirect chain")
+
+	fs.StringVar(&flags.Exec, "exec", "", "Shell command to run after each download ($WGET_FILE and $WGET_URL are set)")
+	fs.BoolVar(&flags.IfModified, "if-modified", false, "Only download and run --exec when the remote file changed since the last run (implies -N)")
+
+	fs.StringVar(&flags.MonthlyQuota, "monthly-quota", "", "Refuse to download once this much data (e.g., 10g) was transferred this month")
+	fs.StringVar(&flags.HistoryFile, "history-file", "", "File recording the data transferred by past runs (default: wget/history.json in the user config directory)")
+
+	fs.IntVar(&flags.MaxConcurrent, "max-concurrent", 4, "Maximum number of files downloaded at once with -i")
+	fs.IntVar(&flags.ConcurrentRequests, "concurrent-requests", 8, "Number of pages and files fetched at once when mirroring")
+
+	fs.StringVar(&flags.RelayTo, "relay-to", "", "Upload each file with PUT to this URL instead of saving it (file name appended when it ends with /)")
+
+	fs.StringVar(&flags.Progress, "progress", "", "Progress display: bar, dot or none (default: bar on terminals, dot otherwise)")
+
+	fs.BoolVar(&flags.Continue, "c", false, "Resume getting a partially-downloaded file")
+
+	fs.BoolVar(&flags.Sparse, "sparse", false, "Leave holes for runs of zeros instead of writing them (VM images, disk dumps)")
+
+	fs.StringVar(&flags.CacheDir, "cache-dir", "", "Cache responses in this directory and reuse them while fresh (Cache-Control, Expires)")
+	fs.BoolVar(&flags.Warm, "warm", false, "Warm CDN caches: fetch the URL arguments, -i or --input-sitemap URLs, or with --mirror the whole site, discarding the bodies instead of saving them")
+
+	fs.Float64Var(&flags.MaxRPS, "max-rps", 0, "Maximum number of requests sent per second overall (e.g., 2 or 0.5, 0 for no limit)")
+	fs.Float64Var(&flags.MaxRPSPerHost, "max-rps-per-host", 0, "Maximum number of requests sent per second to each host (0 for no limit)")
+	fs.BoolVar(&flags.AutoConcurrency, "auto-concurrency", false, "Adapt the number of requests in flight to each host to its response times and errors, starting low (replaces --max-concurrent and --concurrent-requests)")
+	fs.IntVar(&flags.MaxConcurrentPerHost, "max-concurrent-per-host", 0, "Maximum number of requests in flight to each host, whatever the total, e.g. for --span-hosts mirrors (0 for no limit)")
+
+	fs.Float64Var(&flags.Wait, "wait", 0, "Seconds to wait between requests to the same host (e.g., 1 or 0.5)")
+	fs.BoolVar(&flags.RandomWait, "random-wait", false, "Wait between 0.5 and 1.5 times --wait between requests")
+
+	fs.StringVar(&flags.StateFile, "state-file", "", "Record the progress of an -i batch in this file (e.g., .wget-state.json) so re-running it resumes where it stopped")
+	fs.StringVar(&flags.URLDB, "url-db", "", "Record the URLs saved in this file, and skip those an earlier run saved (e.g., .wget-urls.jsonl)")
+	fs.StringVar(&flags.ReportFile, "report-file", "", "Write the outcome of every URL of an -i batch or --spider run to this file as JSON, with failures classified by phase (dns, connect, tls, http, body), or the summary of a mirror with its skipped URLs and broken links")
+
+	fs.BoolVar(&flags.SafeMode, "safe-mode", false, "Refuse private, loopback, link-local and metadata addresses and non-HTTP redirects, for untrusted URLs")
+
+	fs.StringVar(&flags.PIDFile, "pid-file", "wget.pid", "File the process ID of a -B download is written to, removed when it finishes")
+
+	fs.BoolVar(&flags.TUI, "tui", false, "Show a full-screen dashboard of the downloads of -i or several URLs (pause, cancel, sort)")
+
+	fs.StringVar(&flags.TempDir, "temp-dir", "", "Keep .part files in this directory until complete (e.g., a fast local disk), then move them to the output directory")
+
+	fs.BoolVar(&flags.Fsync, "fsync", false, "Flush each file and its directory to disk before reporting it finished")
+	fs.BoolVar(&flags.Direct, "o-direct", false, "Write files with O_DIRECT, bypassing the page cache (Linux only, not with --sparse)")
+
+	fs.StringVar(&flags.RecordDir, "record-dir", "", "Record every HTTP exchange in this directory, for --replay-dir")
+	fs.StringVar(&flags.ReplayDir, "replay-dir", "", "Answer requests with the exchanges recorded in this directory, without using the network")
+	fs.StringVar(&flags.WarcFile, "warc-file", "", "Archive every request and response in the WARC file FILE.warc.gz")
+	fs.BoolVar(&flags.NoWarcGzip, "no-warc-compression", false, "Write the WARC file uncompressed, as FILE.warc")
+	fs.BoolVar(&flags.WarcOnly, "warc-only", false, "Only archive the mirror in the WARC file, without saving its files")
+
+	fs.StringVar(&flags.ConfigFile, "config", "", "Read settings and per-host sections from this file (default: wget/config in the user config directory)")
+
+	fs.Var((*stringList)(&flags.AltURLs), "alt-url", "Another URL serving the same file; segments are then fetched from all of them at once, can be repeated")
 
 	// Parse flags, but skip the program name
 	if err := fs.Parse(os.Args[1:]); err != nil {
@@ -56,9 +371,143 @@ func InitFlags() *Flags {
 		return nil
 	}
 
+	// The config file sets what the command line leaves out.
+	configFile, required := flags.ConfigFile, flags.ConfigFile != ""
+	if !required {
+		configFile, _ = DefaultConfigPath()
+	}
+	if configFile != "" {
+		sections, err := loadConfigFile(configFile, required, fs)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		flags.Sections = sections
+	}
+
 	
+	switch flags.Collision {
+	case "number", "overwrite", "skip":
+	default:
+		fmt.Printf("invalid --collision value %q, expected number, overwrite or skip\n", flags.Collision)
+		return nil
+	}
+	if flags.CutDirs < 0 {
+		fmt.Println("--cut-dirs must not be negative")
+		return nil
+	}
+	switch flags.Dedup {
+	case "", "hardlink", "symlink":
+	default:
+		fmt.Printf("invalid --dedup value %q, expected hardlink or symlink\n", flags.Dedup)
+		return nil
+	}
+	switch flags.Conflict {
+	case "overwrite", "skip", "rename", "newer":
+	default:
+		fmt.Printf("invalid --conflict value %q, expected overwrite, skip, rename or newer\n", flags.Conflict)
+		return nil
+	}
+	if inet4Only && inet6Only {
+		fmt.Println("-4 and -6 can't be used together")
+		return nil
+	}
+	if inet4Only {
+		flags.InetFamily = "ipv4"
+	} else if inet6Only {
+		flags.InetFamily = "ipv6"
+	}
+
+	flags.PreferFamily = strings.ToLower(flags.PreferFamily)
+	switch flags.PreferFamily {
+	case "ipv4", "ipv6", "none":
+	default:
+		fmt.Printf("invalid --prefer-family value %q, expected IPv4, IPv6 or none\n", flags.PreferFamily)
+		return nil
+	}
+
+	switch flags.Progress {
+	case "", "bar", "dot", "none":
+	default:
+		fmt.Printf("invalid --progress value %q, expected bar, dot or none\n", flags.Progress)
+		return nil
+	}
+	if flags.MaxConcurrent < 1 {
+		fmt.Println("--max-concurrent must be at least 1")
+		return nil
+	}
+	if flags.ConcurrentRequests < 1 {
+		fmt.Println("--concurrent-requests must be at least 1")
+		return nil
+	}
+	if flags.MaxRedirect < 0 {
+		fmt.Println("--max-redirect can't be negative")
+		return nil
+	}
+	if flags.MaxRPS < 0 || flags.MaxRPSPerHost < 0 {
+		fmt.Println("--max-rps and --max-rps-per-host can't be negative")
+		return nil
+	}
+	if flags.MaxConcurrentPerHost < 0 {
+		fmt.Println("--max-concurrent-per-host can't be negative")
+		return nil
+	}
+	if flags.Warm && (flags.Spider || flags.TUI || flags.CacheDir != "") {
+		fmt.Println("--warm can't be combined with --spider, --tui or --cache-dir")
+		return nil
+	}
+	if flags.UseDynamic && flags.SafeMode {
+		// Chrome makes its own connections, which --safe-mode can't check.
+		fmt.Println("--dynamic can't be combined with --safe-mode")
+		return nil
+	}
+	if flags.RecordDir != "" && flags.ReplayDir != "" {
+		fmt.Println("--record-dir and --replay-dir can't be used together")
+		return nil
+	}
+	if a := flags.ArchiveOutput; a != "" && !strings.HasSuffix(a, ".zip") && !strings.HasSuffix(a, ".tar.gz") && !strings.HasSuffix(a, ".tgz") {
+		fmt.Printf("invalid --archive-output %q, expected a .zip, .tar.gz or .tgz file\n", flags.ArchiveOutput)
+		return nil
+	}
+	if flags.DryRun && !flags.Mirror {
+		fmt.Println("--dry-run needs --mirror")
+		return nil
+	}
+	if flags.DryRun && (flags.WarcFile != "" || flags.CacheDir != "" || flags.RecordDir != "") {
+		fmt.Println("--dry-run writes nothing, so it can't be combined with --warc-file, --cache-dir or --record-dir")
+		return nil
+	}
+	if flags.ArchiveOnly && (flags.ArchiveOutput == "" || !flags.Mirror || flags.AtomicPublish) {
+		fmt.Println("--archive-only needs --mirror and --archive-output, and can't be used with --atomic")
+		return nil
+	}
+	if flags.WarcOnly && (flags.WarcFile == "" || !flags.Mirror) {
+		fmt.Println("--warc-only needs --mirror and --warc-file")
+		return nil
+	}
+	if flags.Wait < 0 {
+		fmt.Println("--wait can't be negative")
+		return nil
+	}
+	if flags.MaxIdlePerHost < 0 || flags.ConnectTimeout < 0 || flags.ResponseTimeout < 0 {
+		fmt.Println("--max-idle-per-host, --connect-timeout and --response-timeout can't be negative")
+		return nil
+	}
+	if flags.RandomWait && flags.Wait == 0 {
+		fmt.Println("--random-wait needs --wait")
+		return nil
+	}
+
+	if flags.IfModified {
+		flags.Timestamping = true
+	}
+
+	if flags.NoClobber {
+		flags.Collision = "skip"
+	}
+
 	args := fs.Args()
-	if len(args) < 1 && flags.InputFile == "" {
+	if len(args) < 1 && flags.InputFile == "" && flags.InputSitemap == "" {
 		fmt.Println("no URL specified")
 		return nil
 	}
@@ -66,6 +515,12 @@ func InitFlags() *Flags {
 	// Store URLs
 	flags.URLs = args
 
+	// One set of digests matches one file; the files of a batch have their own.
+	if flags.Checksum != "" && (len(args) > 1 || flags.InputFile != "" || flags.InputSitemap != "" || flags.Listing) {
+		fmt.Println("--checksum verifies a single file; give the files of -i batches a checksum each in the input file")
+		return nil
+	}
+
 		// Process reject lists (combine short and long options)
 		rejectTypes := []string{}
 		if rejectListShort != "" {
@@ -92,7 +547,69 @@ func InitFlags() *Flags {
 		}
 		flags.ExcludePaths = excludePaths
 
+	flags.AcceptTypes = append(splitList(acceptListShort), splitList(acceptListLong)...)
+	flags.StripQueryParams = splitList(stripQueryParams)
+	flags.KeepQueryParams = splitList(keepQueryParams)
+	flags.Domains = splitList(domains)
+	flags.ExcludeDomains = splitList(excludeDomains)
+
+	if linkExts != "" {
+		for _, ext := range strings.Split(linkExts, ",") {
+			flags.LinkExts = append(flags.LinkExts, strings.TrimSpace(ext))
+		}
+	}
+
 
 	return flags
 }
 
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// ServeFlags holds the arguments of the serve subcommand.
+type ServeFlags struct {
+	Dir    string // Mirror directory to serve
+	Listen string // Address to listen on
+}
+
+// InitServeFlags parses the arguments of `wget serve [-listen addr] <mirror-dir>`.
+func InitServeFlags(args []string) *ServeFlags {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags := &ServeFlags{}
+	fs.StringVar(&flags.Listen, "listen", "localhost:8080", "Address to serve the mirror on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s serve [-listen host:port] <mirror-dir>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil
+	}
+	flags.Dir = fs.Arg(0)
+	return flags
+}
@@ -0,0 +1,69 @@
+package download
+
+import (
+	"io"
+	"net/http"
+
+	"wget/httpclient"
+)
+
+// Progress describes how far a transfer has come.
+type Progress struct {
+	URL        string // URL the download was started with
+	File       string // Where the data is saved, "-" when written to Options.Output
+	Downloaded int64  // Bytes received so far, including the part resumed with -c
+	Total      int64  // Expected size, -1 when the server didn't report it
+	Done       bool   // Set on the last call, once the whole body was received
+}
+
+// ProgressFunc is called with the progress of a transfer each time data is
+// received. Concurrent downloads call it from several goroutines. The
+// transfer waits for it to return, so blocking pauses the transfer.
+type ProgressFunc func(Progress)
+
+// callbackWriter passes the data on to writer and reports the progress to a
+// ProgressFunc.
+type callbackWriter struct {
+	writer   io.Writer
+	report   ProgressFunc
+	progress Progress
+
+	// Reports the bytes received when they differ from the bytes written,
+	// as with compressed bodies whose Content-Length is the encoded size.
+	received func() int64
+}
+
+// newCallbackWriter creates a callbackWriter for the body of resp, continuing
+// at offset.
+func newCallbackWriter(writer io.Writer, report ProgressFunc, name string, offset, total int64, resp *http.Response) *callbackWriter {
+	c := &callbackWriter{
+		writer:   writer,
+		report:   report,
+		progress: Progress{File: name, Downloaded: offset, Total: total},
+	}
+	if compressed, ok := resp.Body.(*httpclient.DecodedBody); ok {
+		c.received = compressed.CompressedBytes
+	}
+	return c
+}
+
+// Write writes data to the underlying writer and reports the progress.
+func (c *callbackWriter) Write(data []byte) (int, error) {
+	n, err := c.writer.Write(data)
+	if c.received != nil {
+		c.progress.Downloaded = c.received()
+	} else {
+		c.progress.Downloaded += int64(n)
+	}
+	c.report(c.progress)
+	return n, err
+}
+
+// finish reports the completed transfer.
+func (c *callbackWriter) finish() {
+	if c.received != nil {
+		c.progress.Downloaded = c.received()
+	}
+	c.progress.Done = true
+	c.report(c.progress)
+}
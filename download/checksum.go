@@ -0,0 +1,148 @@
+package download
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+)
+
+// ErrChecksumMismatch is returned when a downloaded file doesn't match the
+// checksum given with --checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumQueue is the number of chunks a hash worker may fall behind the
+// download before the download waits for it.
+const checksumQueue = 16
+
+// checksum verifies downloaded data against one or more expected digests.
+// Each digest is computed by its own worker goroutine, so hashing runs
+// alongside the transfer instead of reading the file again afterwards.
+type checksum struct {
+	digests []*digest
+	once    sync.Once
+}
+
+// digest is a single expected digest and the worker computing it.
+type digest struct {
+	algorithm string
+	expected  []byte
+	hash      hash.Hash
+	chunks    chan []byte
+	done      chan struct{}
+}
+
+// newChecksum parses a comma separated list of checksum specifications of
+// the form "algorithm:hex", where algorithm is one of md5, sha1 or sha256,
+// and starts a hash worker for each of them.
+func newChecksum(spec string) (*checksum, error) {
+	c := &checksum{}
+	for _, part := range strings.Split(spec, ",") {
+		d, err := newDigest(part)
+		if err != nil {
+			return nil, err
+		}
+		c.digests = append(c.digests, d)
+	}
+	for _, d := range c.digests {
+		go d.run()
+	}
+	return c, nil
+}
+
+// newDigest parses a single "algorithm:hex" specification.
+func newDigest(spec string) (*digest, error) {
+	algorithm, value, found := strings.Cut(spec, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid checksum %q, expected algorithm:hex (e.g., sha256:abc...)", spec)
+	}
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q, expected md5, sha1 or sha256", algorithm)
+	}
+
+	expected, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(expected) != h.Size() {
+		return nil, fmt.Errorf("invalid %s digest %q", algorithm, value)
+	}
+
+	return &digest{
+		algorithm: algorithm,
+		expected:  expected,
+		hash:      h,
+		chunks:    make(chan []byte, checksumQueue),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// run hashes the chunks handed to the digest until its channel is closed.
+func (d *digest) run() {
+	defer close(d.done)
+	for chunk := range d.chunks {
+		d.hash.Write(chunk)
+	}
+}
+
+// Write hands a copy of the downloaded data to the hash workers. The caller
+// may reuse p as soon as Write returns.
+func (c *checksum) Write(p []byte) (int, error) {
+	chunk := bytes.Clone(p)
+	for _, d := range c.digests {
+		d.chunks <- chunk
+	}
+	return len(p), nil
+}
+
+// close stops the hash workers once they have hashed everything written so
+// far. It is safe to call more than once and on a nil checksum, so it can be
+// deferred on paths that never reach verify.
+func (c *checksum) close() {
+	if c == nil {
+		return
+	}
+	c.once.Do(func() {
+		for _, d := range c.digests {
+			close(d.chunks)
+		}
+		for _, d := range c.digests {
+			<-d.done
+		}
+	})
+}
+
+// verify compares the digests of the data written so far with the expected
+// ones. No more data can be written afterwards.
+func (c *checksum) verify() error {
+	c.close()
+	for _, d := range c.digests {
+		actual := d.hash.Sum(nil)
+		if !bytes.Equal(actual, d.expected) {
+			return fmt.Errorf("%w: expected %s:%x, got %s:%x", ErrChecksumMismatch, d.algorithm, d.expected, d.algorithm, actual)
+		}
+	}
+	return nil
+}
+
+// algorithms lists the algorithms being checked, for log messages.
+func (c *checksum) algorithms() string {
+	names := make([]string, len(c.digests))
+	for i, d := range c.digests {
+		names[i] = d.algorithm
+	}
+	return strings.Join(names, ", ")
+}
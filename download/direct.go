@@ -0,0 +1,106 @@
+package download
+
+import (
+	"io"
+	"os"
+	"unsafe"
+)
+
+// O_DIRECT transfers must start at an aligned file offset and memory address
+// and be a multiple of the device's block size. 4096 covers the usual 512
+// and 4096 byte sectors.
+const (
+	directAlign   = 4096
+	directBufSize = 1 << 20
+)
+
+// directWriter writes to a file with O_DIRECT (--o-direct), bypassing the
+// page cache, so the data is on the device once a write returns. The data
+// is gathered in an aligned buffer and written in whole blocks.
+type directWriter struct {
+	file *os.File
+	buf  []byte // Aligned to directAlign
+	n    int    // Bytes buffered
+	head int    // Bytes to write before the file offset is aligned
+}
+
+// newDirectWriter returns a directWriter continuing at the current offset of
+// file. A resumed file may end in the middle of a block; the data up to the
+// next block boundary is then written through the page cache.
+func newDirectWriter(file *os.File) (*directWriter, error) {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	w := &directWriter{file: file, buf: alignedBuffer(directBufSize, directAlign)}
+	if rem := offset % directAlign; rem != 0 {
+		w.head = int(directAlign - rem)
+	} else if err := setDirect(file, true); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write buffers p, writing the buffer out whenever it is full.
+func (w *directWriter) Write(p []byte) (int, error) {
+	written := 0
+	if w.head > 0 {
+		n := min(len(p), w.head)
+		if _, err := w.file.Write(p[:n]); err != nil {
+			return 0, err
+		}
+		w.head -= n
+		written += n
+		p = p[n:]
+		if w.head == 0 {
+			if err := setDirect(w.file, true); err != nil {
+				return written, err
+			}
+		}
+	}
+	for len(p) > 0 {
+		n := copy(w.buf[w.n:], p)
+		w.n += n
+		written += n
+		p = p[n:]
+		if w.n == len(w.buf) {
+			if _, err := w.file.Write(w.buf); err != nil {
+				return written, err
+			}
+			w.n = 0
+		}
+	}
+	return written, nil
+}
+
+// finish writes out the buffered data. The last partial block can't be
+// written with O_DIRECT, so it goes through the page cache and is left for
+// --fsync (or the kernel) to flush.
+func (w *directWriter) finish() error {
+	aligned := w.n - w.n%directAlign
+	if aligned > 0 {
+		if _, err := w.file.Write(w.buf[:aligned]); err != nil {
+			return err
+		}
+	}
+	if tail := w.buf[aligned:w.n]; len(tail) > 0 {
+		if err := setDirect(w.file, false); err != nil {
+			return err
+		}
+		if _, err := w.file.Write(tail); err != nil {
+			return err
+		}
+	}
+	w.n = 0
+	return nil
+}
+
+// alignedBuffer returns a buffer of size bytes starting at a multiple of align.
+func alignedBuffer(size, align int) []byte {
+	buf := make([]byte, size+align)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) % uintptr(align)); rem != 0 {
+		offset = align - rem
+	}
+	return buf[offset : offset+size]
+}
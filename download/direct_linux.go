@@ -0,0 +1,30 @@
+//go:build linux
+
+package download
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// setDirect turns O_DIRECT on or off for an open file.
+func setDirect(file *os.File, on bool) error {
+	fd := file.Fd()
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to get the flags of %s: %v", file.Name(), errno)
+	}
+	if on {
+		flags |= syscall.O_DIRECT
+	} else {
+		flags &^= syscall.O_DIRECT
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFL, flags); errno != 0 {
+		if errno == syscall.EINVAL {
+			return fmt.Errorf("the file system of %s doesn't support --o-direct", file.Name())
+		}
+		return fmt.Errorf("failed to set O_DIRECT on %s: %v", file.Name(), errno)
+	}
+	return nil
+}
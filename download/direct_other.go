@@ -0,0 +1,16 @@
+//go:build !linux
+
+package download
+
+import (
+	"errors"
+	"os"
+)
+
+// setDirect turns O_DIRECT on or off for an open file, which needs Linux.
+func setDirect(file *os.File, on bool) error {
+	if !on {
+		return nil
+	}
+	return errors.New("--o-direct is only supported on Linux")
+}
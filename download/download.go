@@ -1,7 +1,13 @@
+// Package download retrieves files over HTTP for the command line tool and
+// for other Go programs. The functions ending in Context stop when their
+// context is cancelled or its deadline passes, returning an error that wraps
+// both ErrInterrupted and the context's error.
 package download
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,124 +18,793 @@ import (
 	"sync"
 	"time"
 
+	"wget/httpclient"
 	"wget/utils"
+
+	"golang.org/x/term"
 )
 
+// Options holds the settings applied to a download.
+type Options struct {
+	OutputFile string   // Name to save the file under, derived from the URL when empty
+	OutputDir  string   // Directory the file is saved in
+	RateLimit  string   // Maximum download speed (e.g., 200k, 2M)
+	Background bool     // Disables the progress bar
+	Method     string   // HTTP method, defaults to GET (or POST when a body is set)
+	PostData   string   // Request body sent to the server
+	BodyFile   string   // File whose contents are sent as the request body
+	Headers    []string // Extra request headers in "Name: value" form
+
+	ContentDisposition bool      // Use the file name from the Content-Disposition header
+	NewerThan          time.Time // Skip files whose Last-Modified is not after this date
+	Timestamping       bool      // Only download files newer than the local copy (-N)
+	Collision          string    // What to do when the output file exists (see Collision* constants)
+	Checksum           string    // Expected digests as comma separated "algorithm:hex" (md5, sha1 or sha256)
+	TrustServerNames   bool      // Name the file after the final URL when redirected
+	Exec               string    // Shell command run after each file is saved
+	Output             io.Writer // Receives the body instead of a file (-O -)
+	MaxConcurrent      int       // Number of files DownloadMultipleFiles fetches at once
+	RelayTo            string    // Upload files to this URL instead of saving them (--relay-to)
+	Sources            []string  // Other URLs of the same file, fetched in segments at the same time (--alt-url)
+
+	Progress     *OutputManager // Shows the progress of concurrent downloads, set by DownloadMultipleFiles
+	ProgressMode string         // Progress display (see Progress* constants), picked from the output when empty
+	OnProgress   ProgressFunc   // Called as each transfer progresses, in addition to the progress display
+	Log          io.Writer      // Destination of messages, stdout when nil
+
+	Continue bool   // Resume a partially downloaded file (-c)
+	Sparse   bool   // Seek over runs of zeros instead of writing them (--sparse)
+	TempDir  string // Directory .part files are kept in until complete, next to the output file when empty (--temp-dir)
+	Fsync    bool   // Flush the file and its directory to disk before reporting success (--fsync)
+	Direct   bool   // Write with O_DIRECT, bypassing the page cache (--o-direct, Linux only)
+
+	StateFile  string      // Records the progress of DownloadMultipleFiles, so re-running the batch resumes it
+	ReportFile string      // Receives the outcome of every URL of a batch or spider run as JSON (--report-file)
+	state      *batchState // Progress of the batch loaded from StateFile, set by DownloadMultipleFiles
+	URLDB      string      // File of the URLs saved by earlier runs, which batches don't fetch again (--url-db)
+	urlDB      *urlDB      // Database opened from URLDB, set by DownloadMultipleFiles
+
+	StripTracking bool // Drop the tracking parameters of utils.TrackingParams from URLs, downloading a batch's duplicates once (--strip-tracking)
+
+	JobContext func(ctx context.Context, url string) context.Context // Derives the context of each file of a batch, so files can be cancelled one by one
+	OnJobDone  func(url string, err error)                           // Called with the outcome of each file of a batch
+
+	Quota  *utils.Quota // Byte quota shared by all downloads of a batch (-Q)
+	Client *http.Client // Client used for all requests, http.DefaultClient when nil
+}
+
+// httpClient returns the HTTP client downloads should use.
+func (o Options) httpClient() *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+// progressMode returns the progress display to use. Unless set, the bar is
+// only drawn on terminals, other outputs like logs or pipes get plain lines.
+func (o Options) progressMode() string {
+	if o.Background {
+		return ProgressNone
+	}
+	if o.ProgressMode != "" {
+		return o.ProgressMode
+	}
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		return ProgressBar
+	}
+	return ProgressDot
+}
+
+// logf prints a message, through the output manager when there is one.
+func (o Options) logf(format string, args ...interface{}) {
+	if o.Progress != nil {
+		o.Progress.Printf(format, args...)
+		return
+	}
+	fmt.Fprintf(o.logOutput(), format, args...)
+}
+
+// logOutput returns the writer messages are printed to.
+func (o Options) logOutput() io.Writer {
+	if o.Log == nil {
+		return os.Stdout
+	}
+	return o.Log
+}
+
+// collisionStrategy returns the strategy used for existing output files.
+// Timestamping needs to replace outdated copies and -c restarts downloads
+// the server won't resume, so both always overwrite.
+func collisionStrategy(opts Options) string {
+	if opts.Timestamping || opts.Continue {
+		return CollisionOverwrite
+	}
+	return opts.Collision
+}
+
 // DownloadFile downloads a file from the provided URL, saves it to the specified output directory and file, and applies a rate limit if provided.
-// DownloadFile downloads a file from the provided URL, saves it to the specified output directory and file, and applies a rate limit if provided.
-func DownloadFile(fileURL, outputFile, outputDir, rateLimit string, background bool) error {
+func DownloadFile(fileURL string, opts Options) error {
+	return DownloadFileContext(context.Background(), fileURL, opts)
+}
+
+// DownloadFileContext works like DownloadFile, stopping the transfer when ctx
+// is cancelled. The data received so far is then kept in a .part file, which
+// -c picks up on the next run, and ErrInterrupted is returned.
+func DownloadFileContext(ctx context.Context, fileURL string, opts Options) error {
+	_, err := DownloadFileResult(ctx, fileURL, opts)
+	return err
+}
+
+// DownloadFileResult works like DownloadFileContext and also describes the
+// download, including the redirects that were followed.
+func DownloadFileResult(ctx context.Context, fileURL string, opts Options) (*DownloadResult, error) {
+	if opts.StripTracking {
+		fileURL = utils.StripTracking(fileURL)
+	}
+	result := &DownloadResult{URL: fileURL}
+	err := downloadFile(ctx, fileURL, opts, result)
+	result.Failure = FailurePhase(err)
+	return result, err
+}
+
+// downloadFile does the work of DownloadFile, filling in result as it goes.
+func downloadFile(ctx context.Context, fileURL string, opts Options, result *DownloadResult) error {
+	if opts.Quota.Exceeded() {
+		return utils.ErrQuotaExceeded
+	}
+
 	startTime := time.Now()
-	fmt.Printf("start at %s\n", startTime.Format("2006-01-02 15:04:05"))
+	opts.logf("start at %s\n", startTime.Format("2006-01-02 15:04:05"))
+
+	req, err := newRequest(ctx, fileURL, opts)
+	if err != nil {
+		return err
+	}
+
+	var sum *checksum
+	if opts.Checksum != "" {
+		if sum, err = newChecksum(opts.Checksum); err != nil {
+			return err
+		}
+		// Stops the hash workers when the download ends before verifying.
+		defer sum.close()
+	}
+
+	// Progress callbacks are told which download they belong to.
+	if report := opts.OnProgress; report != nil {
+		opts.OnProgress = func(p Progress) {
+			p.URL = fileURL
+			report(p)
+		}
+	}
+
+	// With several sources, segments of the file are fetched from all of them.
+	if len(opts.Sources) > 0 && opts.Output == nil && opts.RelayTo == "" && !opts.Direct {
+		return downloadSegmented(ctx, fileURL, opts, sum, result)
+	}
 
-	// Make an HTTP GET request to the file URL.
-	resp, err := http.Get(fileURL)
+	localName := opts.OutputFile
+	if localName == "" {
+		localName = fileNameFromURL(fileURL)
+	}
+
+	// In no-clobber mode, don't even send the request if the file is already there.
+	if collisionStrategy(opts) == CollisionSkip && !opts.ContentDisposition && !opts.TrustServerNames && opts.Output == nil && opts.RelayTo == "" {
+		if _, err := os.Stat(filepath.Join(opts.OutputDir, localName)); err == nil {
+			opts.logf("file %s already exists, not retrieving\n", filepath.Join(opts.OutputDir, localName))
+			return nil
+		}
+	}
+
+	// In timestamping mode, let the server tell us whether the local copy is current.
+	if opts.Timestamping {
+		utils.SetIfModifiedSince(req, filepath.Join(opts.OutputDir, localName))
+	}
+
+	// With -c, only ask for the part of the file that is still missing. That
+	// is the .part file of an interrupted run, or a partial file another tool
+	// saved under the final name.
+	var offset int64
+	var resumePath string
+	var restarted bool // The server ignored the range, the partial file is replaced
+	if opts.Continue && opts.Output == nil && opts.RelayTo == "" {
+		localPath := filepath.Join(opts.OutputDir, localName)
+		resumePath = partPath(localPath, opts.TempDir)
+		if _, err := os.Stat(resumePath); errors.Is(err, os.ErrNotExist) && opts.TempDir != "" {
+			// Started without --temp-dir
+			resumePath = partPath(localPath, "")
+		}
+		if _, err := os.Stat(resumePath); errors.Is(err, os.ErrNotExist) {
+			resumePath = localPath
+		}
+		if info, err := os.Stat(resumePath); err == nil && info.Size() > 0 {
+			offset = info.Size()
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			// Only resume the version an earlier run of the batch started on.
+			if etag := opts.state.etag(fileURL); etag != "" {
+				req.Header.Set("If-Range", etag)
+			}
+			// Byte ranges of a compressed representation can't be appended to the decoded part.
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+	}
+
+	// Send the request to the file URL.
+	resp, err := sendRequest(ctx, req, opts)
 	if err != nil {
+		if ctx.Err() != nil {
+			return interrupted(ctx)
+		}
 		return err
 	}
 	defer resp.Body.Close()
 
+	if offset > 0 {
+		switch resp.StatusCode {
+		case http.StatusRequestedRangeNotSatisfiable:
+			// A part file the server has nothing to add to is complete, if it
+			// is as long as the server's file.
+			if size := contentRangeSize(resp.Header.Get("Content-Range")); size != offset {
+				return fmt.Errorf("%s has %d bytes but the server's file has %d, remove it to download the file again", resumePath, offset, size)
+			}
+			if localPath := filepath.Join(opts.OutputDir, localName); resumePath != localPath {
+				if err := moveFile(resumePath, localPath); err != nil {
+					return err
+				}
+			}
+			opts.logf("the file is already fully retrieved; nothing to do [%s]\n", fileURL)
+			return nil
+		case http.StatusPartialContent:
+			if start := contentRangeStart(resp.Header.Get("Content-Range")); start != offset {
+				return fmt.Errorf("server resumed at byte %d instead of %d", start, offset)
+			}
+		case http.StatusOK:
+			// Appending the full body to the partial file would corrupt it.
+			opts.logf("warning: server ignored the range request, restarting %s from the beginning\n", localName)
+			offset = 0
+			restarted = true
+		}
+	}
+
+	result.FinalURL = resp.Request.URL.String()
+	result.StatusCode = resp.StatusCode
+	result.Redirects = redirectChain(resp)
+
+	if opts.Timestamping && resp.StatusCode == http.StatusNotModified {
+		opts.logf("server file no newer than local file, not retrieving [%s]\n", fileURL)
+		return nil
+	}
+
 	// Check if the server returned a successful HTTP status.
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status: %s", resp.Status)
+	if resp.StatusCode != http.StatusOK && !(offset > 0 && resp.StatusCode == http.StatusPartialContent) {
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	opts.logf("sending request, awaiting response... status %s\n", resp.Status)
+
+	// Skip the file if the server reports it hasn't changed since the cutoff date.
+	if !opts.NewerThan.IsZero() {
+		if lastMod, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && !lastMod.After(opts.NewerThan) {
+			opts.logf("skipping %s: not modified since %s\n", fileURL, opts.NewerThan.Format("2006-01-02"))
+			return nil
+		}
 	}
-	fmt.Printf("sending request, awaiting response... status %s\n", resp.Status)
 
 	// Get the content length of the file.
+	// For compressed responses this is the encoded size, as sent over the wire.
 	contentLength := resp.ContentLength
-	fmt.Printf("content size: %d [~%.2fMB]\n", contentLength, float64(contentLength)/(1024*1024))
+	if _, compressed := resp.Body.(*httpclient.DecodedBody); compressed {
+		opts.logf("content size: %d [~%.2fMB] compressed\n", contentLength, float64(contentLength)/(1024*1024))
+	} else {
+		opts.logf("content size: %d [~%.2fMB]\n", contentLength, float64(contentLength)/(1024*1024))
+	}
+
+	// With -O -, stream the body to the output writer instead of saving a file.
+	if opts.Output != nil {
+		size, err := copyBody(opts.Output, "-", 0, resp, opts, sum)
+		result.Size = size
+		if err != nil {
+			if ctx.Err() != nil {
+				return interrupted(ctx)
+			}
+			return err
+		}
+		if sum != nil {
+			if err := sum.verify(); err != nil {
+				return err
+			}
+			opts.logf("\nchecksum verified (%s)\n", sum.algorithms())
+		}
+		opts.logf("\nDownloaded [%s]\n", fileURL)
+		opts.logf("finished at %s\n", time.Now().Format("2006-01-02 15:04:05"))
+		return nil
+	}
 
-	// If the output file name is not provided, use the base name of the URL as the file name.
-	fileName := outputFile
+	// If the output file name is not provided, use the name suggested by the server
+	// (when allowed) or the base name of the URL path as the file name.
+	fileName := opts.OutputFile
+	if fileName == "" && opts.ContentDisposition {
+		fileName = fileNameFromContentDisposition(resp.Header.Get("Content-Disposition"))
+	}
+	if fileName == "" && opts.TrustServerNames {
+		fileName = fileNameFromURL(resp.Request.URL.String())
+	}
 	if fileName == "" {
-		fileName = filepath.Base(fileURL)
+		fileName = fileNameFromURL(fileURL)
+	}
+	// The range was computed for the local file, keep writing to it.
+	if offset > 0 || restarted {
+		fileName = localName
+	}
+
+	// With --relay-to, pass the body on to the relay target instead of saving it.
+	if opts.RelayTo != "" {
+		return relayFile(ctx, fileURL, fileName, resp, opts, sum, result)
 	}
 
 	// Set the full file path where the file will be saved.
-	filePath := filepath.Join(outputDir, fileName)
-	fmt.Printf("saving file to: %s\n", filePath)
+	filePath := filepath.Join(opts.OutputDir, fileName)
+	// Servers that ignore If-Modified-Since are checked against Last-Modified.
+	if opts.Timestamping && utils.IsLocalCopyCurrent(filePath, resp) {
+		opts.logf("server file no newer than local file, not retrieving [%s]\n", fileURL)
+		return nil
+	}
 
 	// Ensure the output directory exists (create if it doesn't).
-	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+	if err := os.MkdirAll(opts.OutputDir, os.ModePerm); err != nil {
 		return err
 	}
+	if opts.TempDir != "" {
+		if err := os.MkdirAll(opts.TempDir, os.ModePerm); err != nil {
+			return err
+		}
+	}
 
-	// Create the output file in the specified location.
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+	// Create the .part file the data is written to until the download is
+	// complete, unless the output file already exists and must be kept.
+	var file *os.File
+	part := partPath(filePath, opts.TempDir)
+	if offset > 0 {
+		if !claimPart(part) {
+			return fmt.Errorf("%s is already being downloaded", filePath)
+		}
+		defer releasePart(part)
+		if resumePath != part {
+			if err := moveFile(resumePath, part); err != nil {
+				return err
+			}
+		}
+		if file, err = openForResume(part, sum); err != nil {
+			return err
+		}
+		opts.logf("resuming %s at byte %d\n", filePath, offset)
+	} else {
+		// A restarted download replaces the partial file it was to resume,
+		// under the same name.
+		strategy := collisionStrategy(opts)
+		if restarted {
+			strategy = CollisionOverwrite
+		}
+		if file, filePath, err = createOutputFile(filePath, strategy, opts.TempDir); err != nil {
+			return err
+		}
+		if file == nil {
+			opts.logf("file %s already exists, not retrieving\n", filePath)
+			return nil
+		}
+		part = file.Name()
+		defer releasePart(part)
+		if restarted && resumePath != part && resumePath != filePath {
+			// A part file kept outside --temp-dir, which -c would otherwise pick up again
+			os.Remove(resumePath)
+		}
+		opts.logf("saving file to: %s\n", filePath)
 	}
 	defer file.Close()
+	opts.state.begin(fileURL, filePath, resp.Header.Get("ETag"), offset)
 
-	// Set up the writer. If rate limit is specified, apply rate limiting to the writer.
-	var writer io.Writer = file
-	if rateLimit != "" {
-		limit, err := utils.ParseRateLimit(rateLimit)
-		if err != nil {
+	// With --sparse, runs of zeros become holes instead of being written.
+	// With --o-direct, the data bypasses the page cache.
+	var dst io.Writer = file
+	var sparse *sparseWriter
+	var direct *directWriter
+	switch {
+	case opts.Sparse && opts.Direct:
+		return errors.New("--sparse can't be combined with --o-direct")
+	case opts.Sparse:
+		if sparse, err = newSparseWriter(file); err != nil {
+			return err
+		}
+		dst = sparse
+	case opts.Direct:
+		if direct, err = newDirectWriter(file); err != nil {
 			return err
 		}
-		writer = NewRateLimitedWriter(file, limit)
+		dst = direct
 	}
 
-	// Only use progress writer if not in background mode
-	if !background {
-		// Set up a writer that will track download progress.
-		progressWriter := NewProgressWriter(writer, contentLength)
-		_, err = io.Copy(progressWriter, resp.Body)
-	} else {
-		// In background mode, just copy the data without progress tracking
-		_, err = io.Copy(writer, resp.Body)
+	result.FilePath = filePath
+	size, err := copyBody(dst, filePath, offset, resp, opts, sum)
+	result.Size = size
+	if err != nil {
+		if ctx.Err() != nil {
+			if direct != nil {
+				direct.finish() // Keep what was received for resuming
+			}
+			return keepPartialFile(ctx, file, offset+size, result)
+		}
+		return err
+	}
+	if sparse != nil {
+		if err := sparse.finish(); err != nil {
+			return err
+		}
+	}
+	if direct != nil {
+		if err := direct.finish(); err != nil {
+			return err
+		}
 	}
 
-	if err != nil {
+	// Never leave a corrupted file behind when the checksum doesn't match.
+	if sum != nil {
+		if err := sum.verify(); err != nil {
+			file.Close()
+			os.Remove(part)
+			return err
+		}
+		opts.logf("\nchecksum verified (%s)\n", sum.algorithms())
+	}
+
+	// The file is complete, close it and move it to its final name before
+	// touching its modification time or handing it to the hook. With
+	// --fsync, the data and the rename are on disk before it is reported.
+	if opts.Fsync {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s: %v", part, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := moveFile(part, filePath); err != nil {
 		return err
 	}
+	if opts.Fsync {
+		if err := syncDir(filepath.Dir(filePath)); err != nil {
+			return err
+		}
+	}
 
-	fmt.Printf("\nDownloaded [%s]\n", fileURL)
-	fmt.Printf("finished at %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	// Keep the server's modification time so later -N runs can compare against it.
+	if opts.Timestamping {
+		if err := utils.SetModTime(filePath, resp); err != nil {
+			return err
+		}
+	}
+
+	opts.logf("\nDownloaded [%s]\n", fileURL)
+	opts.logf("finished at %s\n", time.Now().Format("2006-01-02 15:04:05"))
+
+	// Skipped files returned earlier, so the hook only sees files actually retrieved.
+	if opts.Exec != "" {
+		return runHook(ctx, opts.logOutput(), opts.Exec, filePath, fileURL)
+	}
 	return nil
 }
 
-// DownloadMultipleFiles initiates downloading multiple files concurrently using goroutines.
-// A wait group is used to synchronize the completion of multiple downloads.
-// Loop through all provided URLs and download them concurrently.
-// Increment the wait group counter for each download.
-// Start a new goroutine for each download.
-// Ensure the counter is decremented when the download completes.
-// DownloadMultipleFiles downloads multiple files in parallel from the provided URLs
-func DownloadMultipleFiles(urls []string, outputDir, rateLimit string, background bool) {
+// copyBody copies the response body to dst, counting it against the quota,
+// feeding the checksum, applying the rate limit and reporting the progress.
+// The offset is the size of the part already downloaded by an earlier run.
+// It returns the number of bytes copied.
+func copyBody(dst io.Writer, name string, offset int64, resp *http.Response, opts Options, sum *checksum) (n int64, err error) {
+	// Set up the writer, counting the data against the download quota if there is one.
+	writer := opts.Quota.Writer(dst)
+
+	// If a checksum is given, tee the body into the hash workers as it is read.
+	var body io.Reader = failureReader{resp.Body}
+	if sum != nil {
+		body = io.TeeReader(body, sum)
+	}
+
+	// If rate limit is specified, apply rate limiting to the writer.
+	if opts.RateLimit != "" {
+		limit, err := utils.ParseRateLimit(opts.RateLimit)
+		if err != nil {
+			return 0, err
+		}
+		writer = NewRateLimitedWriter(writer, limit)
+	}
+
+	// Resumed downloads count the part already on disk, so the progress picks up where it stopped.
+	total := resp.ContentLength
+	if total >= 0 {
+		total += offset
+	}
+
+	// Report the progress to the caller's callback as well as on the display.
+	if opts.OnProgress != nil {
+		callback := newCallbackWriter(writer, opts.OnProgress, name, offset, total, resp)
+		writer = callback
+		defer func() {
+			if err == nil {
+				callback.finish()
+			}
+		}()
+	}
+
+	// In background mode (or with --progress=none), just copy the data without progress tracking
+	mode := opts.progressMode()
+	if mode == ProgressNone {
+		return io.Copy(writer, body)
+	}
+
+	// Set up a writer that will track download progress.
+	var progressWriter *ProgressWriter
+	if opts.Progress != nil {
+		progressWriter = opts.Progress.newProgressWriter(writer, name, total)
+	} else {
+		progressWriter = NewProgressWriter(writer, total)
+		progressWriter.name = name
+		progressWriter.plain = mode == ProgressDot
+	}
+	progressWriter.downloaded = offset
+	if compressed, ok := resp.Body.(*httpclient.DecodedBody); ok {
+		progressWriter.received = compressed.CompressedBytes
+	}
+	n, err = io.Copy(progressWriter, body)
+	progressWriter.finish()
+	return n, err
+}
+
+// DownloadMultipleFiles downloads multiple files in parallel from the provided URLs.
+// A pool of opts.MaxConcurrent workers (one when unset) takes the URLs from a
+// channel, so no more than that many downloads run at once.
+// A wait group is used to synchronize the completion of the workers.
+// It returns an error if any of the downloads failed.
+func DownloadMultipleFiles(urls []string, opts Options) error {
+    return DownloadMultipleFilesContext(context.Background(), urls, opts)
+}
+
+// DownloadMultipleFilesContext works like DownloadMultipleFiles, stopping all
+// transfers when ctx is cancelled. It then lists the files that weren't
+// completed and returns ErrInterrupted.
+func DownloadMultipleFilesContext(ctx context.Context, urls []string, opts Options) error {
+    return DownloadEntriesContext(ctx, EntriesForURLs(urls), opts)
+}
+
+// DownloadEntriesContext works like DownloadMultipleFilesContext, applying
+// the options of each entry (as read by ReadEntriesFromFile) to its file.
+func DownloadEntriesContext(ctx context.Context, entries []Entry, opts Options) error {
     var wg sync.WaitGroup
-    for _, u := range urls {
+    var mu sync.Mutex
+    failed := 0
+    failures := make(map[Phase]int) // Failed downloads by phase
+    report := newBatchReport(opts.ReportFile)
+    var completed []*DownloadResult
+    var partial []*DownloadResult // Interrupted with a .part file to resume
+    var skipped []string
+    var incomplete []string
+
+    if opts.StripTracking {
+        entries = withoutTracking(entries, opts)
+    }
+
+    workers := opts.MaxConcurrent
+    if workers < 1 {
+        workers = 1
+    }
+    if workers > len(entries) {
+        workers = len(entries)
+    }
+
+    // With a state file, pick up where an earlier run of the same batch stopped.
+    if opts.StateFile != "" {
+        state, err := loadBatchState(opts.StateFile)
+        if err != nil {
+            return err
+        }
+        opts.state = state
+    }
+
+    // With a URL database, skip what earlier runs (of any batch) saved.
+    if opts.URLDB != "" {
+        db, err := openURLDB(opts.URLDB)
+        if err != nil {
+            return err
+        }
+        defer db.close()
+        opts.urlDB = db
+    }
+
+    // Give each file its own progress line instead of interleaving progress bars.
+    if opts.progressMode() == ProgressBar {
+        opts.Progress = NewOutputManager()
+    }
+
+    jobs := make(chan Entry)
+    for i := 0; i < workers; i++ {
         wg.Add(1)
-        go func(url string) {
+        go func() {
             defer wg.Done()
-            err := DownloadFile(url, "", outputDir, rateLimit, background)
-            if err != nil {
-                fmt.Printf("Error downloading %s: %v\n", url, err)
+            for entry := range jobs {
+                url := entry.URL
+                jobCtx := ctx
+                if opts.JobContext != nil {
+                    jobCtx = opts.JobContext(ctx, url)
+                }
+                result, err := downloadJob(jobCtx, url, entry.apply(opts))
+                if err == nil {
+                    opts.urlDB.add(url, result)
+                }
+                if opts.OnJobDone != nil {
+                    opts.OnJobDone(url, err)
+                }
+                report.addDownload(url, result, err)
+                if err == nil {
+                    mu.Lock()
+                    completed = append(completed, result)
+                    mu.Unlock()
+                } else if errors.Is(err, ErrInterrupted) && ctx.Err() != nil {
+                    // A file cancelled on its own counts as failed below.
+                    mu.Lock()
+                    if result.PartialPath != "" {
+                        partial = append(partial, result)
+                    } else {
+                        incomplete = append(incomplete, url+" (no data received)")
+                    }
+                    mu.Unlock()
+                } else if errors.Is(err, utils.ErrQuotaExceeded) {
+                    mu.Lock()
+                    skipped = append(skipped, url)
+                    mu.Unlock()
+                } else if err != nil {
+                    opts.logf("Error downloading %s: %v\n", url, err)
+                    mu.Lock()
+                    failed++
+                    failures[result.Failure]++
+                    mu.Unlock()
+                }
             }
-        }(u)
+        }()
     }
+    started := 0
+feed:
+    for _, entry := range entries {
+        select {
+        case jobs <- entry:
+            started++
+        case <-ctx.Done():
+            break feed
+        }
+    }
+    close(jobs)
+
     // Wait for all downloads to complete.
     wg.Wait()
-    fmt.Println("Download finished.")
+    defer func() {
+        if err := report.write(); err != nil {
+            opts.logf("Warning: %v\n", err)
+        }
+    }()
+
+    if ctx.Err() != nil {
+        for _, entry := range entries[started:] {
+            incomplete = append(incomplete, entry.URL+" (not started)")
+            report.skip(entry.URL, interrupted(ctx))
+        }
+        opts.logf("\nInterrupted: %d of %d files completed, %d incomplete.\n", len(completed), len(entries), len(partial)+len(incomplete))
+        logInterruption(opts, completed, partial, incomplete)
+        return interrupted(ctx)
+    }
+    opts.logf("Download finished.\n")
+
+    if len(skipped) > 0 {
+        opts.logf("\nDownload quota of %s exceeded (%s downloaded), skipped %d files:\n",
+            utils.FormatBytes(opts.Quota.Limit()), utils.FormatBytes(opts.Quota.Used()), len(skipped))
+        for _, url := range skipped {
+            opts.logf("- %s\n", url)
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("%d of %d downloads failed (%s)", failed, len(entries), formatFailures(failures))
+    }
+    // The whole batch is done, a later run starts afresh.
+    if opts.state != nil && len(skipped) == 0 {
+        opts.state.remove()
+    }
+    return nil
+}
+
+// logInterruption lists what became of the files of an interrupted batch:
+// those completed, the partial files -c resumes at the given offsets, and
+// those with nothing saved.
+func logInterruption(opts Options, completed, partial []*DownloadResult, incomplete []string) {
+	if len(completed) > 0 {
+		opts.logf("Completed:\n")
+		for _, result := range completed {
+			if result.FilePath != "" {
+				opts.logf("- %s -> %s\n", result.URL, result.FilePath)
+			} else {
+				opts.logf("- %s\n", result.URL)
+			}
+		}
+	}
+	if len(partial) > 0 {
+		opts.logf("Partial:\n")
+		for _, result := range partial {
+			opts.logf("- %s -> %s (stopped at byte %d)\n", result.URL, result.PartialPath, result.PartialSize)
+		}
+	}
+	if len(incomplete) > 0 {
+		opts.logf("Not saved:\n")
+		for _, url := range incomplete {
+			opts.logf("- %s\n", url)
+		}
+	}
+}
+
+// downloadJob downloads one file of a batch. When the URL database or the
+// state file shows an earlier run finished the file it is skipped, and when
+// the state file shows the file was started the partial file is resumed.
+func downloadJob(ctx context.Context, fileURL string, opts Options) (*DownloadResult, error) {
+	if saved, ok := opts.urlDB.lookup(fileURL); ok {
+		opts.logf("%s was already downloaded to %s, skipping\n", fileURL, saved.Path)
+		return &DownloadResult{URL: fileURL, FilePath: saved.Path, Size: saved.Size}, nil
+	}
+	if opts.state == nil {
+		return DownloadFileResult(ctx, fileURL, opts)
+	}
+
+	job, ok := opts.state.job(fileURL)
+	if ok && job.Done && job.Path != "" {
+		if _, err := os.Stat(job.Path); err == nil {
+			opts.logf("%s was downloaded to %s by an earlier run, skipping\n", fileURL, job.Path)
+			return &DownloadResult{URL: fileURL, FilePath: job.Path}, nil
+		}
+	}
+	if ok && !job.Done && job.Path != "" {
+		opts.Continue = true
+		opts.OutputDir = filepath.Dir(job.Path)
+		opts.OutputFile = filepath.Base(job.Path)
+	}
+
+	report := opts.OnProgress
+	opts.OnProgress = func(p Progress) {
+		opts.state.progress(fileURL, p.Downloaded)
+		if report != nil {
+			report(p)
+		}
+	}
+
+	result, err := DownloadFileResult(ctx, fileURL, opts)
+	opts.state.finish(fileURL, result, err)
+	return result, err
 }
 
 // Helper function to read URLs from a file
 // In download package
+// A filename of "-" reads the URLs from standard input (-i -). For input
+// files listing per-URL options, see ReadEntriesFromFile.
 func ReadURLsFromFile(filename string) ([]string, error) {
-	file, err := os.Open(filename) // Open the file containing URLs
+	entries, err := ReadEntriesFromFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %v", filename, err)
+		return nil, err
 	}
-	defer func() {
-		closeErr := file.Close()
-		if closeErr != nil {
-			err = closeErr // Return the error of closing the file
-		}
-	}()
+	urls := make([]string, len(entries))
+	for i, entry := range entries {
+		urls[i] = entry.URL
+	}
+	return urls, nil
+}
 
+// readURLs reads one URL per line from r, skipping (and reporting) empty
+// lines and invalid URLs. name identifies the input in messages.
+func readURLs(r io.Reader, name string) ([]string, error) {
 	var validURLs []string
 	var invalidURLs []string
-	scanner := bufio.NewScanner(file) // Scanner to read the file line by line
+	scanner := bufio.NewScanner(r) // Scanner to read the input line by line
 	lineNumber := 0
 
 	for scanner.Scan() {
@@ -168,9 +843,5 @@ func ReadURLsFromFile(filename string) ([]string, error) {
 			len(validURLs), len(invalidURLs))
 	}
 
-	if len(validURLs) == 0 {
-		return nil, fmt.Errorf("no valid URLs found in file %s", filename)
-	}
-
 	return validURLs, nil
 }
@@ -0,0 +1,121 @@
+package download
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Phase is the stage of a request at which a download failed. The first
+// three point at the network or the client's setup, the next two at the
+// server.
+type Phase string
+
+const (
+	PhaseDNS         Phase = "dns"         // The host name couldn't be resolved
+	PhaseConnect     Phase = "connect"     // The TCP connection couldn't be established
+	PhaseTLS         Phase = "tls"         // The TLS handshake or certificate check failed
+	PhaseHTTP        Phase = "http"        // The server answered with an error status
+	PhaseBody        Phase = "body"        // The connection failed while the body was read
+	PhaseInterrupted Phase = "interrupted" // The download was stopped (Ctrl-C, deadline)
+	PhaseOther       Phase = "other"       // Anything else, e.g. a full disk or a checksum mismatch
+)
+
+// StatusError is returned for a response with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	Status     string // e.g. "404 Not Found"
+}
+
+func (e *StatusError) Error() string {
+	return "status: " + e.Status
+}
+
+// FailurePhase returns the phase at which err happened, or "" when err is nil.
+func FailurePhase(err error) Phase {
+	if err == nil {
+		return ""
+	}
+	var (
+		statusErr *StatusError
+		bodyErr   *bodyReadError
+		dnsErr    *net.DNSError
+		opErr     *net.OpError
+	)
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		return PhaseInterrupted
+	case errors.As(err, &statusErr):
+		return PhaseHTTP
+	case errors.As(err, &bodyErr):
+		return PhaseBody
+	case errors.As(err, &dnsErr):
+		return PhaseDNS
+	case isTLSError(err):
+		return PhaseTLS
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return PhaseConnect
+	}
+	return PhaseOther
+}
+
+// formatFailures lists the number of failures of each phase, e.g. "dns: 2, http: 1".
+func formatFailures(failures map[Phase]int) string {
+	phases := make([]string, 0, len(failures))
+	for phase, n := range failures {
+		phases = append(phases, fmt.Sprintf("%s: %d", phase, n))
+	}
+	sort.Strings(phases)
+	return strings.Join(phases, ", ")
+}
+
+// isTLSError reports whether err comes from the TLS handshake or the
+// verification of the server's certificate.
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		opErr        *net.OpError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return true
+	}
+	// Alerts sent by the server during the handshake.
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return true
+	}
+	// net/http doesn't export the error of a handshake that timed out.
+	return strings.Contains(err.Error(), "TLS handshake")
+}
+
+// bodyReadError marks a failure to read a response body, as opposed to one
+// to write the data where it goes.
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string { return e.err.Error() }
+func (e *bodyReadError) Unwrap() error { return e.err }
+
+// failureReader tags the errors of reading a response body as bodyReadError.
+type failureReader struct {
+	r io.Reader
+}
+
+func (f failureReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &bodyReadError{err}
+	}
+	return n, err
+}
@@ -0,0 +1,124 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Strategies for handling an output file that already exists.
+const (
+	CollisionNumber    = "number"    // Save as file.1, file.2, ... (default)
+	CollisionOverwrite = "overwrite" // Replace the existing file
+	CollisionSkip      = "skip"      // Keep the existing file and skip the download (-nc)
+)
+
+// fileNameFromURL derives a local file name from the path of a URL, ignoring
+// its query string and fragment. It falls back to index.html when the URL
+// has no usable path component.
+func fileNameFromURL(fileURL string) string {
+	parsedURL, err := url.Parse(fileURL)
+	if err != nil {
+		return "index.html"
+	}
+
+	name := path.Base(parsedURL.Path)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+
+	if name = sanitizeFileName(name); name == "" {
+		return "index.html"
+	}
+	return name
+}
+
+// fileNameFromContentDisposition extracts the file name suggested by a
+// Content-Disposition header, returning an empty string when none is given.
+// Both the plain filename and the RFC 5987 filename* parameters are supported.
+func fileNameFromContentDisposition(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+
+	return sanitizeFileName(params["filename"])
+}
+
+// sanitizeFileName strips any directory components and path traversal
+// sequences from a server or URL supplied name so the file can never be
+// written outside the output directory.
+func sanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(strings.TrimSpace(name))
+
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// createOutputFile creates the .part file a download is written to, applying
+// the collision strategy when filePath already exists. It returns the path
+// the file is renamed to once complete, or a nil file when the download
+// should be skipped. Each output file has a single .part file, the one -c
+// looks for: a part left by an interrupted run is replaced, while one a
+// download in progress is writing to counts as a collision. The .part file
+// is created in tempDir when it is set. The caller releases it with
+// releasePart once done.
+func createOutputFile(filePath, strategy, tempDir string) (*os.File, string, error) {
+	switch strategy {
+	case CollisionOverwrite:
+		part := partPath(filePath, tempDir)
+		if !claimPart(part) {
+			return nil, filePath, fmt.Errorf("%s is already being downloaded", filePath)
+		}
+		file, err := createPartFile(part)
+		return file, filePath, err
+	case CollisionSkip:
+		part := partPath(filePath, tempDir)
+		if _, err := os.Stat(filePath); err == nil || !claimPart(part) {
+			return nil, filePath, nil
+		}
+		file, err := createPartFile(part)
+		return file, filePath, err
+	case CollisionNumber, "":
+		candidate := filePath
+		for i := 1; ; i++ {
+			if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+				if part := partPath(candidate, tempDir); claimPart(part) {
+					file, err := createPartFile(part)
+					return file, candidate, err
+				}
+			}
+			candidate = fmt.Sprintf("%s.%d", filePath, i)
+		}
+	default:
+		return nil, filePath, fmt.Errorf("unknown collision strategy %q", strategy)
+	}
+}
+
+// createPartFile creates a claimed part file, replacing one an interrupted
+// run left behind. The claim is dropped when it can't be created.
+func createPartFile(part string) (*os.File, error) {
+	file, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		releasePart(part)
+	}
+	return file, err
+}
@@ -0,0 +1,26 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// runHook runs the post-download command through the shell once a file has
+// been saved. The command finds the file and its URL in the WGET_FILE and
+// WGET_URL environment variables. The command is killed when ctx ends, and
+// its output is written to out along with the download messages.
+func runHook(ctx context.Context, out io.Writer, command, filePath, fileURL string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), "WGET_FILE="+filePath, "WGET_URL="+fileURL)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	fmt.Fprintf(out, "running hook: %s\n", command)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q failed: %v", command, err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package download
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wget/utils"
+)
+
+// Entry is one download of an input file, with the options that differ
+// from the rest of the batch. Unset fields keep the batch's options.
+type Entry struct {
+	URL        string   `json:"url"`
+	OutputFile string   `json:"output,omitempty"`     // Name to save the file under
+	OutputDir  string   `json:"dir,omitempty"`        // Directory to save the file in, relative to the batch's (-P)
+	RateLimit  string   `json:"rate_limit,omitempty"` // Maximum download speed (e.g., 200k, 2M)
+	Headers    []string `json:"headers,omitempty"`    // Request headers added to the batch's
+	Checksum   string   `json:"checksum,omitempty"`   // Expected digests as comma separated "algorithm:hex"
+	Sources    []string `json:"sources,omitempty"`    // Other URLs of the same file, fetched in segments at the same time
+}
+
+// apply returns the options of the batch with those of the entry applied.
+func (e Entry) apply(opts Options) Options {
+	if e.OutputFile != "" {
+		opts.OutputFile = e.OutputFile
+	}
+	if e.OutputDir != "" {
+		if filepath.IsAbs(e.OutputDir) {
+			opts.OutputDir = e.OutputDir
+		} else {
+			opts.OutputDir = filepath.Join(opts.OutputDir, e.OutputDir)
+		}
+	}
+	if e.RateLimit != "" {
+		opts.RateLimit = e.RateLimit
+	}
+	if len(e.Headers) > 0 {
+		opts.Headers = append(append([]string(nil), opts.Headers...), e.Headers...)
+	}
+	if e.Checksum != "" {
+		opts.Checksum = e.Checksum
+	}
+	if len(e.Sources) > 0 {
+		opts.Sources = e.Sources
+	}
+	return opts
+}
+
+// validate checks the URL and options of the entry, so mistakes are
+// reported before the batch starts.
+func (e Entry) validate() error {
+	parsedURL, err := url.Parse(e.URL)
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid URL %q", e.URL)
+	}
+	if e.RateLimit != "" {
+		if _, err := utils.ParseRateLimit(e.RateLimit); err != nil {
+			return fmt.Errorf("invalid rate limit %q: %v", e.RateLimit, err)
+		}
+	}
+	if e.Checksum != "" {
+		for _, spec := range strings.Split(e.Checksum, ",") {
+			if _, err := newDigest(spec); err != nil {
+				return err
+			}
+		}
+	}
+	for _, header := range e.Headers {
+		if name, _, ok := strings.Cut(header, ":"); !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid header %q, expected \"Name: value\"", header)
+		}
+	}
+	for _, source := range e.Sources {
+		if parsedURL, err := url.Parse(source); err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+			return fmt.Errorf("invalid source URL %q", source)
+		}
+	}
+	return nil
+}
+
+// EntriesForURLs returns entries downloading urls with the options of the batch.
+func EntriesForURLs(urls []string) []Entry {
+	entries := make([]Entry, len(urls))
+	for i, u := range urls {
+		entries[i] = Entry{URL: u}
+	}
+	return entries
+}
+
+// withoutTracking strips the tracking parameters from the URLs of a batch
+// (--strip-tracking), leaving out the entries that turn out to be the same
+// URL as an earlier one.
+func withoutTracking(entries []Entry, opts Options) []Entry {
+	seen := make(map[string]bool)
+	unique := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		entry.URL = utils.StripTracking(entry.URL)
+		if seen[entry.URL] {
+			opts.logf("Skipping %s, already listed without tracking parameters\n", entry.URL)
+			continue
+		}
+		seen[entry.URL] = true
+		unique = append(unique, entry)
+	}
+	return unique
+}
+
+// ReadEntriesFromFile reads the downloads listed in an input file ("-" for
+// standard input). Besides one URL per line, the file may be a JSON array
+// of objects with the fields of Entry, CSV with a header row naming the
+// columns: url, output, dir, rate_limit, checksum, header and source (the
+// last two may be repeated, one request header or other URL per column),
+// or a Metalink document.
+func ReadEntriesFromFile(filename string) ([]Entry, error) {
+	var data []byte
+	var err error
+	name := "file " + filename
+	if filename == "-" {
+		name = "standard input"
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, fmt.Errorf("failed to read standard input: %v", err)
+		}
+	} else if data, err = os.ReadFile(filename); err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %v", filename, err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+
+	var entries []Entry
+	switch {
+	case isMetalinkInput(data):
+		entries, err = parseMetalinkEntries(data, name)
+	case isJSONInput(data):
+		entries, err = parseJSONEntries(data, name)
+	case isCSVInput(data):
+		entries, err = parseCSVEntries(data, name)
+	default:
+		var urls []string
+		if urls, err = readURLs(bytes.NewReader(data), name); err == nil {
+			entries = EntriesForURLs(urls)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no valid URLs found in %s", name)
+	}
+	return entries, nil
+}
+
+// isJSONInput reports whether an input file holds a JSON array.
+func isJSONInput(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+}
+
+// isCSVInput reports whether an input file starts with a CSV header row
+// that has a url column, rather than with a URL.
+func isCSVInput(data []byte) bool {
+	line, _, _ := bytes.Cut(bytes.TrimSpace(data), []byte("\n"))
+	if bytes.Contains(line, []byte("://")) {
+		return false
+	}
+	for _, column := range strings.Split(string(line), ",") {
+		if strings.EqualFold(strings.Trim(strings.TrimSpace(column), `"`), "url") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJSONEntries parses an input file holding a JSON array of entries.
+func parseJSONEntries(data []byte, name string) ([]Entry, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var entries []Entry
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %v", name, err)
+	}
+	for i, entry := range entries {
+		if err := entry.validate(); err != nil {
+			return nil, fmt.Errorf("%s, entry %d: %v", name, i+1, err)
+		}
+	}
+	return entries, nil
+}
+
+// parseCSVEntries parses an input file in CSV format with a header row.
+func parseCSVEntries(data []byte, name string) ([]Entry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV in %s: %v", name, err)
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		switch header[i] {
+		case "url", "output", "dir", "rate_limit", "checksum", "header", "source":
+		default:
+			return nil, fmt.Errorf("unknown column %q in %s, expected url, output, dir, rate_limit, checksum, header or source", column, name)
+		}
+	}
+
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV in %s: %v", name, err)
+		}
+
+		var entry Entry
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "url":
+				entry.URL = value
+			case "output":
+				entry.OutputFile = value
+			case "dir":
+				entry.OutputDir = value
+			case "rate_limit":
+				entry.RateLimit = value
+			case "checksum":
+				entry.Checksum = value
+			case "header":
+				if value != "" {
+					entry.Headers = append(entry.Headers, value)
+				}
+			case "source":
+				if value != "" {
+					entry.Sources = append(entry.Sources, value)
+				}
+			}
+		}
+		if err := entry.validate(); err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("%s, line %d: %v", name, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,214 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DownloadListing downloads every file found in an autoindex-style directory
+// listing (as generated by Apache or nginx) and recurses into its
+// subdirectories, recreating the directory tree below opts.OutputDir.
+// Links pointing above the starting directory are never followed.
+func DownloadListing(listingURL string, opts Options) error {
+	return DownloadListingContext(context.Background(), listingURL, opts)
+}
+
+// DownloadListingContext works like DownloadListing, stopping when ctx is
+// cancelled (see DownloadFileContext).
+func DownloadListingContext(ctx context.Context, listingURL string, opts Options) error {
+	rootURL, err := url.Parse(listingURL)
+	if err != nil {
+		return fmt.Errorf("invalid listing URL %s: %v", listingURL, err)
+	}
+	if !strings.HasSuffix(rootURL.Path, "/") {
+		rootURL.Path += "/"
+	}
+
+	visited := make(map[string]bool)
+	return downloadListingDir(ctx, rootURL, rootURL, opts, visited)
+}
+
+// downloadListingDir fetches a single listing page, downloads the files it
+// lists and recurses into the listed subdirectories.
+func downloadListingDir(ctx context.Context, rootURL, dirURL *url.URL, opts Options, visited map[string]bool) error {
+	if visited[dirURL.String()] {
+		return nil
+	}
+	visited[dirURL.String()] = true
+
+	body, err := fetchListing(ctx, opts.httpClient(), dirURL.String())
+	if err != nil {
+		if ctx.Err() != nil {
+			return interrupted(ctx)
+		}
+		return err
+	}
+
+	if !isDirectoryListing(body) {
+		return fmt.Errorf("%s does not look like a directory listing", dirURL)
+	}
+
+	entries, err := parseListingEntries(dirURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to parse listing %s: %v", dirURL, err)
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return interrupted(ctx)
+		}
+
+		// -np semantics: only follow entries below the starting directory.
+		if entry.Host != rootURL.Host || !strings.HasPrefix(entry.Path, rootURL.Path) {
+			continue
+		}
+
+		// entry.Path is already unescaped: an escaped "%2e%2e" is a ".." segment
+		// by now, and must not take the files out of the output directory.
+		relPath := strings.TrimPrefix(entry.Path, rootURL.Path)
+		if relPath == "" || !isLocalPath(relPath) {
+			continue
+		}
+
+		if strings.HasSuffix(entry.Path, "/") {
+			if err := downloadListingDir(ctx, rootURL, entry, opts, visited); errors.Is(err, ErrInterrupted) {
+				return err
+			} else if err != nil {
+				opts.logf("Error reading listing %s: %v\n", entry, err)
+			}
+			continue
+		}
+
+		// Listed files are fetched with GET, as the listing itself is.
+		fileOpts := opts
+		fileOpts.Method, fileOpts.PostData, fileOpts.BodyFile = "", "", ""
+		fileOpts.OutputFile = path.Base(relPath)
+		fileOpts.OutputDir = filepath.Join(opts.OutputDir, filepath.FromSlash(path.Dir(relPath)))
+		if rel, err := filepath.Rel(opts.OutputDir, filepath.Join(fileOpts.OutputDir, fileOpts.OutputFile)); err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		if err := DownloadFileContext(ctx, entry.String(), fileOpts); errors.Is(err, ErrInterrupted) {
+			return err
+		} else if err != nil {
+			opts.logf("Error downloading %s: %v\n", entry, err)
+		}
+	}
+
+	return nil
+}
+
+// isLocalPath reports whether a slash-separated path relative to the
+// listing stays below it, without ".." segments or a rooted path.
+func isLocalPath(relPath string) bool {
+	if strings.HasPrefix(relPath, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(relPath, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchListing retrieves the raw HTML of a directory listing page.
+func fetchListing(ctx context.Context, client *http.Client, listingURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listingURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); !strings.Contains(contentType, "text/html") {
+		return nil, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// isDirectoryListing reports whether an HTML page looks like an
+// autoindex-style listing, based on the "Index of" title both Apache and
+// nginx emit (or the "Directory listing for" title of simple file servers).
+func isDirectoryListing(body []byte) bool {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var title string
+	var findTitle func(*html.Node)
+	findTitle = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "title" || n.Data == "h1") && n.FirstChild != nil && title == "" {
+			title = strings.TrimSpace(n.FirstChild.Data)
+		}
+		for c := n.FirstChild; c != nil && title == ""; c = c.NextSibling {
+			findTitle(c)
+		}
+	}
+	findTitle(doc)
+
+	return strings.HasPrefix(title, "Index of ") || strings.HasPrefix(title, "Directory listing for ")
+}
+
+// parseListingEntries collects the absolute URLs of all entries in a listing,
+// skipping parent directory links and the column sorting links Apache adds.
+func parseListingEntries(base *url.URL, body []byte) ([]*url.URL, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*url.URL
+	seen := make(map[string]bool)
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, attr := range n.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				href := strings.TrimSpace(attr.Val)
+				if href == "" || strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") || href == "../" {
+					continue
+				}
+				ref, err := url.Parse(href)
+				if err != nil {
+					continue
+				}
+				abs := base.ResolveReference(ref)
+				abs.RawQuery = ""
+				abs.Fragment = ""
+				if abs.Path == base.Path || seen[abs.String()] {
+					continue
+				}
+				seen[abs.String()] = true
+				entries = append(entries, abs)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return entries, nil
+}
@@ -0,0 +1,106 @@
+package download
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metalinkHashes maps the hash types of Metalink files to checksum algorithms.
+var metalinkHashes = map[string]string{
+	"sha-256": "sha256",
+	"sha-1":   "sha1",
+	"md5":     "md5",
+}
+
+// metalink is a Metalink 4 document (RFC 5854), listing files along with
+// their sizes, hashes and the URLs of the mirrors serving them.
+type metalink struct {
+	XMLName xml.Name       `xml:"metalink"`
+	Files   []metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name   string `xml:"name,attr"`
+	Hashes []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"hash"`
+	URLs []struct {
+		Priority string `xml:"priority,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"url"`
+}
+
+// isMetalinkInput reports whether an input file is a Metalink document.
+func isMetalinkInput(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("<?xml")) {
+		_, data, _ = bytes.Cut(data, []byte("?>"))
+		data = bytes.TrimSpace(data)
+	}
+	return bytes.HasPrefix(data, []byte("<metalink"))
+}
+
+// parseMetalinkEntries turns the files of a Metalink document into entries
+// downloading each file from its mirrors in segments, in order of priority,
+// and checking it against the strongest hash listed.
+func parseMetalinkEntries(data []byte, name string) ([]Entry, error) {
+	var doc metalink
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid Metalink in %s: %v", name, err)
+	}
+
+	var entries []Entry
+	for _, file := range doc.Files {
+		// Names with directories could write outside the output directory.
+		fileName := filepath.Base(filepath.FromSlash(file.Name))
+		if file.Name == "" || fileName == "." || fileName == ".." || fileName != file.Name {
+			return nil, fmt.Errorf("%s: invalid file name %q", name, file.Name)
+		}
+
+		urls := file.URLs
+		sort.SliceStable(urls, func(i, j int) bool {
+			return metalinkPriority(urls[i].Priority) < metalinkPriority(urls[j].Priority)
+		})
+		var sources []string
+		for _, u := range urls {
+			value := strings.TrimSpace(u.Value)
+			if parsed, err := url.Parse(value); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+				sources = append(sources, value)
+			}
+		}
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("%s: no HTTP URLs for %s", name, file.Name)
+		}
+
+		entry := Entry{URL: sources[0], OutputFile: fileName, Sources: sources[1:]}
+		for _, algorithm := range []string{"sha-256", "sha-1", "md5"} {
+			for _, hash := range file.Hashes {
+				if entry.Checksum == "" && strings.EqualFold(hash.Type, algorithm) {
+					entry.Checksum = metalinkHashes[algorithm] + ":" + strings.TrimSpace(hash.Value)
+				}
+			}
+		}
+		if err := entry.validate(); err != nil {
+			return nil, fmt.Errorf("%s, file %s: %v", name, file.Name, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// metalinkPriority returns the priority of a URL, 1 being the highest. URLs
+// without one come last.
+func metalinkPriority(value string) int {
+	priority, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || priority < 1 {
+		return 999999
+	}
+	return priority
+}
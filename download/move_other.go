@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package download
+
+// isCrossDevice reports whether a rename failed because source and target
+// are on different file systems, which this platform doesn't tell apart.
+func isCrossDevice(err error) bool {
+	return false
+}
+
+// dirSyncUnsupported reports whether syncing a directory failed because the
+// file system doesn't support it, which this platform doesn't tell apart.
+func dirSyncUnsupported(err error) bool {
+	return true
+}
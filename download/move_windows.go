@@ -0,0 +1,25 @@
+//go:build windows
+
+package download
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when moving a file to
+// another volume.
+const errNotSameDevice = syscall.Errno(17)
+
+// isCrossDevice reports whether a rename failed because source and target
+// are on different volumes.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errNotSameDevice)
+}
+
+// dirSyncUnsupported reports whether syncing a directory failed because the
+// file system doesn't support it. Directory handles can't be flushed on
+// Windows, where NTFS journals the rename instead.
+func dirSyncUnsupported(err error) bool {
+	return true
+}
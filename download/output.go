@@ -0,0 +1,164 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// OutputManager shares the terminal between concurrent downloads. Each file
+// in progress gets its own line in a block at the bottom of the output, and
+// messages are printed above that block, so the progress of parallel
+// transfers doesn't interleave. A finished transfer leaves the block, its
+// last line printed once above it. The block never grows taller than the
+// terminal: the transfers that don't fit are summed up on its last line.
+//
+// The cursor always rests on the line below the progress block. Updates only
+// rewrite the progress lines that changed, leaving the scrollback alone.
+type OutputManager struct {
+	mu         sync.Mutex
+	live       []*progressLine // Lines of the transfers in progress, in the order they started
+	shown      []string        // Lines of the block as currently displayed
+	lastUpdate time.Time
+}
+
+// progressLine is the progress line of a transfer.
+type progressLine struct {
+	text string
+}
+
+// NewOutputManager creates an output manager with no progress lines.
+func NewOutputManager() *OutputManager {
+	return &OutputManager{}
+}
+
+// Printf prints a message above the progress lines.
+func (m *OutputManager) Printf(format string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.printAbove(strings.Split(fmt.Sprintf(format, args...), "\n"))
+}
+
+// addLine adds a progress line to the block.
+func (m *OutputManager) addLine(text string) *progressLine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	line := &progressLine{text: text}
+	m.live = append(m.live, line)
+	m.updateDisplay()
+	return line
+}
+
+// setLine replaces a progress line. The display is updated at most five times
+// a second unless force is set.
+func (m *OutputManager) setLine(line *progressLine, text string, force bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	line.text = text
+	if force || time.Since(m.lastUpdate) >= time.Second/5 {
+		m.updateDisplay()
+	}
+}
+
+// finishLine takes a progress line out of the block, printing its final
+// text above it.
+func (m *OutputManager) finishLine(line *progressLine, text string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, l := range m.live {
+		if l == line {
+			m.live = append(m.live[:i], m.live[i+1:]...)
+			break
+		}
+	}
+	m.printAbove([]string{text})
+}
+
+// printAbove erases the block, prints lines in its place and draws the
+// block again below them. The caller must hold m.mu.
+func (m *OutputManager) printAbove(lines []string) {
+	var b strings.Builder
+	m.clearBlock(&b)
+	for _, line := range lines {
+		if line != "" {
+			b.WriteString(line + "\n")
+		}
+	}
+	m.shown = nil
+	m.render(&b)
+	fmt.Print(b.String())
+}
+
+// updateDisplay brings the displayed progress block up to date. The caller must hold m.mu.
+func (m *OutputManager) updateDisplay() {
+	var b strings.Builder
+	m.render(&b)
+	if b.Len() > 0 {
+		fmt.Print(b.String())
+	}
+}
+
+// block returns the lines of the progress block: one per transfer, or as
+// many as fit on the terminal with a last one counting the others. The
+// caller must hold m.mu.
+func (m *OutputManager) block() []string {
+	lines := make([]string, 0, len(m.live))
+	fit := maxBlockHeight()
+	for i, line := range m.live {
+		if len(m.live) > fit && i == fit-1 {
+			lines = append(lines, fmt.Sprintf("... and %d more transfers", len(m.live)-i))
+			break
+		}
+		lines = append(lines, line.text)
+	}
+	return lines
+}
+
+// maxBlockHeight returns the number of lines the progress block may take,
+// leaving the line the cursor rests on.
+func maxBlockHeight() int {
+	if _, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		return max(height-1, 1)
+	}
+	return 23 // The height of a default terminal, less the cursor line
+}
+
+// render writes the escape sequences rewriting the progress lines that
+// changed since they were last shown, then appends the new ones. A block
+// that got shorter is drawn again from its top. The caller must hold m.mu.
+func (m *OutputManager) render(b *strings.Builder) {
+	m.lastUpdate = time.Now()
+
+	lines := m.block()
+	if len(lines) < len(m.shown) {
+		m.clearBlock(b)
+		m.shown = nil
+	}
+	for i, line := range m.shown {
+		if line == lines[i] {
+			continue
+		}
+		// Save the cursor, go up to the changed line, rewrite it and come back.
+		fmt.Fprintf(b, "\0337\033[%dA\r\033[K%s\0338", len(m.shown)-i, lines[i])
+		m.shown[i] = lines[i]
+	}
+	for _, line := range lines[len(m.shown):] {
+		b.WriteString(line + "\n")
+		m.shown = append(m.shown, line)
+	}
+}
+
+// clearBlock writes the escape sequences erasing the progress block, leaving
+// the cursor where its first line was. The caller must hold m.mu.
+func (m *OutputManager) clearBlock(b *strings.Builder) {
+	if len(m.shown) > 0 {
+		fmt.Fprintf(b, "\033[%dA\r\033[J", len(m.shown))
+	}
+}
@@ -10,6 +10,13 @@ import (
 	"golang.org/x/term"
 )
 
+// Progress display modes.
+const (
+	ProgressBar  = "bar"  // Progress bar redrawn in place
+	ProgressDot  = "dot"  // Plain status line printed every few seconds, for logs
+	ProgressNone = "none" // No progress output
+)
+
 // ProgressWriter is a custom writer that tracks the progress of the download
 // by updating download statistics like progress percentage, speed, and remaining time.
 type ProgressWriter struct {
@@ -19,6 +26,17 @@ type ProgressWriter struct {
 	lastPrinted time.Time
 	startTime   time.Time
 	lastWidth   int // Store the last known terminal width
+
+	// Reports the bytes received when they differ from the bytes written,
+	// as with compressed bodies whose Content-Length is the encoded size.
+	received func() int64
+
+	// Set when the progress is shown on a line of an output manager.
+	manager *OutputManager
+	line    *progressLine
+	name    string
+
+	plain bool // Print status lines instead of drawing a bar (dot mode)
 }
 
 // NewProgressWriter creates a new ProgressWriter instance that tracks download progress.
@@ -51,12 +69,109 @@ func (p *ProgressWriter) Write(data []byte) (int, error) {
 		return n, err
 	}
 
+	if p.received != nil {
+		// Data received at once can take several writes to decode,
+		// the completed transfer is reported by finish.
+		if received := p.received(); received < p.total || p.total <= 0 {
+			p.downloaded = received
+			p.report(false)
+		}
+		return n, nil
+	}
+
 	p.downloaded += int64(n)
-	p.printProgress()
+	p.report(false)
 
 	return n, nil
 }
 
+// finish reports the completed transfer of a body counted with received, or
+// of a body shown by an output manager, whose line then leaves the progress
+// block.
+func (p *ProgressWriter) finish() {
+	if p.received != nil {
+		p.downloaded = p.received()
+	}
+	if p.manager != nil {
+		p.manager.finishLine(p.line, p.statusLine())
+	} else if p.received != nil || p.plain {
+		p.report(true)
+	}
+}
+
+// report shows the current progress, on the writer's line of the output
+// manager if there is one.
+func (p *ProgressWriter) report(force bool) {
+	if p.manager != nil {
+		p.manager.setLine(p.line, p.statusLine(), force)
+		return
+	}
+	if p.plain {
+		// Without cursor control every update is a new line, so print them sparingly.
+		if force || time.Since(p.lastPrinted) >= 5*time.Second {
+			p.lastPrinted = time.Now()
+			fmt.Println(p.statusLine())
+		}
+		return
+	}
+	p.printProgress()
+}
+
+// newProgressWriter creates a ProgressWriter showing the progress of name on
+// a line of its own.
+func (m *OutputManager) newProgressWriter(writer io.Writer, name string, total int64) *ProgressWriter {
+	p := NewProgressWriter(writer, total)
+	p.manager = m
+	p.name = name
+	p.line = m.addLine(p.statusLine())
+	return p
+}
+
+// statusLine formats the progress as a single line for the output manager.
+func (p *ProgressWriter) statusLine() string {
+	const nameWidth, barWidth = 24, 20
+
+	name := p.name
+	if len(name) > nameWidth {
+		name = "..." + name[len(name)-nameWidth+3:]
+	}
+
+	elapsed := time.Since(p.startTime).Seconds()
+	speed := float64(p.downloaded) / (1024 * 1024 * elapsed) // MiB/s
+	downloadedKiB := float64(p.downloaded) / 1024
+
+	if p.total <= 0 {
+		return fmt.Sprintf("%-*s %10.2f KiB %.2f MiB/s", nameWidth, name, downloadedKiB, speed)
+	}
+
+	fraction := float64(p.downloaded) / float64(p.total)
+	if fraction > 1 {
+		fraction = 1
+	}
+	completed := int(fraction * barWidth)
+	bar := strings.Repeat("=", completed) + strings.Repeat(" ", barWidth-completed)
+
+	remainingTime := "??s"
+	if p.downloaded > 0 {
+		remainingTime = formatRemaining(float64(p.total-p.downloaded) * elapsed / float64(p.downloaded))
+	}
+
+	return fmt.Sprintf("%-*s %10.2f KiB / %.2f KiB [%s] %6.2f%% %.2f MiB/s %s",
+		nameWidth, name, downloadedKiB, float64(p.total)/1024, bar, fraction*100, speed, remainingTime)
+}
+
+// formatRemaining formats an estimated remaining time in seconds.
+func formatRemaining(remainingSeconds float64) string {
+	if remainingSeconds < 1 {
+		return "0s"
+	} else if remainingSeconds < 60 {
+		return fmt.Sprintf("%.1fs", remainingSeconds)
+	} else if remainingSeconds < 3600 {
+		return fmt.Sprintf("%.1fm", remainingSeconds/60)
+	}
+	return fmt.Sprintf("%.1fh", remainingSeconds/3600)
+}
+
 // printProgress prints the progress of the download to the console.
 // It displays the downloaded data, total size, progress bar, download speed, and estimated remaining time.
 func (p *ProgressWriter) printProgress() {
@@ -136,16 +251,7 @@ func (p *ProgressWriter) printProgress() {
 		bytesRemaining := p.total - p.downloaded
 		timePerByte := elapsed / float64(p.downloaded)
 		remainingSeconds := float64(bytesRemaining) * timePerByte
-
-		if remainingSeconds < 1 {
-			remainingTime = "0s"
-		} else if remainingSeconds < 60 {
-			remainingTime = fmt.Sprintf("%.1fs", remainingSeconds)
-		} else if remainingSeconds < 3600 {
-			remainingTime = fmt.Sprintf("%.1fm", remainingSeconds/60)
-		} else {
-			remainingTime = fmt.Sprintf("%.1fh", remainingSeconds/3600)
-		}
+		remainingTime = formatRemaining(remainingSeconds)
 	} else {
 		remainingTime = "??s"
 	}
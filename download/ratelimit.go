@@ -27,4 +27,31 @@ func (r *RateLimitedWriter) Write(p []byte) (int, error) {
         time.Sleep(expectedTime - elapsed)
     }
     return n, nil
-}
\ No newline at end of file
+}
+
+// RateLimitedReader limits the speed data is read from a reader to
+// bandwidth bytes per second, as RateLimitedWriter does for writes.
+type RateLimitedReader struct {
+    reader    io.Reader
+    bandwidth int64
+}
+
+func NewRateLimitedReader(reader io.Reader, bandwidth int64) *RateLimitedReader {
+    return &RateLimitedReader{reader: reader, bandwidth: bandwidth}
+}
+
+func (r *RateLimitedReader) Read(p []byte) (int, error) {
+    // Reading no more than a second's worth at a time keeps the speed even.
+    if int64(len(p)) > r.bandwidth {
+        p = p[:r.bandwidth]
+    }
+    start := time.Now()
+    n, err := r.reader.Read(p)
+
+    elapsed := time.Since(start)
+    expectedTime := time.Duration(n) * time.Second / time.Duration(r.bandwidth)
+    if elapsed < expectedTime {
+        time.Sleep(expectedTime - elapsed)
+    }
+    return n, err
+}
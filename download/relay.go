@@ -0,0 +1,83 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"wget/httpclient"
+)
+
+// relayTarget returns the URL a file is uploaded to: the relay URL itself, or
+// the file name appended to it when the relay URL ends with a slash.
+func relayTarget(relayTo, fileName string) string {
+	if strings.HasSuffix(relayTo, "/") {
+		return relayTo + url.PathEscape(fileName)
+	}
+	return relayTo
+}
+
+// relayFile streams the response body to the relay target with a PUT
+// request while it is being downloaded, without writing it to disk. When the
+// size is known it is sent as Content-Length (as S3 presigned URLs require),
+// otherwise the upload uses chunked transfer encoding.
+func relayFile(ctx context.Context, fileURL, fileName string, resp *http.Response, opts Options, sum *checksum, result *DownloadResult) error {
+	target := relayTarget(opts.RelayTo, fileName)
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, pr)
+	if err != nil {
+		return fmt.Errorf("invalid relay URL %s: %v", target, err)
+	}
+	if _, compressed := resp.Body.(*httpclient.DecodedBody); !compressed && resp.ContentLength >= 0 {
+		req.ContentLength = resp.ContentLength
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	opts.logf("relaying file to: %s\n", target)
+
+	copyErr := make(chan error, 1)
+	go func() {
+		size, err := copyBody(pw, fileName, 0, resp, opts, sum)
+		pw.CloseWithError(err)
+		result.Size = size
+		copyErr <- err
+	}()
+
+	upload, err := opts.httpClient().Do(req)
+	// Unblocks the copy if the upload stopped reading early.
+	pr.Close()
+	downloadErr := <-copyErr
+	if ctx.Err() != nil {
+		return interrupted(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("relay to %s failed: %v", target, err)
+	}
+	defer upload.Body.Close()
+
+	if upload.StatusCode < 200 || upload.StatusCode > 299 {
+		return fmt.Errorf("relay to %s failed: status: %s", target, upload.Status)
+	}
+	if downloadErr != nil {
+		return downloadErr
+	}
+
+	// The data is already uploaded, so a mismatch can only be reported.
+	if sum != nil {
+		if err := sum.verify(); err != nil {
+			return err
+		}
+		opts.logf("\nchecksum verified (%s)\n", sum.algorithms())
+	}
+
+	opts.logf("\nRelayed [%s] to [%s], status %s\n", fileURL, target, upload.Status)
+	opts.logf("finished at %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	return nil
+}
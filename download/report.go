@@ -0,0 +1,159 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reportEntry is the outcome of one URL in the report file.
+type reportEntry struct {
+	URL        string `json:"url"`
+	File       string `json:"file,omitempty"`   // Where the file was saved, or its .part file when interrupted
+	Size       int64  `json:"size,omitempty"`   // Bytes saved, or reported by the server in spider mode
+	StatusCode int    `json:"status,omitempty"` // Status of the final response
+	Cache      string `json:"cache,omitempty"`  // Cache status of the response in warm mode, HIT or MISS
+	Error      string `json:"error,omitempty"`
+	Phase      Phase  `json:"phase,omitempty"` // Phase at which the URL failed
+}
+
+// batchReport collects the outcome of every URL of a batch, spider or warm run,
+// written as JSON to the report file (--report-file) when the run ends.
+type batchReport struct {
+	path string
+
+	mu      sync.Mutex
+	started time.Time
+	entries []reportEntry
+}
+
+// reportRecord is the on-disk format of the report file. Failures counts the
+// failed URLs by phase, to tell network trouble from server errors at a glance.
+type reportRecord struct {
+	Started   time.Time     `json:"started"`
+	Finished  time.Time     `json:"finished"`
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Failures  map[Phase]int `json:"failures,omitempty"`
+	Results   []reportEntry `json:"results"`
+}
+
+// newBatchReport returns a report written to path, or nil when path is empty.
+// The methods of a nil report do nothing.
+func newBatchReport(path string) *batchReport {
+	if path == "" {
+		return nil
+	}
+	return &batchReport{path: path, started: time.Now()}
+}
+
+// addDownload records the outcome of the download of a URL.
+func (r *batchReport) addDownload(url string, result *DownloadResult, err error) {
+	if r == nil {
+		return
+	}
+	entry := reportEntry{URL: url}
+	if result != nil {
+		entry.Size = result.Size
+		entry.StatusCode = result.StatusCode
+		switch {
+		case err == nil:
+			entry.File = result.FilePath
+		case result.PartialPath != "":
+			entry.File = result.PartialPath
+			entry.Size = result.PartialSize
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		entry.Phase = FailurePhase(err)
+	}
+	r.add(entry)
+}
+
+// addSpider records the outcome of checking a URL in spider mode.
+func (r *batchReport) addSpider(result SpiderResult) {
+	if r == nil {
+		return
+	}
+	entry := reportEntry{URL: result.URL, StatusCode: result.StatusCode, Phase: result.Failure}
+	if result.Size >= 0 {
+		entry.Size = result.Size
+	}
+	switch {
+	case result.Err != nil:
+		entry.Error = result.Err.Error()
+	case !result.OK():
+		entry.Error = "status: " + result.Status
+	}
+	r.add(entry)
+}
+
+// addWarm records the outcome of warming the caches with a URL.
+func (r *batchReport) addWarm(result WarmResult) {
+	if r == nil {
+		return
+	}
+	entry := reportEntry{URL: result.URL, Size: result.Size, StatusCode: result.StatusCode, Cache: result.Cache, Phase: result.Failure}
+	switch {
+	case result.Err != nil:
+		entry.Error = result.Err.Error()
+	case !result.OK():
+		entry.Error = "status: " + result.Status
+	}
+	r.add(entry)
+}
+
+// skip records a URL the run didn't get to, interrupted before it started.
+func (r *batchReport) skip(url string, err error) {
+	if r == nil {
+		return
+	}
+	r.add(reportEntry{URL: url, Error: err.Error(), Phase: FailurePhase(err)})
+}
+
+func (r *batchReport) add(entry reportEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// write saves the report.
+func (r *batchReport) write() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := reportRecord{
+		Started:  r.started,
+		Finished: time.Now(),
+		Total:    len(r.entries),
+		Failures: make(map[Phase]int),
+		Results:  r.entries,
+	}
+	for _, entry := range r.entries {
+		if entry.Error == "" {
+			rec.Succeeded++
+			continue
+		}
+		rec.Failed++
+		rec.Failures[entry.Phase]++
+	}
+	// Concurrent downloads finish in any order, list them by URL.
+	sort.SliceStable(rec.Results, func(i, j int) bool { return rec.Results[i].URL < rec.Results[j].URL })
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %v", r.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"wget/httpclient"
+)
+
+// newRequest builds the HTTP request for a download, applying the configured
+// method, request body and extra headers.
+func newRequest(ctx context.Context, fileURL string, opts Options) (*http.Request, error) {
+	if opts.BodyFile != "" && opts.PostData != "" {
+		return nil, fmt.Errorf("only one of --post-data and --body-file can be used")
+	}
+
+	var body io.Reader
+	switch {
+	case opts.BodyFile != "":
+		data, err := os.ReadFile(opts.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body file %s: %v", opts.BodyFile, err)
+		}
+		body = bytes.NewReader(data)
+	case opts.PostData != "":
+		body = strings.NewReader(opts.PostData)
+	}
+
+	// Like GNU wget, sending a body without an explicit method implies POST.
+	method := strings.ToUpper(opts.Method)
+	if method == "" {
+		method = http.MethodGet
+		if body != nil {
+			method = http.MethodPost
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fileURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	for _, header := range opts.Headers {
+		name, value, found := strings.Cut(header, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", header)
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	return req, nil
+}
+
+// sendRequest sends req, and sends it again after the delay the server asks
+// for when it answers 429 or 503, up to httpclient.MaxThrottleRetries times.
+// The last throttled response is returned for the caller to report.
+func sendRequest(ctx context.Context, req *http.Request, opts Options) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := opts.httpClient().Do(req)
+		if err != nil || !httpclient.Throttled(resp) || attempt == httpclient.MaxThrottleRetries {
+			return resp, err
+		}
+		delay := httpclient.RetryDelay(resp, attempt)
+		resp.Body.Close()
+		opts.logf("server busy (%s), retrying %s in %s\n", resp.Status, req.URL, delay)
+		if err := httpclient.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		retry := req.Clone(ctx)
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		req = retry
+	}
+}
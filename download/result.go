@@ -0,0 +1,46 @@
+package download
+
+import (
+	"net/http"
+)
+
+// Redirect describes one hop of a redirect chain.
+type Redirect struct {
+	URL        string   // URL that answered with the redirect
+	StatusCode int      // Redirect status, e.g. 301 or 302
+	Location   string   // URL the client was sent to
+	Cookies    []string // Names of the cookies set by the redirect response
+}
+
+// DownloadResult describes the outcome of a download.
+type DownloadResult struct {
+	URL        string     // URL the download was started with
+	FinalURL   string     // URL the data was served from, after redirects
+	StatusCode int        // Status of the final response
+	FilePath   string     // Where the file was saved, empty when it wasn't
+	Size       int64      // Number of bytes saved
+	Redirects  []Redirect // Redirects followed, in order
+
+	PartialPath string // .part file an interrupted download left for -c to resume, empty otherwise
+	PartialSize int64  // Bytes in PartialPath, where -c resumes
+
+	Failure Phase // Phase at which the download failed, empty when it succeeded
+}
+
+// redirectChain returns the redirects that led to resp, oldest first. The
+// client links each redirected request to the response that caused it.
+func redirectChain(resp *http.Response) []Redirect {
+	var chain []Redirect
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		hop := Redirect{
+			URL:        req.Response.Request.URL.String(),
+			StatusCode: req.Response.StatusCode,
+			Location:   req.URL.String(),
+		}
+		for _, cookie := range req.Response.Cookies() {
+			hop.Cookies = append(hop.Cookies, cookie.Name)
+		}
+		chain = append([]Redirect{hop}, chain...)
+	}
+	return chain
+}
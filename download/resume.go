@@ -0,0 +1,135 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The part files written to by the downloads in progress, so concurrent
+// downloads of the same output file never share one.
+var (
+	partsMu    sync.Mutex
+	partsInUse = make(map[string]bool)
+)
+
+// claimPart reserves a part file for a download, reporting false when
+// another download in progress holds it.
+func claimPart(part string) bool {
+	partsMu.Lock()
+	defer partsMu.Unlock()
+
+	part = filepath.Clean(part)
+	if partsInUse[part] {
+		return false
+	}
+	partsInUse[part] = true
+	return true
+}
+
+// releasePart gives up the claim on a part file.
+func releasePart(part string) {
+	partsMu.Lock()
+	defer partsMu.Unlock()
+	delete(partsInUse, filepath.Clean(part))
+}
+
+// contentRangeStart returns the first byte position of a Content-Range
+// header such as "bytes 100-199/200", or -1 when it can't be parsed.
+func contentRangeStart(contentRange string) int64 {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(contentRange), "bytes ")
+	if !ok {
+		return -1
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return -1
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// contentRangeSize returns the complete length of a Content-Range header
+// such as "bytes 100-199/200" or "bytes */200", or -1 when it is unknown.
+func contentRangeSize(contentRange string) int64 {
+	_, size, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// openForResume opens a partially downloaded file positioned at its end for
+// writing the rest of it. The part already on disk is fed to the checksum
+// first, so the digest covers the whole file. The file isn't opened in append
+// mode, so --sparse can still seek over zeros.
+func openForResume(filePath string, sum *checksum) (*os.File, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if sum != nil {
+		if _, err := io.Copy(sum, file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read %s: %v", filePath, err)
+		}
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// ErrInterrupted is returned when a download is stopped by cancelling its
+// context or by its deadline passing.
+var ErrInterrupted = errors.New("download interrupted")
+
+// interrupted returns the error for a download stopped by ctx. It wraps both
+// ErrInterrupted and the reason ctx ended, so callers can tell a
+// cancellation from context.DeadlineExceeded.
+func interrupted(ctx context.Context) error {
+	return fmt.Errorf("%w: %w", ErrInterrupted, context.Cause(ctx))
+}
+
+// partPath returns the name a download is written to until it is complete,
+// so an interrupted download is never mistaken for a complete file. With a
+// temporary directory (--temp-dir) the .part file is kept there, named after
+// a hash of the full output path so files of the same name in different
+// directories don't collide and -c finds it again.
+func partPath(filePath, tempDir string) string {
+	if tempDir == "" {
+		return filePath + ".part"
+	}
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		abs = filePath
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(tempDir, fmt.Sprintf("%s.%x.part", filepath.Base(filePath), sum[:4]))
+}
+
+// keepPartialFile flushes the .part file of an interrupted download, so -c
+// can pick it up later, and records it in result. size is the number of
+// bytes in the file.
+func keepPartialFile(ctx context.Context, file *os.File, size int64, result *DownloadResult) error {
+	file.Sync()
+	file.Close()
+	result.PartialPath = file.Name()
+	result.PartialSize = size
+	return fmt.Errorf("%w, partial file saved as %s (%d bytes)", interrupted(ctx), file.Name(), size)
+}
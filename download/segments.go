@@ -0,0 +1,342 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wget/utils"
+)
+
+const (
+	minSegmentSize    = 1 << 20 // Smallest range requested from a source
+	segmentsPerSource = 4       // Segments per source, so fast sources take over the work of slow ones
+	maxSourceFailures = 3       // Failed segments in a row after which a source is dropped
+)
+
+// segment is a byte range of the file, both ends included.
+type segment struct {
+	start, end int64
+}
+
+// downloadSegmented fetches a file available from several URLs (fileURL and
+// opts.Sources) in segments, each source serving a share of the ranges at
+// the same time, and reassembles it in the .part file. Sources that fail are
+// dropped and their segments fetched from the others. When fewer than two
+// sources support ranges, the file is downloaded normally.
+func downloadSegmented(ctx context.Context, fileURL string, opts Options, sum *checksum, result *DownloadResult) error {
+	sources, total, probe, err := probeSources(ctx, append([]string{fileURL}, opts.Sources...), opts)
+	if err != nil {
+		return err
+	}
+	if len(sources) < 2 || total <= 0 {
+		opts.logf("fewer than two sources serve byte ranges, downloading from one\n")
+		opts.Sources = nil
+		if len(sources) > 0 {
+			return downloadFile(ctx, sources[0], opts, result)
+		}
+		return downloadFile(ctx, fileURL, opts, result)
+	}
+
+	result.FinalURL = probe.Request.URL.String()
+	result.StatusCode = probe.StatusCode
+
+	fileName := opts.OutputFile
+	if fileName == "" {
+		fileName = fileNameFromURL(fileURL)
+	}
+	filePath := filepath.Join(opts.OutputDir, fileName)
+	if opts.Timestamping && utils.IsLocalCopyCurrent(filePath, probe) {
+		opts.logf("server file no newer than local file, not retrieving [%s]\n", fileURL)
+		return nil
+	}
+	if !opts.NewerThan.IsZero() {
+		if lastMod, err := http.ParseTime(probe.Header.Get("Last-Modified")); err == nil && !lastMod.After(opts.NewerThan) {
+			opts.logf("skipping %s: not modified since %s\n", fileURL, opts.NewerThan.Format("2006-01-02"))
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(opts.OutputDir, os.ModePerm); err != nil {
+		return err
+	}
+	if opts.TempDir != "" {
+		if err := os.MkdirAll(opts.TempDir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	file, filePath, err := createOutputFile(filePath, collisionStrategy(opts), opts.TempDir)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		opts.logf("file %s already exists, not retrieving\n", filePath)
+		return nil
+	}
+	part := file.Name()
+	defer releasePart(part)
+	defer file.Close()
+	if err := file.Truncate(total); err != nil {
+		return err
+	}
+	opts.logf("saving file to: %s\n", filePath)
+	opts.logf("content size: %d [~%.2fMB] from %d sources\n", total, float64(total)/(1024*1024), len(sources))
+	result.FilePath = filePath
+
+	// The segments are written in place as they arrive and their data is
+	// passed through a pipe to copyBody, which applies the quota and rate
+	// limit and shows the progress of the whole file.
+	pr, pw := io.Pipe()
+	stop := make(chan struct{})
+	var closeOnce sync.Once
+	finish := func(err error) {
+		closeOnce.Do(func() { pw.CloseWithError(err) })
+	}
+
+	segments := splitSegments(total, len(sources))
+	queue := make(chan segment, len(segments))
+	for _, s := range segments {
+		queue <- s
+	}
+	var remaining atomic.Int64
+	remaining.Store(int64(len(segments)))
+	var alive atomic.Int32
+	alive.Store(int32(len(sources)))
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			failures := 0
+			for {
+				var s segment
+				select {
+				case <-stop:
+					return
+				case s = <-queue:
+				}
+				n, err := fetchSegment(ctx, source, s, file, pw, opts)
+				if err == nil {
+					failures = 0
+					if remaining.Add(-1) == 0 {
+						finish(nil)
+					}
+					continue
+				}
+				// Put back what is left of the segment for any source to fetch.
+				queue <- segment{s.start + n, s.end}
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if ctx.Err() != nil {
+					finish(interrupted(ctx))
+					return
+				}
+				opts.logf("segment %d-%d from %s failed: %v\n", s.start+n, s.end, source, err)
+				if failures++; failures >= maxSourceFailures {
+					opts.logf("dropping source %s\n", source)
+					if alive.Add(-1) == 0 {
+						finish(errors.New("all sources failed"))
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	body := &http.Response{Body: pr, ContentLength: total, Header: probe.Header}
+	size, err := copyBody(io.Discard, filePath, 0, body, opts, nil)
+	pr.CloseWithError(io.ErrClosedPipe)
+	close(stop)
+	wg.Wait()
+	result.Size = size
+	if err != nil {
+		// Segments arrive out of order, so the part file can't be resumed.
+		file.Close()
+		os.Remove(part)
+		if ctx.Err() != nil {
+			return interrupted(ctx)
+		}
+		return err
+	}
+
+	// The data arrived out of order, so the checksum reads the complete file.
+	if sum != nil {
+		if err := hashFile(part, sum); err != nil {
+			return err
+		}
+		if err := sum.verify(); err != nil {
+			file.Close()
+			os.Remove(part)
+			return err
+		}
+		opts.logf("\nchecksum verified (%s)\n", sum.algorithms())
+	}
+
+	if opts.Fsync {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s: %v", part, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := moveFile(part, filePath); err != nil {
+		return err
+	}
+	if opts.Fsync {
+		if err := syncDir(filepath.Dir(filePath)); err != nil {
+			return err
+		}
+	}
+	if opts.Timestamping {
+		if err := utils.SetModTime(filePath, probe); err != nil {
+			return err
+		}
+	}
+
+	opts.logf("\nDownloaded [%s]\n", fileURL)
+	opts.logf("finished at %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	if opts.Exec != "" {
+		return runHook(ctx, opts.logOutput(), opts.Exec, filePath, fileURL)
+	}
+	return nil
+}
+
+// probeSources asks each URL for the first byte of the file, and returns
+// those that serve byte ranges of a file of the same size as the first one
+// that does, along with that size and the response of the first source.
+func probeSources(ctx context.Context, urls []string, opts Options) ([]string, int64, *http.Response, error) {
+	var sources []string
+	var total int64 = -1
+	var first *http.Response
+	for _, u := range urls {
+		req, err := newRequest(ctx, u, opts)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		req.Header.Set("Range", "bytes=0-0")
+		req.Header.Set("Accept-Encoding", "identity")
+		resp, err := sendRequest(ctx, req, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, nil, interrupted(ctx)
+			}
+			opts.logf("source %s unavailable: %v\n", u, err)
+			continue
+		}
+		resp.Body.Close()
+
+		size := contentRangeTotal(resp.Header.Get("Content-Range"))
+		switch {
+		case resp.StatusCode != http.StatusPartialContent || size <= 0:
+			opts.logf("source %s doesn't serve byte ranges (status %s)\n", u, resp.Status)
+		case total >= 0 && size != total:
+			opts.logf("source %s has a different file (%d bytes instead of %d)\n", u, size, total)
+		default:
+			if first == nil {
+				first, total = resp, size
+			}
+			sources = append(sources, u)
+		}
+	}
+	return sources, total, first, nil
+}
+
+// splitSegments divides a file of total bytes into segments for sources to
+// fetch, several per source but none below minSegmentSize.
+func splitSegments(total int64, sources int) []segment {
+	size := max(total/int64(sources*segmentsPerSource), minSegmentSize)
+	var segments []segment
+	for start := int64(0); start < total; start += size {
+		segments = append(segments, segment{start, min(start+size, total) - 1})
+	}
+	return segments
+}
+
+// fetchSegment requests a segment from a source, writes it to file in place
+// and passes the data on to pw. It returns the number of bytes of the
+// segment fetched, which is less than its size when it fails.
+func fetchSegment(ctx context.Context, source string, s segment, file *os.File, pw *io.PipeWriter, opts Options) (int64, error) {
+	req, err := newRequest(ctx, source, opts)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", s.start, s.end))
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := sendRequest(ctx, req, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if start := contentRangeStart(resp.Header.Get("Content-Range")); start != s.start {
+		return 0, fmt.Errorf("server sent byte %d instead of %d", start, s.start)
+	}
+
+	buf := make([]byte, 32*1024)
+	offset, end := s.start, s.end+1
+	for offset < end {
+		n, err := resp.Body.Read(buf[:min(int64(len(buf)), end-offset)])
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], offset); err != nil {
+				return offset - s.start, err
+			}
+			offset += int64(n)
+			if _, err := pw.Write(buf[:n]); err != nil {
+				return offset - s.start, err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return offset - s.start, err
+		}
+	}
+	if offset < end {
+		return offset - s.start, io.ErrUnexpectedEOF
+	}
+	return offset - s.start, nil
+}
+
+// hashFile feeds the contents of a file to the checksum.
+func hashFile(path string, sum *checksum) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(sum, file); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return nil
+}
+
+// contentRangeTotal returns the complete length of a Content-Range header
+// such as "bytes 0-0/200", or -1 when it is unknown.
+func contentRangeTotal(contentRange string) int64 {
+	_, length, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	total, err := strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
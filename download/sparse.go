@@ -0,0 +1,71 @@
+package download
+
+import (
+	"io"
+	"os"
+)
+
+// sparseBlock is the size of the runs checked for zeros. Runs shorter than a
+// filesystem block can't become holes, so they are always written.
+const sparseBlock = 4096
+
+// sparseWriter writes to a file, seeking over blocks of zeros instead of
+// writing them, so filesystems that support it leave holes in the file.
+type sparseWriter struct {
+	file *os.File
+	size int64 // Offset the data written so far ends at
+	hole bool  // Whether the data ends with a skipped run
+}
+
+// newSparseWriter returns a sparseWriter continuing at the current offset of file.
+func newSparseWriter(file *os.File) (*sparseWriter, error) {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return &sparseWriter{file: file, size: offset}, nil
+}
+
+// Write writes p block by block, skipping the blocks that are all zeros.
+func (s *sparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Blocks are aligned to the file offset, like the filesystem's own.
+		n := min(len(p), sparseBlock-int(s.size%sparseBlock))
+		block := p[:n]
+		if isZero(block) {
+			if _, err := s.file.Seek(int64(n), io.SeekCurrent); err != nil {
+				return written, err
+			}
+			s.hole = true
+		} else {
+			if _, err := s.file.Write(block); err != nil {
+				return written, err
+			}
+			s.hole = false
+		}
+		s.size += int64(n)
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// finish extends the file over a trailing run of zeros, which seeking alone
+// doesn't do.
+func (s *sparseWriter) finish() error {
+	if !s.hole {
+		return nil
+	}
+	return s.file.Truncate(s.size)
+}
+
+// isZero reports whether b only contains zero bytes.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
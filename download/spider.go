@@ -0,0 +1,134 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"wget/utils"
+)
+
+// SpiderResult describes the outcome of checking a single URL in spider mode.
+type SpiderResult struct {
+	URL         string
+	StatusCode  int
+	Status      string
+	Size        int64 // -1 when the server doesn't report a size
+	ContentType string
+	Err         error
+	Failure     Phase // Phase at which the check failed, empty when the URL is OK
+}
+
+// OK reports whether the URL resolved to a successful response.
+func (r SpiderResult) OK() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// SpiderURL checks that a URL resolves without downloading it. It issues a
+// HEAD request, falling back to a GET whose body is never read for servers
+// that don't support HEAD.
+func SpiderURL(fileURL string, opts Options) SpiderResult {
+	return SpiderURLContext(context.Background(), fileURL, opts)
+}
+
+// SpiderURLContext works like SpiderURL, giving up on the URL when ctx ends.
+func SpiderURLContext(ctx context.Context, fileURL string, opts Options) SpiderResult {
+	result := SpiderResult{URL: fileURL, Size: -1}
+
+	resp, err := spiderRequest(ctx, fileURL, http.MethodHead, opts)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = spiderRequest(ctx, fileURL, http.MethodGet, opts)
+	}
+	if err != nil {
+		result.Err = err
+		result.Failure = FailurePhase(err)
+		return result
+	}
+	// Closing without reading means a GET fallback never transfers the body.
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Status = resp.Status
+	result.Size = resp.ContentLength
+	result.ContentType = resp.Header.Get("Content-Type")
+	if !result.OK() {
+		result.Failure = PhaseHTTP
+	}
+	return result
+}
+
+func spiderRequest(ctx context.Context, fileURL, method string, opts Options) (*http.Response, error) {
+	opts.Method = method
+	opts.PostData = ""
+	opts.BodyFile = ""
+
+	req, err := newRequest(ctx, fileURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return sendRequest(ctx, req, opts)
+}
+
+// Spider checks every URL and prints its status, size and content type
+// without writing any files. It returns an error if any URL is broken.
+func Spider(urls []string, opts Options) error {
+	return SpiderContext(context.Background(), urls, opts)
+}
+
+// SpiderContext works like Spider, returning ErrInterrupted without checking
+// the remaining URLs when ctx ends.
+func SpiderContext(ctx context.Context, urls []string, opts Options) error {
+	broken := 0
+	failures := make(map[Phase]int) // Broken URLs by phase
+	report := newBatchReport(opts.ReportFile)
+	defer func() {
+		if err := report.write(); err != nil {
+			opts.logf("Warning: %v\n", err)
+		}
+	}()
+	for i, fileURL := range urls {
+		if ctx.Err() != nil {
+			opts.logf("\nInterrupted after checking %d of %d URLs, %d broken\n", i, len(urls), broken)
+			for _, skipped := range urls[i:] {
+				report.skip(skipped, interrupted(ctx))
+			}
+			return interrupted(ctx)
+		}
+		result := SpiderURLContext(ctx, fileURL, opts)
+		printSpiderResult(opts, result)
+		report.addSpider(result)
+		if !result.OK() {
+			broken++
+			failures[result.Failure]++
+		}
+	}
+
+	opts.logf("\nChecked %d URLs, %d broken\n", len(urls), broken)
+	if broken > 0 {
+		return fmt.Errorf("%d of %d URLs are broken (%s)", broken, len(urls), formatFailures(failures))
+	}
+	return nil
+}
+
+func printSpiderResult(opts Options, result SpiderResult) {
+	if result.Err != nil {
+		opts.logf("[BROKEN] %s: %s error: %v\n", result.URL, result.Failure, result.Err)
+		return
+	}
+
+	size := "unknown size"
+	if result.Size >= 0 {
+		size = utils.FormatBytes(result.Size)
+	}
+	contentType := result.ContentType
+	if contentType == "" {
+		contentType = "unknown type"
+	}
+
+	label := "[OK]"
+	if !result.OK() {
+		label = "[BROKEN]"
+	}
+	opts.logf("%s %s: %s, %s, %s\n", label, result.URL, result.Status, size, contentType)
+}
@@ -0,0 +1,163 @@
+package download
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// jobState is the recorded progress of one download of a batch.
+type jobState struct {
+	URL        string `json:"url"`
+	Path       string `json:"path,omitempty"` // Where the file is saved (in its .part file until done)
+	Downloaded int64  `json:"downloaded"`     // Bytes saved so far
+	ETag       string `json:"etag,omitempty"` // Identifies the version being downloaded, for resuming
+	Done       bool   `json:"done"`
+}
+
+// batchState records the progress of a batch of downloads in a state file,
+// so re-running the same batch after a crash or reboot skips the finished
+// files and resumes the partial ones.
+type batchState struct {
+	path      string
+	mu        sync.Mutex
+	jobs      map[string]*jobState
+	order     []string // URLs in the order they were added, for a stable file
+	lastSaved time.Time
+}
+
+// stateRecord is the on-disk format of the state file.
+type stateRecord struct {
+	Jobs []*jobState `json:"jobs"`
+}
+
+// loadBatchState reads the state file at path, treating a missing file as a
+// batch that hasn't started.
+func loadBatchState(path string) (*batchState, error) {
+	s := &batchState{path: path, jobs: make(map[string]*jobState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %v", path, err)
+	}
+
+	var rec stateRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("invalid state %s: %v", path, err)
+	}
+	for _, job := range rec.Jobs {
+		if _, ok := s.jobs[job.URL]; !ok {
+			s.order = append(s.order, job.URL)
+		}
+		s.jobs[job.URL] = job
+	}
+	return s, nil
+}
+
+// job returns a copy of the recorded state of a URL.
+func (s *batchState) job(url string) (jobState, bool) {
+	if s == nil {
+		return jobState{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[url]
+	if !ok {
+		return jobState{URL: url}, false
+	}
+	return *job, true
+}
+
+// etag returns the ETag of the version of a URL being downloaded.
+func (s *batchState) etag(url string) string {
+	job, _ := s.job(url)
+	return job.ETag
+}
+
+// begin records that the body of a URL is being saved to path.
+func (s *batchState) begin(url, path, etag string, offset int64) {
+	s.update(url, true, func(job *jobState) {
+		job.Path = path
+		job.ETag = etag
+		job.Downloaded = offset
+		job.Done = false
+	})
+}
+
+// progress records the number of bytes of a URL saved so far. The file is
+// rewritten at most once a second.
+func (s *batchState) progress(url string, downloaded int64) {
+	s.update(url, false, func(job *jobState) {
+		job.Downloaded = downloaded
+	})
+}
+
+// finish records the outcome of the download of a URL.
+func (s *batchState) finish(url string, result *DownloadResult, err error) {
+	s.update(url, true, func(job *jobState) {
+		if err == nil {
+			job.Done = true
+			if result.FilePath != "" {
+				job.Path = result.FilePath
+			}
+		}
+	})
+}
+
+// update applies change to the state of a URL and saves the state file,
+// unless it was saved less than a second ago and force isn't set.
+func (s *batchState) update(url string, force bool, change func(job *jobState)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[url]
+	if !ok {
+		job = &jobState{URL: url}
+		s.jobs[url] = job
+		s.order = append(s.order, url)
+	}
+	change(job)
+
+	if force || time.Since(s.lastSaved) >= time.Second {
+		s.save()
+	}
+}
+
+// save writes the state file through a temporary file, so a crash never
+// leaves a truncated state behind. Failing to save only loses the ability
+// to resume, so errors are ignored. The caller must hold s.mu.
+func (s *batchState) save() {
+	rec := stateRecord{Jobs: make([]*jobState, 0, len(s.order))}
+	for _, url := range s.order {
+		rec.Jobs = append(rec.Jobs, s.jobs[url])
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, s.path)
+	s.lastSaved = time.Now()
+}
+
+// remove deletes the state file once the batch is complete.
+func (s *batchState) remove() {
+	os.Remove(s.path)
+}
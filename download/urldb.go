@@ -0,0 +1,108 @@
+package download
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// urlDBEntry is a line of the URL database.
+type urlDBEntry struct {
+	URL        string    `json:"url"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	Downloaded time.Time `json:"downloaded"`
+}
+
+// urlDB is the database of the URLs saved by earlier runs (--url-db), so
+// batches with overlapping input files don't fetch a URL again. It holds
+// one JSON object per line, appended as files are saved, so runs never
+// rewrite it and a crash at worst truncates the last line. A URL only counts
+// as saved while its file is still there.
+type urlDB struct {
+	mu      sync.Mutex
+	entries map[string]urlDBEntry // By URL
+	file    *os.File
+}
+
+// openURLDB reads the URL database at path, creating it if it doesn't exist.
+func openURLDB(path string) (*urlDB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create URL database: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open URL database: %v", err)
+	}
+
+	db := &urlDB{entries: make(map[string]urlDBEntry), file: file}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry urlDBEntry
+		// Skip a line left incomplete by a crash.
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.URL != "" {
+			db.entries[entry.URL] = entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read URL database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// lookup returns the entry of a URL saved by an earlier run, if its file
+// is still there.
+func (db *urlDB) lookup(url string) (urlDBEntry, bool) {
+	if db == nil {
+		return urlDBEntry{}, false
+	}
+	db.mu.Lock()
+	entry, ok := db.entries[url]
+	db.mu.Unlock()
+	if !ok {
+		return urlDBEntry{}, false
+	}
+	if _, err := os.Stat(entry.Path); errors.Is(err, os.ErrNotExist) {
+		return urlDBEntry{}, false
+	}
+	return entry, true
+}
+
+// add records a URL saved to a file. Failing to record it only means a
+// later run fetches it again, so errors are ignored.
+func (db *urlDB) add(url string, result *DownloadResult) {
+	if db == nil || result == nil || result.FilePath == "" {
+		return
+	}
+	path := result.FilePath
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs // Runs from other directories find it too
+	}
+	entry := urlDBEntry{URL: url, Path: path, Size: result.Size, Downloaded: time.Now()}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if old, ok := db.entries[url]; ok && old.Path == path && old.Size == entry.Size {
+		return // Skipped as saved by an earlier run, or saved again the same
+	}
+	db.entries[url] = entry
+	db.file.Write(append(data, '\n'))
+}
+
+// close closes the database file.
+func (db *urlDB) close() {
+	if db != nil {
+		db.file.Close()
+	}
+}
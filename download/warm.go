@@ -0,0 +1,161 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"wget/httpclient"
+	"wget/utils"
+)
+
+// WarmResult describes the outcome of fetching a URL to warm a cache.
+type WarmResult struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Size       int64  // Bytes of the body received and discarded
+	Cache      string // httpclient.CacheHit or CacheMiss, empty when the response doesn't say
+	Err        error
+	Failure    Phase // Phase at which the fetch failed, empty when it succeeded
+}
+
+// OK reports whether the whole body of a successful response was received.
+func (r WarmResult) OK() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// WarmURLContext fetches a URL with a plain GET and reads the whole body
+// without saving it, so the caches between the client and the server (a
+// CDN, a proxy) store the response. The request carries no cache control
+// of its own, a cache answers it as it would a browser.
+func WarmURLContext(ctx context.Context, fileURL string, opts Options) WarmResult {
+	result := WarmResult{URL: fileURL}
+	opts.Method = http.MethodGet
+	opts.PostData = ""
+	opts.BodyFile = ""
+
+	req, err := newRequest(ctx, fileURL, opts)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = sendRequest(ctx, req, opts); err == nil {
+			defer resp.Body.Close()
+			result.StatusCode = resp.StatusCode
+			result.Status = resp.Status
+			result.Cache = httpclient.CacheStatus(resp)
+			result.Size, err = io.Copy(discard(opts), failureReader{resp.Body})
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = interrupted(ctx)
+		}
+		result.Err = err
+		result.Failure = FailurePhase(err)
+	} else if !result.OK() {
+		result.Failure = PhaseHTTP
+	}
+	return result
+}
+
+// discard returns the writer warmed bodies are thrown away into, counting
+// them against the quota and holding them to the rate limit.
+func discard(opts Options) io.Writer {
+	writer := opts.Quota.Writer(io.Discard)
+	if limit, err := utils.ParseRateLimit(opts.RateLimit); err == nil && limit > 0 {
+		writer = NewRateLimitedWriter(writer, limit)
+	}
+	return writer
+}
+
+// WarmContext warms the caches with every URL, opts.MaxConcurrent at a time
+// (one when unset), printing the status and cache status of each. It
+// returns an error if any URL failed, and ErrInterrupted without fetching
+// the remaining URLs when ctx ends.
+func WarmContext(ctx context.Context, urls []string, opts Options) error {
+	var mu sync.Mutex
+	var warmed, hits, misses, failed int
+	failures := make(map[Phase]int) // Failed URLs by phase
+	report := newBatchReport(opts.ReportFile)
+
+	workers := min(max(opts.MaxConcurrent, 1), len(urls))
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fileURL := range jobs {
+				result := WarmURLContext(ctx, fileURL, opts)
+				printWarmResult(opts, result)
+				report.addWarm(result)
+
+				mu.Lock()
+				switch {
+				case !result.OK():
+					failed++
+					failures[result.Failure]++
+				case result.Cache == httpclient.CacheHit:
+					warmed++
+					hits++
+				case result.Cache == httpclient.CacheMiss:
+					warmed++
+					misses++
+				default:
+					warmed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	started := 0
+feed:
+	for _, fileURL := range urls {
+		select {
+		case jobs <- fileURL:
+			started++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	defer func() {
+		if err := report.write(); err != nil {
+			opts.logf("Warning: %v\n", err)
+		}
+	}()
+
+	if ctx.Err() != nil {
+		for _, fileURL := range urls[started:] {
+			report.skip(fileURL, interrupted(ctx))
+		}
+		opts.logf("\nInterrupted after warming %d of %d URLs, %d failed\n", warmed, len(urls), failed)
+		return interrupted(ctx)
+	}
+
+	opts.logf("\nWarmed %d of %d URLs (%d cache hits, %d misses, %d unknown)\n", warmed, len(urls), hits, misses, warmed-hits-misses)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d URLs failed (%s)", failed, len(urls), formatFailures(failures))
+	}
+	return nil
+}
+
+func printWarmResult(opts Options, result WarmResult) {
+	if result.Err != nil {
+		opts.logf("[FAILED] %s: %s error: %v\n", result.URL, result.Failure, result.Err)
+		return
+	}
+	cache := result.Cache
+	if cache == "" {
+		cache = "unknown"
+	}
+	label := "[WARM]"
+	if !result.OK() {
+		label = "[FAILED]"
+	}
+	opts.logf("%s %s: %s, %s, cache %s\n", label, result.URL, result.Status, utils.FormatBytes(result.Size), cache)
+}
@@ -0,0 +1,92 @@
+// Package history keeps a record of the data transferred across runs, so
+// limits like --monthly-quota can span several invocations.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// record is the on-disk format of the history file.
+type record struct {
+	Days map[string]int64 `json:"days"` // Bytes transferred per day, keyed by "2006-01-02"
+}
+
+// DefaultPath returns the location of the history file in the user's
+// configuration directory.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting config directory: %v", err)
+	}
+	return filepath.Join(dir, "wget", "history.json"), nil
+}
+
+// MonthUsage returns the number of bytes transferred in the month of now.
+func MonthUsage(path string, now time.Time) (int64, error) {
+	rec, err := load(path)
+	if err != nil {
+		return 0, err
+	}
+
+	month := now.Format("2006-01") + "-"
+	var total int64
+	for day, n := range rec.Days {
+		if strings.HasPrefix(day, month) {
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// Record adds n transferred bytes to the usage of the day of now. The file is
+// re-read right before writing, so concurrent runs don't lose each other's usage.
+func Record(path string, n int64, now time.Time) error {
+	rec, err := load(path)
+	if err != nil {
+		return err
+	}
+	rec.Days[now.Format("2006-01-02")] += n
+	return save(path, rec)
+}
+
+// load reads the history file, treating a missing file as an empty history.
+func load(path string) (*record, error) {
+	rec := &record{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read history %s: %v", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, fmt.Errorf("invalid history %s: %v", path, err)
+		}
+	}
+	if rec.Days == nil {
+		rec.Days = make(map[string]int64)
+	}
+	return rec, nil
+}
+
+// save writes the history through a temporary file, so an interrupted run
+// never leaves a truncated history behind.
+func save(path string, rec *record) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write history %s: %v", path, err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,224 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MaxAutoConcurrency is the most requests --auto-concurrency lets a host
+// have in flight at once.
+const MaxAutoConcurrency = 32
+
+// initialAutoConcurrency is the number of requests in flight a host starts
+// with, low enough for fragile servers.
+const initialAutoConcurrency = 2
+
+// slowLatencySlack is how much slower than the fastest response seen a
+// response may arrive before the host counts as overloaded, on top of
+// taking twice as long. It keeps the jitter of fast hosts from counting.
+const slowLatencySlack = 50 * time.Millisecond
+
+// minDecreaseInterval is the shortest time between two decreases of the
+// limit of a host, for hosts answering faster than that.
+const minDecreaseInterval = 100 * time.Millisecond
+
+// adaptiveTransport limits the requests in flight to each host, adapting
+// the limit the way TCP adapts its window (AIMD): it grows by one after a
+// limit's worth of quick successful responses, and halves when a request
+// fails, the server answers 429 or 502-504, or the responses take much
+// longer than the fastest seen. A slot is held until the body is read or
+// closed, so long transfers count as load.
+type adaptiveTransport struct {
+	next http.RoundTripper
+	max  int
+	log  io.Writer
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+func newAdaptiveTransport(next http.RoundTripper, max int, log io.Writer) *adaptiveTransport {
+	return &adaptiveTransport{next: next, max: max, log: log, hosts: make(map[string]*hostLimiter)}
+}
+
+func (t *adaptiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := t.limiter(req.URL.Host)
+	if err := limiter.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	switch {
+	case err != nil:
+		if req.Context().Err() == nil {
+			t.decreased(limiter.failure(), req.URL.Host, "request failed")
+		}
+		limiter.release()
+		return nil, err
+	case overloaded(resp):
+		t.decreased(limiter.failure(), req.URL.Host, "server answered "+resp.Status)
+	default:
+		t.decreased(limiter.success(latency), req.URL.Host, "responses slowed down")
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, release: limiter.release}
+	return resp, nil
+}
+
+// overloaded reports whether a response shows the server can't keep up.
+func overloaded(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// decreased logs a lowered limit, limit being 0 when it didn't change.
+func (t *adaptiveTransport) decreased(limit int, host, reason string) {
+	if limit > 0 {
+		fmt.Fprintf(t.log, "%s, at most %d requests at once to %s\n", reason, limit, host)
+	}
+}
+
+// limiter returns the limiter of a host.
+func (t *adaptiveTransport) limiter(host string) *hostLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.hosts[host]
+	if !ok {
+		l = &hostLimiter{limit: min(initialAutoConcurrency, t.max), max: t.max}
+		t.hosts[host] = l
+	}
+	return l
+}
+
+// hostLimiter hands out the slots of a host, in the order they are asked for.
+type hostLimiter struct {
+	mu       sync.Mutex
+	limit    int // Requests allowed in flight
+	max      int
+	inFlight int
+	waiters  []chan struct{} // Closed when the waiter is given a slot
+
+	successes    int           // Quick successful responses since the limit last changed
+	fastest      time.Duration // Shortest latency seen, zero before the first response
+	lastDecrease time.Time
+}
+
+// acquire waits for a slot, or until ctx ends.
+func (l *hostLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inFlight < l.limit && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range l.waiters {
+			if w == ready {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// The slot was given while ctx ended, pass it on.
+		l.inFlight--
+		l.grant()
+		return ctx.Err()
+	}
+}
+
+// release frees a slot.
+func (l *hostLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.grant()
+}
+
+// grant hands the free slots to the waiters. The caller must hold l.mu.
+func (l *hostLimiter) grant() {
+	for l.inFlight < l.limit && len(l.waiters) > 0 {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+	}
+}
+
+// success records a response received after latency, growing the limit
+// after a limit's worth of quick ones. A slow one counts as a failure. It
+// returns the new limit when it was lowered, 0 otherwise.
+func (l *hostLimiter) success(latency time.Duration) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.fastest == 0 || latency < l.fastest {
+		l.fastest = latency
+	}
+	if latency > 2*l.fastest+slowLatencySlack {
+		return l.decrease(latency)
+	}
+	l.successes++
+	if l.successes >= l.limit && l.limit < l.max {
+		l.limit++
+		l.successes = 0
+		l.grant()
+	}
+	return 0
+}
+
+// failure records a failed request, halving the limit. It returns the new
+// limit when it was lowered, 0 otherwise.
+func (l *hostLimiter) failure() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.decrease(l.fastest)
+}
+
+// decrease halves the limit, at most once per round trip: the requests that
+// were already in flight when the host got overloaded mostly fail too, and
+// shouldn't bring the limit down to one. The caller must hold l.mu.
+func (l *hostLimiter) decrease(roundTrip time.Duration) int {
+	l.successes = 0
+	if time.Since(l.lastDecrease) < max(roundTrip, minDecreaseInterval) || l.limit == 1 {
+		return 0
+	}
+	l.lastDecrease = time.Now()
+	l.limit = max(l.limit/2, 1)
+	return l.limit
+}
+
+// limitedBody frees the slot of its request once read to the end or closed.
+type limitedBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
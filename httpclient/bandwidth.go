@@ -0,0 +1,91 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// bandwidthTransport reads the response bodies of all requests through one
+// token bucket, capping their aggregate speed however many are in flight,
+// where the rate limit of plain downloads applies to each file.
+type bandwidthTransport struct {
+	next   http.RoundTripper
+	bucket *tokenBucket
+}
+
+func newBandwidthTransport(next http.RoundTripper, rate int64) *bandwidthTransport {
+	return &bandwidthTransport{next: next, bucket: newTokenBucket(rate)}
+}
+
+func (t *bandwidthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		resp.Body = &bucketBody{ReadCloser: resp.Body, ctx: req.Context(), bucket: t.bucket}
+	}
+	return resp, err
+}
+
+// bucketBody reads a response body within the tokens of a shared bucket.
+type bucketBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	bucket *tokenBucket
+}
+
+func (b *bucketBody) Read(p []byte) (int, error) {
+	// Reading no more than a second's worth at a time keeps the speed even.
+	if int64(len(p)) > b.bucket.rate {
+		p = p[:b.bucket.rate]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if waitErr := b.bucket.take(b.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+// tokenBucket hands out a byte per token. Tokens come back at rate per
+// second, up to a second's worth, so transfers may burst after a pause but
+// never go faster on average.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64   // Negative once more were taken than there were, which the takers wait for
+	last   time.Time // When tokens was last brought up to date
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// take takes n tokens, waiting until the bucket has refilled them or until
+// ctx ends. Takers short of tokens are served in the order they came.
+func (b *tokenBucket) take(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	rate := float64(b.rate)
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rate, rate)
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
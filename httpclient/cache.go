@@ -0,0 +1,411 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheTransport keeps responses in a directory and answers repeated
+// requests from it while they are fresh, following the rules RFC 9111 sets
+// for a private cache. Stale responses are revalidated with the server using
+// their ETag or Last-Modified date, so only changed content is transferred.
+//
+// Requests for a byte range or carrying their own conditional headers (-c,
+// -N) are passed through, as their responses depend on local state.
+type cacheTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// cacheEntry is the stored description of a cached response. The body is
+// kept next to it in a file of its own.
+type cacheEntry struct {
+	URL          string
+	StatusCode   int
+	Status       string
+	Header       http.Header
+	Vary         map[string]string // Request header values the response was selected by
+	RequestTime  time.Time         // When the request the response answered was sent
+	ResponseTime time.Time         // When the response was received
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		resp, err := t.next.RoundTrip(req)
+		// A successful unsafe request invalidates the stored response (RFC 9111, section 4.4).
+		if err == nil && req.Method != http.MethodHead && resp.StatusCode < 400 {
+			t.remove(t.key(req))
+		}
+		return resp, err
+	}
+	if !cacheableRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	key := t.key(req)
+	entry, ok := t.load(key)
+	if ok && entry.matches(req) {
+		if !requestNoCache(req) && entry.fresh(req, time.Now()) {
+			return t.serve(key, entry, req)
+		}
+		if cond := entry.conditional(req); cond != nil {
+			return t.revalidate(key, entry, req, cond)
+		}
+	}
+
+	requestTime := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.store(key, req, resp, requestTime), nil
+}
+
+// revalidate asks the server whether the stored response is still current,
+// serving it when the server answers 304 Not Modified.
+func (t *cacheTransport) revalidate(key string, entry *cacheEntry, req, cond *http.Request) (*http.Response, error) {
+	requestTime := time.Now()
+	resp, err := t.next.RoundTrip(cond)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		resp.Request = req
+		return t.store(key, req, resp, requestTime), nil
+	}
+	resp.Body.Close()
+
+	// The 304 response carries the updated metadata (RFC 9111, section 4.3.4).
+	for name, values := range resp.Header {
+		if name != "Content-Length" {
+			entry.Header[name] = values
+		}
+	}
+	entry.RequestTime = requestTime
+	entry.ResponseTime = time.Now()
+	t.saveEntry(key, entry)
+	return t.serve(key, entry, req)
+}
+
+// serve answers req with the stored response.
+func (t *cacheTransport) serve(key string, entry *cacheEntry, req *http.Request) (*http.Response, error) {
+	body, err := os.Open(t.path(key, ".body"))
+	if err != nil {
+		// The body went missing, fetch the response again.
+		t.remove(key)
+		return t.next.RoundTrip(req)
+	}
+	info, err := body.Stat()
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	header := entry.Header.Clone()
+	header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	header.Set("Age", strconv.FormatInt(int64(entry.age(time.Now())/time.Second), 10))
+	return &http.Response{
+		Status:        entry.Status,
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: info.Size(),
+		Request:       req,
+	}, nil
+}
+
+// store arranges for resp to be saved in the cache as its body is read, when
+// it may be stored. It returns the response to hand to the caller.
+func (t *cacheTransport) store(key string, req *http.Request, resp *http.Response, requestTime time.Time) *http.Response {
+	if !storableResponse(resp) {
+		return resp
+	}
+
+	tmp, err := os.CreateTemp(t.dir, "body-*")
+	if err != nil {
+		return resp
+	}
+
+	entry := &cacheEntry{
+		URL:          req.URL.String(),
+		StatusCode:   resp.StatusCode,
+		Status:       resp.Status,
+		Header:       resp.Header.Clone(),
+		Vary:         make(map[string]string),
+		RequestTime:  requestTime,
+		ResponseTime: time.Now(),
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		entry.Vary[name] = req.Header.Get(name)
+	}
+
+	resp.Body = &cachingBody{body: resp.Body, tmp: tmp, commit: func() {
+		if err := os.Rename(tmp.Name(), t.path(key, ".body")); err != nil {
+			os.Remove(tmp.Name())
+			return
+		}
+		t.saveEntry(key, entry)
+	}}
+	return resp
+}
+
+// load reads the stored description of the response for key.
+func (t *cacheTransport) load(key string) (*cacheEntry, bool) {
+	data, err := os.ReadFile(t.path(key, ".json"))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Header == nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// saveEntry writes the description of a stored response. Failing to save it
+// only means the response isn't cached.
+func (t *cacheTransport) saveEntry(key string, entry *cacheEntry) {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp := t.path(key, ".json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, t.path(key, ".json"))
+}
+
+// remove deletes the stored response for key.
+func (t *cacheTransport) remove(key string) {
+	os.Remove(t.path(key, ".json"))
+	os.Remove(t.path(key, ".body"))
+}
+
+// key returns the name the response to req is stored under.
+func (t *cacheTransport) key(req *http.Request) string {
+	u := *req.URL
+	u.Fragment = ""
+	sum := sha256.Sum256([]byte(u.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *cacheTransport) path(key, ext string) string {
+	return filepath.Join(t.dir, key+ext)
+}
+
+// matches reports whether the stored response was selected by the same
+// values of the headers listed in its Vary header as req has.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// fresh reports whether the stored response may be used without asking the
+// server, also honoring a max-age directive of the request.
+func (e *cacheEntry) fresh(req *http.Request, now time.Time) bool {
+	age := e.age(now)
+	if maxAge, ok := cacheControl(req.Header)["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil && age > time.Duration(seconds)*time.Second {
+			return false
+		}
+	}
+	return e.lifetime() > age
+}
+
+// lifetime returns how long the response stays fresh after it was generated
+// (RFC 9111, section 4.2.1).
+func (e *cacheEntry) lifetime() time.Duration {
+	directives := cacheControl(e.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date := e.date()
+	if expires := e.Header.Get("Expires"); expires != "" {
+		// Invalid dates like "0" mean already expired.
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return t.Sub(date)
+	}
+
+	// Without explicit freshness, use a tenth of the time since the last
+	// modification, as suggested by section 4.2.2.
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && lastModified.Before(date) {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// age returns how old the response is (RFC 9111, section 4.2.3).
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := max(0, e.ResponseTime.Sub(e.date()))
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	ageValue, _ := strconv.Atoi(e.Header.Get("Age"))
+	correctedAge := time.Duration(ageValue)*time.Second + responseDelay
+	residentTime := now.Sub(e.ResponseTime)
+	return max(apparentAge, correctedAge) + residentTime
+}
+
+// date returns the time the response was generated, from its Date header.
+func (e *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+	return e.ResponseTime
+}
+
+// conditional returns a copy of req asking the server to confirm the stored
+// response is current, or nil when the response has no validator.
+func (e *cacheEntry) conditional(req *http.Request) *http.Request {
+	etag := e.Header.Get("ETag")
+	lastModified := e.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+
+	cond := req.Clone(req.Context())
+	if etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		cond.Header.Set("If-Modified-Since", lastModified)
+	}
+	return cond
+}
+
+// cacheableRequest reports whether the response to req may come from or go
+// to the cache.
+func cacheableRequest(req *http.Request) bool {
+	for _, name := range []string{"Range", "If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+		if req.Header.Get(name) != "" {
+			return false
+		}
+	}
+	_, noStore := cacheControl(req.Header)["no-store"]
+	return !noStore
+}
+
+// requestNoCache reports whether req asks for the stored response to be
+// revalidated even when it is fresh.
+func requestNoCache(req *http.Request) bool {
+	_, noCache := cacheControl(req.Header)["no-cache"]
+	return noCache || strings.EqualFold(req.Header.Get("Pragma"), "no-cache")
+}
+
+// storableResponse reports whether resp may be stored and can be of use
+// later, either while fresh or through revalidation.
+func storableResponse(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	directives := cacheControl(resp.Header)
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	if _, ok := directives["max-age"]; ok {
+		return true
+	}
+	for _, name := range []string{"Expires", "ETag", "Last-Modified"} {
+		if resp.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl parses the Cache-Control directives of a header into a map
+// of lowercase names to their (unquoted) arguments.
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// varyHeaders returns the canonical names of the request headers listed in
+// the Vary header.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// cachingBody copies a response body into a temporary file as it is read.
+// The file only becomes the cached body once the whole body was read.
+type cachingBody struct {
+	body   io.ReadCloser
+	tmp    *os.File
+	commit func()
+	failed bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 && b.tmp != nil && !b.failed {
+		if _, werr := b.tmp.Write(p[:n]); werr != nil {
+			b.failed = true
+		}
+	}
+	if err == io.EOF && b.tmp != nil {
+		tmp := b.tmp
+		b.tmp = nil
+		if tmp.Close() == nil && !b.failed {
+			b.commit()
+		} else {
+			os.Remove(tmp.Name())
+		}
+	}
+	return n, err
+}
+
+// Close closes the body, dropping the copy when the body wasn't read to the end.
+func (b *cachingBody) Close() error {
+	if b.tmp != nil {
+		b.tmp.Close()
+		os.Remove(b.tmp.Name())
+		b.tmp = nil
+	}
+	return b.body.Close()
+}
@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Cache statuses returned by CacheStatus.
+const (
+	CacheHit  = "HIT"
+	CacheMiss = "MISS"
+)
+
+// CacheStatus tells whether a CDN or proxy cache answered a response from
+// its cache, judging by the headers the common ones add: Cache-Status (RFC
+// 9211), CF-Cache-Status, X-Cache, X-Cache-Status and X-Proxy-Cache, or else
+// a positive Age. It returns CacheHit, CacheMiss, or "" when the response
+// doesn't say.
+func CacheStatus(resp *http.Response) string {
+	// Cache-Status lists the caches from the origin outwards, the last one answered.
+	if value := resp.Header.Get("Cache-Status"); value != "" {
+		entries := strings.Split(value, ",")
+		for _, param := range strings.Split(entries[len(entries)-1], ";")[1:] {
+			name, _, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch strings.ToLower(name) {
+			case "hit":
+				return CacheHit
+			case "fwd":
+				return CacheMiss
+			}
+		}
+	}
+	for _, name := range []string{"CF-Cache-Status", "X-Cache", "X-Cache-Status", "X-Proxy-Cache"} {
+		value := strings.ToUpper(resp.Header.Get(name))
+		if value == "" {
+			continue
+		}
+		// Shielded CDNs list a status per cache ("MISS, HIT"), the edge adds the last.
+		if i := strings.LastIndexByte(value, ','); i >= 0 {
+			value = value[i+1:]
+		}
+		switch {
+		case strings.Contains(value, "HIT"):
+			return CacheHit
+		case strings.Contains(value, "MISS"), strings.Contains(value, "EXPIRED"), strings.Contains(value, "BYPASS"):
+			return CacheMiss
+		}
+	}
+	if age, err := strconv.Atoi(resp.Header.Get("Age")); err == nil && age > 0 {
+		return CacheHit
+	}
+	return ""
+}
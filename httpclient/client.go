@@ -0,0 +1,187 @@
+// Package httpclient builds the HTTP client shared by the download and
+// mirror packages, so transport level options apply to every mode.
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Config holds the options used to build the shared HTTP client.
+type Config struct {
+	ServerResponse bool      // Print request and response headers of every transfer (-S)
+	Log            io.Writer // Destination of the header dump and redirect log, stdout when nil
+	Family         string    // Only connect over this address family (FamilyIPv4 or FamilyIPv6)
+	PreferFamily   string    // Try addresses of this family first (FamilyIPv4 or FamilyIPv6)
+	TLS            TLSConfig
+	DisableHTTP2   bool // Only speak HTTP/1.1 (--http2=false)
+	EnableHTTP3    bool // Use HTTP/3 with hosts advertising it through Alt-Svc (experimental)
+	AuthNegotiate  bool // Answer Negotiate challenges with Kerberos/SPNEGO (--auth-negotiate)
+	Compression    bool // Request gzip, brotli or zstd bodies and decode them (--compression)
+
+	MaxRedirect int // Redirects followed per request (--max-redirect)
+
+	MaxIdleConnsPerHost int           // Idle connections kept open to each host for reuse, DefaultMaxIdleConnsPerHost when 0 (--max-idle-per-host)
+	DisableKeepAlives   bool          // Use a new connection for every request (--no-http-keep-alive)
+	ConnectTimeout      time.Duration // Time allowed to connect, DefaultConnectTimeout when 0 (--connect-timeout)
+	ResponseTimeout     time.Duration // Time allowed for the response headers once the request is sent, unlimited when 0 (--response-timeout)
+
+	CacheDir string // Directory responses are cached in, no caching when empty (--cache-dir)
+
+	MaxRPS        float64       // Requests sent per second overall, unlimited when 0 (--max-rps)
+	MaxRPSPerHost float64       // Requests sent per second to each host, unlimited when 0 (--max-rps-per-host)
+	Wait          time.Duration // Delay between requests to the same host (--wait)
+	RandomWait    bool          // Vary the delay between 0.5 and 1.5 times Wait (--random-wait)
+
+	RateLimit int64 // Overall speed of response bodies in bytes per second, unlimited when 0 (--rate-limit when mirroring)
+
+	AutoConcurrency      bool // Adapt the requests in flight to each host to its latency and errors (--auto-concurrency)
+	MaxConcurrentPerHost int  // Requests in flight to each host at once, unlimited when 0; the most AutoConcurrency goes up to (--max-concurrent-per-host)
+
+	SafeMode bool // Only connect to public addresses over http and https, for untrusted URLs (--safe-mode)
+
+	Overrides []Override // Settings of the [host] and [url] sections of the config file
+
+	RecordDir string // Directory every exchange is recorded in (--record-dir)
+	ReplayDir string // Directory of recorded exchanges answering the requests offline (--replay-dir)
+
+	WARCFile string // WARC file every exchange is archived in, compressed when named .gz (--warc-file)
+}
+
+// DefaultMaxIdleConnsPerHost is the number of idle connections kept open to
+// each host without Config.MaxIdleConnsPerHost, enough for the concurrent
+// requests of a mirror to reuse their connections rather than open new ones
+// (net/http keeps 2).
+const DefaultMaxIdleConnsPerHost = 32
+
+// DefaultConnectTimeout is the time allowed to connect without
+// Config.ConnectTimeout.
+const DefaultConnectTimeout = 30 * time.Second
+
+// New builds an HTTP client from the given configuration.
+func New(cfg Config) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.DialContext = newDialContext(cfg)
+	base.TLSClientConfig = tlsConfig
+	base.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	if base.MaxIdleConnsPerHost <= 0 {
+		base.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	base.MaxIdleConns = max(base.MaxIdleConns, base.MaxIdleConnsPerHost)
+	base.DisableKeepAlives = cfg.DisableKeepAlives
+	base.ResponseHeaderTimeout = cfg.ResponseTimeout
+
+	if cfg.SafeMode {
+		// A proxy would connect on our behalf, out of reach of the address check.
+		base.Proxy = nil
+	}
+
+	if cfg.DisableHTTP2 {
+		// A non-nil empty map keeps the transport from negotiating h2.
+		base.ForceAttemptHTTP2 = false
+		base.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	log := cfg.Log
+	if log == nil {
+		log = os.Stdout
+	}
+
+	var transport http.RoundTripper = base
+	if cfg.EnableHTTP3 {
+		transport = newAltSvcTransport(base, tlsConfig, cfg.SafeMode)
+	}
+
+	// Hosts with TLS options of their own get connections of their own.
+	if transport, err = newHostTLSTransport(transport, base, cfg.Overrides); err != nil {
+		return nil, err
+	}
+
+	// In place of the network, so the layers above behave as they did when recording.
+	switch {
+	case cfg.ReplayDir != "":
+		if info, err := os.Stat(cfg.ReplayDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("replay directory %s not found", cfg.ReplayDir)
+		}
+		transport = newReplayTransport(cfg.ReplayDir)
+	case cfg.RecordDir != "":
+		if err := os.MkdirAll(cfg.RecordDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create record directory: %v", err)
+		}
+		transport = newRecordTransport(transport, cfg.RecordDir)
+	}
+
+	// Next to the network, so the archive holds the responses as received.
+	if cfg.WARCFile != "" {
+		if transport, err = newWARCTransport(transport, cfg.WARCFile, log); err != nil {
+			return nil, err
+		}
+	}
+
+	// Inside the layers that add headers or hold requests back, so each request
+	// is dumped as it is sent, with its final headers.
+	if cfg.ServerResponse {
+		transport = &loggingTransport{next: transport, log: log}
+	}
+
+	// Inside the pacing, so the delays it adds aren't mistaken for a slow server.
+	switch {
+	case cfg.AutoConcurrency:
+		maxPerHost := MaxAutoConcurrency
+		if cfg.MaxConcurrentPerHost > 0 {
+			maxPerHost = min(maxPerHost, cfg.MaxConcurrentPerHost)
+		}
+		transport = newAdaptiveTransport(transport, maxPerHost, log)
+	case cfg.MaxConcurrentPerHost > 0:
+		transport = newHostCapTransport(transport, cfg.MaxConcurrentPerHost)
+	}
+
+	// Close to the network, so cache hits aren't delayed but retries and revalidations are.
+	if cfg.MaxRPS > 0 || cfg.MaxRPSPerHost > 0 || cfg.Wait > 0 {
+		transport = newPacingTransport(transport, cfg.MaxRPS, cfg.MaxRPSPerHost, cfg.Wait, cfg.RandomWait)
+	}
+
+	// Beside the pacing, so cache hits are read at full speed.
+	if cfg.RateLimit > 0 {
+		transport = newBandwidthTransport(transport, cfg.RateLimit)
+	}
+
+	// Wraps the logging so both the challenged and the authenticated request are logged.
+	if cfg.AuthNegotiate {
+		transport = &negotiateTransport{next: transport}
+	}
+
+	// Inside the decoding, so bodies are stored as received and requests
+	// carry the Accept-Encoding their Vary header may refer to.
+	if cfg.CacheDir != "" {
+		if err := os.MkdirAll(cfg.CacheDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %v", err)
+		}
+		transport = &cacheTransport{next: transport, dir: cfg.CacheDir}
+	}
+
+	// Outermost, so the header dump shows the encoded response as received.
+	if cfg.Compression {
+		transport = &compressionTransport{next: transport}
+	}
+
+	// Outside everything else, so the header dump and the cache see the
+	// headers and credentials it adds.
+	if len(cfg.Overrides) > 0 {
+		transport = newOverrideTransport(transport, cfg.Overrides)
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: newCheckRedirect(cfg.MaxRedirect, cfg.SafeMode, log),
+	}, nil
+}
@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding lists the content codings the client can decode.
+const acceptEncoding = "gzip, br, zstd"
+
+// compressionTransport asks servers for compressed responses and decodes the
+// bodies on the fly, so callers always read the original content.
+type compressionTransport struct {
+	next http.RoundTripper
+}
+
+func (t *compressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Leave an Accept-Encoding set with --header alone.
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "gzip", "x-gzip", "br", "zstd":
+	default:
+		return resp, nil
+	}
+
+	// ContentLength keeps the size on the wire; the decoded size is unknown.
+	resp.Body = &DecodedBody{body: resp.Body, encoding: encoding}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// DecodedBody is the body of a compressed response. It reads the decoded
+// content while keeping count of the compressed bytes received, which is what
+// the response's ContentLength refers to.
+type DecodedBody struct {
+	body       io.ReadCloser
+	encoding   string
+	decoder    io.Reader
+	compressed int64
+}
+
+// CompressedBytes returns the number of compressed bytes read so far.
+func (b *DecodedBody) CompressedBytes() int64 {
+	return b.compressed
+}
+
+// Read decodes the next chunk of the body. The decoder is created on the first
+// read, as empty bodies (HEAD requests, 304 responses) have no header to parse.
+func (b *DecodedBody) Read(p []byte) (int, error) {
+	if b.decoder == nil {
+		decoder, err := newDecoder(countingReader{b}, b.encoding)
+		if err != nil {
+			return 0, err
+		}
+		b.decoder = decoder
+	}
+	return b.decoder.Read(p)
+}
+
+// Close releases the decoder and closes the underlying body.
+func (b *DecodedBody) Close() error {
+	if closer, ok := b.decoder.(io.Closer); ok {
+		closer.Close()
+	}
+	return b.body.Close()
+}
+
+// countingReader reads the compressed body, counting the bytes read.
+type countingReader struct {
+	b *DecodedBody
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.b.body.Read(p)
+	r.b.compressed += int64(n)
+	return n, err
+}
+
+// zstdReader adapts a zstd decoder, whose Close has no return value, to io.ReadCloser.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r zstdReader) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+// newDecoder returns a reader decoding r according to the content coding.
+func newDecoder(r io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		decoder, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %v", err)
+		}
+		return decoder, nil
+	case "br":
+		return brotli.NewReader(r), nil
+	case "zstd":
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %v", err)
+		}
+		return zstdReader{decoder}, nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
@@ -0,0 +1,76 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// Address families accepted by Config.Family and Config.PreferFamily.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// newDialContext returns a dial function that honors the address family
+// settings: Family restricts connections to IPv4 or IPv6 only, while
+// PreferFamily merely tries addresses of that family first.
+func newDialContext(cfg Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+	if dialer.Timeout <= 0 {
+		dialer.Timeout = DefaultConnectTimeout
+	}
+	if cfg.SafeMode {
+		dialer.Control = safeControl
+	}
+
+	switch cfg.Family {
+	case FamilyIPv4:
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp4", addr)
+		}
+	case FamilyIPv6:
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp6", addr)
+		}
+	}
+
+	if cfg.PreferFamily != FamilyIPv4 && cfg.PreferFamily != FamilyIPv6 {
+		return dialer.DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		// Stable sort keeps the resolver's order within each family.
+		preferIPv4 := cfg.PreferFamily == FamilyIPv4
+		sort.SliceStable(ips, func(i, j int) bool {
+			iIsIPv4 := ips[i].IP.To4() != nil
+			jIsIPv4 := ips[j].IP.To4() != nil
+			return iIsIPv4 == preferIPv4 && jIsIPv4 != preferIPv4
+		})
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,50 @@
+package httpclient
+
+import (
+	"net/http"
+	"sync"
+)
+
+// hostCapTransport limits the requests in flight to each host to a fixed
+// number, however many are in flight overall, so a crawl spanning hosts
+// doesn't put all its workers on one. As with adaptiveTransport, a slot is
+// held until the body is read or closed, and requests over the limit wait
+// for one in the order they came.
+type hostCapTransport struct {
+	next http.RoundTripper
+	max  int
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+func newHostCapTransport(next http.RoundTripper, max int) *hostCapTransport {
+	return &hostCapTransport{next: next, max: max, hosts: make(map[string]*hostLimiter)}
+}
+
+func (t *hostCapTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := t.limiter(req.URL.Host)
+	if err := limiter.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		limiter.release()
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, release: limiter.release}
+	return resp, nil
+}
+
+// limiter returns the limiter of a host.
+func (t *hostCapTransport) limiter(host string) *hostLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.hosts[host]
+	if !ok {
+		l = &hostLimiter{limit: t.max, max: t.max}
+		t.hosts[host] = l
+	}
+	return l
+}
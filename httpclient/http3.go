@@ -0,0 +1,135 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// altSvcTransport sends requests over HTTP/3 to hosts that advertised h3 in
+// an Alt-Svc response header, and over the regular TCP transport otherwise.
+// If an HTTP/3 request fails, the host is forgotten and the request is
+// retried over TCP.
+type altSvcTransport struct {
+	tcp http.RoundTripper
+	h3  *http3.Transport
+
+	mu       sync.Mutex
+	altAddrs map[string]string // host:port of the origin -> host:port of its h3 endpoint
+}
+
+func newAltSvcTransport(tcp http.RoundTripper, tlsConfig *tls.Config, safeMode bool) *altSvcTransport {
+	t := &altSvcTransport{tcp: tcp, altAddrs: make(map[string]string)}
+	t.h3 = &http3.Transport{
+		TLSClientConfig: tlsConfig.Clone(),
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			if altAddr, ok := t.lookup(addr); ok {
+				addr = altAddr
+			}
+			// Alt-Svc may point anywhere, so the endpoint is checked too.
+			if safeMode {
+				resolved, err := resolvePublic(ctx, addr)
+				if err != nil {
+					return nil, err
+				}
+				addr = resolved
+			}
+			return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+		},
+	}
+	return t
+}
+
+func (t *altSvcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	origin := originAddr(req)
+
+	if _, ok := t.lookup(origin); ok && req.URL.Scheme == "https" {
+		resp, err := t.h3.RoundTrip(req)
+		if err == nil {
+			return resp, nil
+		}
+		t.forget(origin)
+
+		// The body may have been partly sent; rewind it for the TCP retry.
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+
+	resp, err := t.tcp.RoundTrip(req)
+	if err == nil && req.URL.Scheme == "https" {
+		if altAddr, ok := parseAltSvcH3(resp.Header.Get("Alt-Svc"), req.URL.Hostname()); ok {
+			t.remember(origin, altAddr)
+		}
+	}
+	return resp, err
+}
+
+func (t *altSvcTransport) lookup(origin string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	altAddr, ok := t.altAddrs[origin]
+	return altAddr, ok
+}
+
+func (t *altSvcTransport) remember(origin, altAddr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.altAddrs[origin] = altAddr
+}
+
+func (t *altSvcTransport) forget(origin string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.altAddrs, origin)
+}
+
+// originAddr returns the host:port a request is sent to.
+func originAddr(req *http.Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		port = "443"
+		if req.URL.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
+
+// parseAltSvcH3 extracts the HTTP/3 endpoint from an Alt-Svc header value
+// such as `h3=":443"; ma=86400, h3-29=":443"`. An endpoint without a host
+// refers to the origin host.
+func parseAltSvcH3(altSvc, originHost string) (string, bool) {
+	for _, service := range strings.Split(altSvc, ",") {
+		protocol, rest, found := strings.Cut(strings.TrimSpace(service), "=")
+		if !found || protocol != "h3" {
+			continue
+		}
+
+		authority, _, _ := strings.Cut(rest, ";")
+		authority = strings.Trim(strings.TrimSpace(authority), `"`)
+		host, port, err := net.SplitHostPort(authority)
+		if err != nil || port == "" {
+			continue
+		}
+		if host == "" {
+			host = originHost
+		}
+		return net.JoinHostPort(host, port), true
+	}
+	return "", false
+}
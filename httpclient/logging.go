@@ -0,0 +1,87 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// loggingTransport prints the headers of every request and response that
+// pass through it. Since each redirect hop is a separate round trip, the
+// whole redirect chain shows up in the log. The request is printed as it is
+// sent, so it shows even when no response comes.
+type loggingTransport struct {
+	next http.RoundTripper
+	log  io.Writer
+	mu   sync.Mutex // Keeps the dumps of concurrent transfers from interleaving
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests built by the client for redirects leave Proto unset.
+	proto := req.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "---request begin---\n%s %s %s\n", req.Method, req.URL.RequestURI(), proto)
+	fmt.Fprintf(&buf, "Host: %s\n", req.URL.Host)
+	writeHeaders(&buf, sentHeader(req), "")
+	fmt.Fprintf(&buf, "---request end---\n")
+	t.write(&buf)
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(&buf, "request to %s failed: %v\n", req.URL, err)
+	} else {
+		fmt.Fprintf(&buf, "---response begin---\n  %s %s\n", resp.Proto, resp.Status)
+		writeHeaders(&buf, resp.Header, "  ")
+		fmt.Fprintf(&buf, "---response end---\n")
+	}
+	t.write(&buf)
+	return resp, err
+}
+
+// write prints a dump in one piece and empties buf.
+func (t *loggingTransport) write(buf *bytes.Buffer) {
+	t.mu.Lock()
+	t.log.Write(buf.Bytes())
+	t.mu.Unlock()
+	buf.Reset()
+}
+
+// sentHeader returns the headers a request goes out with, adding those
+// net/http sends when they are missing.
+func sentHeader(req *http.Request) http.Header {
+	header := req.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if _, ok := header["User-Agent"]; !ok {
+		header.Set("User-Agent", "Go-http-client/1.1")
+	}
+	// The transport asks for gzip and decodes it transparently, unless the
+	// request asks for an encoding or a range itself.
+	if header.Get("Accept-Encoding") == "" && header.Get("Range") == "" && req.Method != http.MethodHead {
+		header.Set("Accept-Encoding", "gzip")
+	}
+	return header
+}
+
+// writeHeaders writes headers sorted by name, one "Name: value" per line.
+func writeHeaders(w io.Writer, header http.Header, indent string) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(w, "%s%s: %s\n", indent, name, value)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// negotiateTransport answers "WWW-Authenticate: Negotiate" challenges with a
+// SPNEGO token obtained from the Kerberos tickets in the system credential
+// cache (as created by kinit), then retries the request.
+type negotiateTransport struct {
+	next http.RoundTripper
+
+	once   sync.Once
+	client *client.Client
+	err    error
+}
+
+func (t *negotiateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !challengesNegotiate(resp) {
+		return resp, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	kerberos, err := t.kerberosClient()
+	if err == nil {
+		err = spnego.SetSPNEGOHeader(kerberos, retry, "")
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("negotiate authentication failed: %v", err)
+	}
+
+	resp.Body.Close()
+	return t.next.RoundTrip(retry)
+}
+
+// kerberosClient loads the Kerberos configuration and credential cache the
+// first time a Negotiate challenge is received.
+func (t *negotiateTransport) kerberosClient() (*client.Client, error) {
+	t.once.Do(func() {
+		cfg, err := config.Load(krb5ConfigPath())
+		if err != nil {
+			t.err = fmt.Errorf("failed to load Kerberos configuration: %v", err)
+			return
+		}
+
+		ccache, err := credentials.LoadCCache(credentialCachePath())
+		if err != nil {
+			t.err = fmt.Errorf("failed to load Kerberos credential cache (run kinit first): %v", err)
+			return
+		}
+
+		t.client, t.err = client.NewFromCCache(ccache, cfg, client.DisablePAFXFAST(true))
+	})
+	return t.client, t.err
+}
+
+// challengesNegotiate reports whether a response asks for SPNEGO authentication.
+func challengesNegotiate(resp *http.Response) bool {
+	for _, challenge := range resp.Header.Values("WWW-Authenticate") {
+		if strings.HasPrefix(strings.TrimSpace(challenge), "Negotiate") {
+			return true
+		}
+	}
+	return false
+}
+
+// krb5ConfigPath returns the Kerberos configuration file, honoring KRB5_CONFIG.
+func krb5ConfigPath() string {
+	if path := os.Getenv("KRB5_CONFIG"); path != "" {
+		return path
+	}
+	return "/etc/krb5.conf"
+}
+
+// credentialCachePath returns the file credential cache, honoring
+// KRB5CCNAME. Only FILE: caches are supported.
+func credentialCachePath() string {
+	if path := os.Getenv("KRB5CCNAME"); path != "" {
+		return strings.TrimPrefix(path, "FILE:")
+	}
+	return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+}
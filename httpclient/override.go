@@ -0,0 +1,172 @@
+package httpclient
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Override holds settings applied to the requests of the URLs it matches,
+// from a [host] or [url] section of the config file.
+type Override struct {
+	Host string // Host pattern such as *.internal.corp, any host when empty
+	URL  string // URL prefix such as https://example.com/api/, * matching any characters; any URL when empty
+
+	Headers        []string   // Extra request headers in "Name: value" form, replacing those of the same name
+	User, Password string     // Basic authentication credentials, unless the request has an Authorization header
+	RateLimit      int64      // Maximum speed of response bodies in bytes per second, unlimited when 0
+	MaxRPS         float64    // Requests sent per second to the matching URLs, unlimited when 0
+	TLS            *TLSConfig // TLS options of connections to the matching hosts, the shared ones when nil
+}
+
+// override is an Override ready to match requests.
+type override struct {
+	Override
+	url   *regexp.Regexp // Nil when the override matches any URL
+	pacer *pacer
+}
+
+func newOverride(o Override) override {
+	compiled := override{Override: o, pacer: newPacer(o.MaxRPS)}
+	if o.URL != "" {
+		expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(o.URL), `\*`, ".*")
+		compiled.url = regexp.MustCompile(expr)
+	}
+	return compiled
+}
+
+// matches reports whether the override applies to a URL.
+func (o *override) matches(req *http.Request) bool {
+	if o.Host != "" && !matchHost(o.Host, req.URL.Host) {
+		return false
+	}
+	return o.url == nil || o.url.MatchString(req.URL.String())
+}
+
+// matchHost reports whether a host (with an optional port) matches a pattern.
+func matchHost(pattern, host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	ok, _ := path.Match(pattern, strings.ToLower(host))
+	return ok
+}
+
+// overrideTransport applies the overrides matching each request. Every hop
+// of a redirect is matched on its own, so credentials meant for one host
+// aren't sent to another.
+type overrideTransport struct {
+	next      http.RoundTripper
+	overrides []override
+}
+
+func newOverrideTransport(next http.RoundTripper, overrides []Override) *overrideTransport {
+	t := &overrideTransport{next: next}
+	for _, o := range overrides {
+		t.overrides = append(t.overrides, newOverride(o))
+	}
+	return t
+}
+
+func (t *overrideTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var matched []*override
+	for i := range t.overrides {
+		if t.overrides[i].matches(req) {
+			matched = append(matched, &t.overrides[i])
+		}
+	}
+	if len(matched) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	// A transport must not modify the caller's request.
+	req = req.Clone(req.Context())
+	var rateLimit int64
+	for _, o := range matched {
+		for _, header := range o.Headers {
+			name, value, _ := strings.Cut(header, ":")
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		if o.User != "" && req.Header.Get("Authorization") == "" {
+			req.SetBasicAuth(o.User, o.Password)
+		}
+		if o.RateLimit > 0 && (rateLimit == 0 || o.RateLimit < rateLimit) {
+			rateLimit = o.RateLimit
+		}
+		if err := o.pacer.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && rateLimit > 0 {
+		resp.Body = &rateLimitedBody{ReadCloser: resp.Body, bandwidth: rateLimit}
+	}
+	return resp, err
+}
+
+// rateLimitedBody reads a response body no faster than bandwidth bytes per
+// second.
+type rateLimitedBody struct {
+	io.ReadCloser
+	bandwidth int64
+}
+
+func (b *rateLimitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.bandwidth {
+		p = p[:b.bandwidth]
+	}
+	start := time.Now()
+	n, err := b.ReadCloser.Read(p)
+	if expected := time.Duration(n) * time.Second / time.Duration(b.bandwidth); time.Since(start) < expected {
+		time.Sleep(expected - time.Since(start))
+	}
+	return n, err
+}
+
+// hostTLSTransport sends the requests to hosts with TLS overrides through
+// transports of their own, configured with those options.
+type hostTLSTransport struct {
+	next  http.RoundTripper
+	hosts []hostTLS
+}
+
+type hostTLS struct {
+	pattern   string
+	transport http.RoundTripper
+}
+
+func (t *hostTLSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, h := range t.hosts {
+		if matchHost(h.pattern, req.URL.Host) {
+			return h.transport.RoundTrip(req)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newHostTLSTransport returns next, or a transport routing the hosts of the
+// overrides with TLS options to clones of base using them.
+func newHostTLSTransport(next http.RoundTripper, base *http.Transport, overrides []Override) (http.RoundTripper, error) {
+	t := &hostTLSTransport{next: next}
+	for _, o := range overrides {
+		if o.TLS == nil || o.Host == "" {
+			continue
+		}
+		tlsConfig, err := newTLSConfig(*o.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport := base.Clone()
+		transport.TLSClientConfig = tlsConfig
+		t.hosts = append(t.hosts, hostTLS{pattern: o.Host, transport: transport})
+	}
+	if len(t.hosts) == 0 {
+		return next, nil
+	}
+	return t, nil
+}
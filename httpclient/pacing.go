@@ -0,0 +1,121 @@
+package httpclient
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pacingTransport spaces out requests so no more than a given number are
+// sent per second, overall and to each host, and waits at least a given
+// delay between requests to the same host. Servers that throttle on the
+// request count rather than the bandwidth are then never overrun, whichever
+// mode issues the requests.
+type pacingTransport struct {
+	next    http.RoundTripper
+	global  *pacer        // Nil when there is no overall limit
+	perHost time.Duration // Interval between requests to a host, none when 0
+	jitter  bool          // Vary the interval between 0.5 and 1.5 times its length
+
+	mu    sync.Mutex
+	hosts map[string]*pacer
+}
+
+func newPacingTransport(next http.RoundTripper, rps, perHostRPS float64, wait time.Duration, randomWait bool) *pacingTransport {
+	perHost := wait
+	if perHostRPS > 0 {
+		perHost = max(perHost, rpsInterval(perHostRPS))
+	}
+	return &pacingTransport{
+		next:    next,
+		global:  newPacer(rps),
+		perHost: perHost,
+		jitter:  randomWait,
+		hosts:   make(map[string]*pacer),
+	}
+}
+
+func (t *pacingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.hostPacer(req.URL.Host).wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if err := t.global.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// hostPacer returns the pacer of a host, nil when there is no per host limit.
+func (t *pacingTransport) hostPacer(host string) *pacer {
+	if t.perHost <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.hosts[host]
+	if !ok {
+		p = &pacer{interval: t.perHost, jitter: t.jitter}
+		t.hosts[host] = p
+	}
+	return p
+}
+
+// pacer hands out evenly spaced slots for sending requests.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	jitter   bool      // Randomize each interval, so the requests don't look automated
+	next     time.Time // Earliest time the next request may be sent
+}
+
+// newPacer returns a pacer allowing rps requests per second, or nil when
+// rps isn't positive.
+func newPacer(rps float64) *pacer {
+	if rps <= 0 {
+		return nil
+	}
+	return &pacer{interval: rpsInterval(rps)}
+}
+
+// rpsInterval returns the interval between requests sent at rps per second.
+func rpsInterval(rps float64) time.Duration {
+	return time.Duration(float64(time.Second) / rps)
+}
+
+// wait blocks until the next slot, or until ctx ends. A nil pacer never waits.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	slot := p.next
+	if slot.Before(now) {
+		slot = now
+	}
+	interval := p.interval
+	if p.jitter {
+		// As with GNU wget's --random-wait, between 0.5 and 1.5 times the wait.
+		interval = time.Duration((0.5 + rand.Float64()) * float64(interval))
+	}
+	p.next = slot.Add(interval)
+	p.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
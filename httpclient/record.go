@@ -0,0 +1,306 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// replayHeaders are the request headers that select a recorded response
+// besides the method, URL and body: a resumed or conditional request gets
+// the answer recorded for it, not that of the plain request.
+var replayHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// exchange is the stored description of a recorded HTTP exchange. The
+// response body is kept next to it in a file of its own.
+type exchange struct {
+	Method        string
+	URL           string
+	RequestHeader http.Header
+	RequestBody   string `json:",omitempty"` // SHA-256 of the request body
+
+	StatusCode int         `json:",omitempty"`
+	Status     string      `json:",omitempty"`
+	Header     http.Header `json:",omitempty"`
+	Complete   bool        // The whole body was read, it is all in the body file
+	Error      string      `json:",omitempty"` // Error of the round trip, instead of a response
+}
+
+// recordTransport saves every exchange in a directory, for replayTransport
+// to answer the same requests offline. Exchanges with the same key are
+// numbered in the order they happened: <key>-1.json, <key>-2.json, ...
+type recordTransport struct {
+	next http.RoundTripper
+	dir  string
+
+	mu     sync.Mutex
+	counts map[string]int // Exchanges recorded so far, by key
+}
+
+func newRecordTransport(next http.RoundTripper, dir string) *recordTransport {
+	return &recordTransport{next: next, dir: dir, counts: make(map[string]int)}
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	key, bodySum := exchangeKey(req, body)
+	name := filepath.Join(t.dir, key+"-"+strconv.Itoa(t.number(key)))
+	ex := &exchange{
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: req.Header.Clone(),
+		RequestBody:   bodySum,
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		ex.Error = err.Error()
+		saveExchange(name, ex)
+		return nil, err
+	}
+	ex.StatusCode = resp.StatusCode
+	ex.Status = resp.Status
+	ex.Header = resp.Header.Clone()
+
+	file, err := os.Create(name + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("failed to record %s: %v", req.URL, err)
+	}
+	// HEAD responses have no body, however long the file it describes.
+	length := resp.ContentLength
+	if req.Method == http.MethodHead {
+		length = 0
+	}
+	resp.Body = &recordingBody{body: resp.Body, file: file, length: length, save: func(complete bool) {
+		ex.Complete = complete
+		saveExchange(name, ex)
+	}}
+	return resp, nil
+}
+
+// number returns the number of the next exchange with key, continuing
+// after those a previous run recorded in the directory.
+func (t *recordTransport) number(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.counts[key]
+	if !ok {
+		for {
+			if _, err := os.Stat(filepath.Join(t.dir, key+"-"+strconv.Itoa(n+1)+".json")); err != nil {
+				break
+			}
+			n++
+		}
+	}
+	t.counts[key] = n + 1
+	return n + 1
+}
+
+// saveExchange writes the description of an exchange. A failure to save it
+// only leaves the exchange out of the recording.
+func saveExchange(name string, ex *exchange) {
+	data, err := json.MarshalIndent(ex, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(name+".json.tmp", data, 0644); err != nil {
+		return
+	}
+	os.Rename(name+".json.tmp", name+".json")
+}
+
+// recordingBody copies a response body to a file as it is read. The
+// exchange is saved once the body was read to the end or closed, recording
+// whether all of it was read.
+type recordingBody struct {
+	body    io.ReadCloser
+	file    *os.File
+	length  int64 // Expected length of the body, -1 when unknown
+	written int64
+	save    func(complete bool)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 && b.file != nil {
+		b.file.Write(p[:n])
+		b.written += int64(n)
+	}
+	if err == io.EOF {
+		b.finish(true)
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish(b.length >= 0 && b.written == b.length)
+	return b.body.Close()
+}
+
+func (b *recordingBody) finish(complete bool) {
+	if b.file == nil {
+		return
+	}
+	b.file.Close()
+	b.file = nil
+	b.save(complete)
+}
+
+// replayTransport answers requests with the exchanges recordTransport saved,
+// without touching the network. Requests with the same key get the recorded
+// answers in order, and the last one once they are used up.
+type replayTransport struct {
+	dir string
+
+	mu     sync.Mutex
+	served map[string]int // Exchanges replayed so far, by key
+}
+
+func newReplayTransport(dir string) *replayTransport {
+	return &replayTransport{dir: dir, served: make(map[string]int)}
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, reqBody, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key, _ := exchangeKey(req, reqBody)
+
+	name, ok := t.next(key)
+	if !ok {
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL)
+	}
+	data, err := os.ReadFile(name + ".json")
+	if err != nil {
+		return nil, err
+	}
+	var ex exchange
+	if err := json.Unmarshal(data, &ex); err != nil {
+		return nil, fmt.Errorf("invalid recording %s.json: %v", name, err)
+	}
+	if ex.Error != "" {
+		return nil, errors.New(ex.Error)
+	}
+
+	file, err := os.Open(name + ".body")
+	if err != nil {
+		return nil, err
+	}
+	contentLength := int64(-1)
+	if length, err := strconv.ParseInt(ex.Header.Get("Content-Length"), 10, 64); err == nil {
+		contentLength = length
+	}
+	// A body the recorded run stopped reading ends the way it did for it.
+	body := io.ReadCloser(file)
+	if !ex.Complete {
+		body = &truncatedBody{file: file}
+	}
+	return &http.Response{
+		Status:        ex.Status,
+		StatusCode:    ex.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        ex.Header,
+		Body:          body,
+		ContentLength: contentLength,
+		Request:       req,
+	}, nil
+}
+
+// next returns the name of the recording answering the next request with key.
+func (t *replayTransport) next(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.served[key] + 1
+	name := filepath.Join(t.dir, key+"-"+strconv.Itoa(n))
+	if _, err := os.Stat(name + ".json"); err == nil {
+		t.served[key] = n
+		return name, true
+	}
+	if n == 1 {
+		return "", false
+	}
+	return filepath.Join(t.dir, key+"-"+strconv.Itoa(n-1)), true
+}
+
+// truncatedBody is a recorded body that wasn't read to the end, failing
+// with io.ErrUnexpectedEOF after the recorded part.
+type truncatedBody struct {
+	file *os.File
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	n, err := b.file.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return b.file.Close()
+}
+
+// exchangeKey returns the name a request's exchanges are stored under,
+// derived from its method, URL, body and replayHeaders, along with the
+// digest of the body.
+func exchangeKey(req *http.Request, body []byte) (string, string) {
+	u := *req.URL
+	u.Fragment = ""
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, u.String())
+	for _, name := range replayHeaders {
+		fmt.Fprintf(h, "%s: %s\n", name, req.Header.Get(name))
+	}
+
+	var bodySum string
+	if body != nil {
+		sum := sha256.Sum256(body)
+		bodySum = hex.EncodeToString(sum[:])
+		fmt.Fprintf(h, "\n%s", bodySum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), bodySum
+}
+
+// requestBody reads the body of a request, nil when it has none. Without
+// GetBody to read a copy, the body is consumed and the returned request, a
+// copy of req, carries it instead.
+func requestBody(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		return req, data, err
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return req, data, nil
+}
@@ -0,0 +1,31 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// newCheckRedirect returns a redirect policy that logs every hop of a
+// redirect chain (status, cookies set and target) and gives up after
+// maxRedirect redirects. In safe mode, only http and https targets are
+// followed.
+func newCheckRedirect(maxRedirect int, safeMode bool, log io.Writer) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirect {
+			return fmt.Errorf("%d redirections exceeded", maxRedirect)
+		}
+		if safeMode && req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to %s blocked by safe mode", req.URL)
+		}
+		if resp := req.Response; resp != nil {
+			fmt.Fprintf(log, "%s from %s\n", resp.Status, resp.Request.URL)
+			// Only the names, cookie values are often credentials.
+			for _, cookie := range resp.Cookies() {
+				fmt.Fprintf(log, "Set-Cookie: %s\n", cookie.Name)
+			}
+		}
+		fmt.Fprintf(log, "Location: %s [following]\n", req.URL)
+		return nil
+	}
+}
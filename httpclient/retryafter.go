@@ -0,0 +1,63 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxThrottleRetries is the number of times a request answered with 429 or
+// 503 is sent again before the response is treated as a failure.
+const MaxThrottleRetries = 5
+
+// maxRetryAfter caps the delay a server can ask for, so a huge Retry-After
+// doesn't stall a download for hours.
+const maxRetryAfter = 5 * time.Minute
+
+// Throttled reports whether the server asks the client to come back later:
+// 429 Too Many Requests or 503 Service Unavailable.
+func Throttled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// RetryDelay returns how long to wait before sending a throttled request
+// again: the Retry-After of the response, in seconds or as a date, or else
+// a delay doubling with each attempt from one second.
+func RetryDelay(resp *http.Response, attempt int) time.Duration {
+	if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return min(delay, maxRetryAfter)
+	}
+	return min(time.Second<<min(attempt, 16), maxRetryAfter)
+}
+
+// parseRetryAfter parses the value of a Retry-After header relative to now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(min(seconds, int(maxRetryAfter/time.Second))) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// Sleep waits for d, or until ctx ends, in which case it returns ctx.Err().
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,86 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned in safe mode for connections to addresses
+// that aren't publicly routable.
+var ErrBlockedAddress = errors.New("address blocked by safe mode")
+
+// blockedPrefixes lists the special purpose ranges that netip.Addr's
+// classification methods don't cover.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, may map to private IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+}
+
+// isPublicAddr reports whether addr is publicly routable. Loopback, private,
+// link-local (which includes cloud metadata endpoints like 169.254.169.254)
+// and other special purpose addresses are not.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAddr returns an error unless the IP address of a host:port pair is public.
+func checkAddr(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr().Unmap())
+	}
+	return nil
+}
+
+// safeControl is the net.Dialer hook of safe mode. It runs with the address
+// actually being connected to, after name resolution, so DNS answers that
+// change between lookups can't slip an internal address through.
+func safeControl(network, address string, _ syscall.RawConn) error {
+	return checkAddr(address)
+}
+
+// resolvePublic resolves the host of addr and returns the first of its
+// addresses if it is public, for dialers without a control hook.
+func resolvePublic(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no addresses found for %s", host)
+	}
+	resolved := net.JoinHostPort(ips[0].Unmap().String(), port)
+	if err := checkAddr(resolved); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
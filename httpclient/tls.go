@@ -0,0 +1,83 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig holds the TLS options of the shared client.
+type TLSConfig struct {
+	Insecure      bool   // Skip server certificate verification (--no-check-certificate)
+	CACertificate string // PEM bundle of additional trusted certificate authorities
+	Certificate   string // PEM client certificate for mutual TLS
+	PrivateKey    string // PEM private key of the client certificate (defaults to Certificate)
+	MinVersion    string // Minimum TLS version: 1.0, 1.1, 1.2 or 1.3
+
+	Pins       []string // Public keys accepted for a host, as host=base64-sha256[,...] (--pin-sha256)
+	OCSPStaple string   // Check stapled OCSP responses (OCSPVerify or OCSPRequire)
+}
+
+// tlsVersions maps the accepted --secure-protocol values to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig builds the crypto/tls configuration for the shared transport.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", cfg.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.CACertificate != "" {
+		pem, err := os.ReadFile(cfg.CACertificate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+
+		// Extend the system roots rather than replacing them.
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACertificate)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.Certificate != "" {
+		keyFile := cfg.PrivateKey
+		if keyFile == "" {
+			keyFile = cfg.Certificate
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.Certificate, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if cfg.PrivateKey != "" {
+		return nil, fmt.Errorf("a private key requires a client certificate")
+	}
+
+	if cfg.OCSPStaple != "" && cfg.OCSPStaple != OCSPVerify && cfg.OCSPStaple != OCSPRequire {
+		return nil, fmt.Errorf("invalid OCSP stapling mode %q, expected verify or require", cfg.OCSPStaple)
+	}
+	pins, err := parsePins(cfg.Pins)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.VerifyConnection = newVerifyConnection(pins, cfg.OCSPStaple)
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,151 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Ways of checking stapled OCSP responses (TLSConfig.OCSPStaple).
+const (
+	OCSPVerify  = "verify"  // Check the response when the server staples one
+	OCSPRequire = "require" // Also refuse servers that don't staple a response
+)
+
+// ocspClockSkew is how far the validity period of an OCSP response may be
+// off from the local clock.
+const ocspClockSkew = 5 * time.Minute
+
+// Errors of the additional certificate checks, to be checked with errors.Is.
+var (
+	ErrPinMismatch = errors.New("certificate doesn't match the pinned public keys")
+	ErrOCSP        = errors.New("OCSP check failed")
+)
+
+// parsePins parses --pin-sha256 values of the form host=PIN[,PIN...], where
+// a pin is the base64 SHA-256 digest of a certificate's public key (its
+// SubjectPublicKeyInfo), optionally prefixed by "sha256//" as curl writes them.
+func parsePins(values []string) (map[string][]string, error) {
+	pins := make(map[string][]string)
+	for _, value := range values {
+		host, list, ok := strings.Cut(value, "=")
+		if !ok || host == "" || list == "" {
+			return nil, fmt.Errorf("invalid pin %q, expected host=base64-sha256", value)
+		}
+		host = strings.ToLower(host)
+		for _, pin := range strings.Split(list, ",") {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256//")
+			if digest, err := base64.StdEncoding.DecodeString(pin); err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf("invalid pin %q for %s, expected a base64 SHA-256 digest", pin, host)
+			}
+			pins[host] = append(pins[host], pin)
+		}
+	}
+	return pins, nil
+}
+
+// newVerifyConnection returns the tls.Config hook applying the key pins and
+// OCSP staple checks, or nil when there is nothing to check. It runs after
+// the usual chain verification, so it only ever narrows what is accepted.
+func newVerifyConnection(pins map[string][]string, ocspMode string) func(tls.ConnectionState) error {
+	if len(pins) == 0 && ocspMode == "" {
+		return nil
+	}
+	return func(cs tls.ConnectionState) error {
+		if hostPins := pins[strings.ToLower(cs.ServerName)]; len(hostPins) > 0 {
+			if err := checkPins(cs, hostPins); err != nil {
+				return err
+			}
+		}
+		if ocspMode != "" {
+			return checkOCSPStaple(cs, ocspMode == OCSPRequire)
+		}
+		return nil
+	}
+}
+
+// checkPins accepts the connection if the key of any certificate of the
+// verified chain matches one of pins, so a CA or backup key can be pinned
+// as well as the server's own. Without verification (--no-check-certificate)
+// the certificates the server sent are checked instead.
+func checkPins(cs tls.ConnectionState, pins []string) error {
+	certs := append([]*x509.Certificate(nil), cs.PeerCertificates...)
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		key := base64.StdEncoding.EncodeToString(sum[:])
+		for _, pin := range pins {
+			if key == pin {
+				return nil
+			}
+		}
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: %s sent no certificate", ErrPinMismatch, cs.ServerName)
+	}
+	sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	return fmt.Errorf("%w: %s has key sha256//%s", ErrPinMismatch, cs.ServerName, base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// checkOCSPStaple verifies the OCSP response stapled to the handshake: it
+// must be signed by the issuer of the server certificate (or a responder
+// it delegated to), be current and report the certificate as good.
+func checkOCSPStaple(cs tls.ConnectionState, require bool) error {
+	if len(cs.OCSPResponse) == 0 {
+		if require {
+			return fmt.Errorf("%w: %s didn't staple an OCSP response", ErrOCSP, cs.ServerName)
+		}
+		return nil
+	}
+
+	leaf, issuer := certificateAndIssuer(cs)
+	if leaf == nil || issuer == nil {
+		return fmt.Errorf("%w: the issuer of the certificate of %s is unknown", ErrOCSP, cs.ServerName)
+	}
+	resp, err := ocsp.ParseResponseForCert(cs.OCSPResponse, leaf, issuer)
+	if err != nil {
+		return fmt.Errorf("%w: invalid stapled response from %s: %v", ErrOCSP, cs.ServerName, err)
+	}
+
+	now := time.Now()
+	if resp.ThisUpdate.After(now.Add(ocspClockSkew)) {
+		return fmt.Errorf("%w: stapled response from %s isn't valid before %s", ErrOCSP, cs.ServerName, resp.ThisUpdate.Format(time.RFC3339))
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(now.Add(-ocspClockSkew)) {
+		return fmt.Errorf("%w: stapled response from %s expired at %s", ErrOCSP, cs.ServerName, resp.NextUpdate.Format(time.RFC3339))
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("%w: the certificate of %s was revoked at %s", ErrOCSP, cs.ServerName, resp.RevokedAt.Format(time.RFC3339))
+	default:
+		return fmt.Errorf("%w: the status of the certificate of %s is unknown", ErrOCSP, cs.ServerName)
+	}
+}
+
+// certificateAndIssuer returns the server certificate and the certificate
+// that issued it, preferring the verified chain over what the server sent.
+func certificateAndIssuer(cs tls.ConnectionState) (leaf, issuer *x509.Certificate) {
+	chain := cs.PeerCertificates
+	if len(cs.VerifiedChains) > 0 {
+		chain = cs.VerifiedChains[0]
+	}
+	switch len(chain) {
+	case 0:
+		return nil, nil
+	case 1:
+		return chain[0], nil
+	}
+	return chain[0], chain[1]
+}
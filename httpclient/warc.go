@@ -0,0 +1,284 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcDrainLimit is how much of a body left unread is still read when the
+// response is closed, so error pages and other short bodies the crawl
+// doesn't read are archived whole.
+const warcDrainLimit = 1 << 20
+
+// WARCPath returns the name of the WARC file --warc-file names: the name
+// with .warc.gz added, or .warc without compression, as GNU wget does.
+func WARCPath(name string, compress bool) string {
+	if strings.HasSuffix(name, ".warc") || strings.HasSuffix(name, ".warc.gz") {
+		return name
+	}
+	if compress {
+		return name + ".warc.gz"
+	}
+	return name + ".warc"
+}
+
+// warcTransport archives every exchange in a WARC file (ISO 28500, version
+// 1.1): a request record and a response record holding the HTTP headers
+// and body, once the body was read or closed. A file named .gz has each
+// record compressed as a gzip member of its own, as archiving tools expect.
+// Runs append to the file, each starting with a warcinfo record.
+type warcTransport struct {
+	next     http.RoundTripper
+	log      io.Writer
+	compress bool
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newWARCTransport(next http.RoundTripper, path string, log io.Writer) (*warcTransport, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create WARC directory: %v", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WARC file: %v", err)
+	}
+	t := &warcTransport{next: next, log: log, compress: strings.HasSuffix(path, ".gz"), file: file}
+
+	info := "software: wget\r\nformat: WARC File Format 1.1\r\n" +
+		"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	fields := []string{
+		"WARC-Type: warcinfo",
+		"WARC-Date: " + warcDate(time.Now()),
+		"WARC-Filename: " + filepath.Base(path),
+		"WARC-Record-ID: " + newRecordID(),
+		"Content-Type: application/warc-fields",
+	}
+	if err := t.writeRecords(warcRecord{fields: fields, block: strings.NewReader(info), length: int64(len(info))}); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write WARC file: %v", err)
+	}
+	return t, nil
+}
+
+func (t *warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, reqBody, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	date := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := os.CreateTemp("", "wget-warc-*")
+	if err != nil {
+		fmt.Fprintf(t.log, "Warning: not archiving %s: %v\n", req.URL, err)
+		return resp, nil
+	}
+	head := responseHead(resp)
+	body := &warcBody{
+		body:    resp.Body,
+		spool:   spool,
+		payload: sha1.New(),
+		block:   sha1.New(),
+	}
+	body.block.Write(head)
+	body.save = func(truncated bool) {
+		if err := t.archive(req, reqBody, date, head, body, truncated); err != nil {
+			fmt.Fprintf(t.log, "Warning: failed to archive %s: %v\n", req.URL, err)
+		}
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// archive writes the request and response records of an exchange.
+func (t *warcTransport) archive(req *http.Request, reqBody []byte, date time.Time, head []byte, body *warcBody, truncated bool) error {
+	defer os.Remove(body.spool.Name())
+	defer body.spool.Close()
+	if _, err := body.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	target := req.URL.String()
+	requestID, responseID := newRecordID(), newRecordID()
+	requestBlock := requestHead(req, reqBody)
+
+	response := []string{
+		"WARC-Type: response",
+		"WARC-Target-URI: " + target,
+		"WARC-Date: " + warcDate(date),
+		"WARC-Record-ID: " + responseID,
+		"WARC-Payload-Digest: " + warcDigest(body.payload),
+		"WARC-Block-Digest: " + warcDigest(body.block),
+		"Content-Type: application/http;msgtype=response",
+	}
+	if truncated {
+		response = append(response, "WARC-Truncated: length")
+	}
+	request := []string{
+		"WARC-Type: request",
+		"WARC-Target-URI: " + target,
+		"WARC-Date: " + warcDate(date),
+		"WARC-Record-ID: " + requestID,
+		"WARC-Concurrent-To: " + responseID,
+		"Content-Type: application/http;msgtype=request",
+	}
+
+	return t.writeRecords(
+		warcRecord{fields: response, block: io.MultiReader(bytes.NewReader(head), body.spool), length: int64(len(head)) + body.size},
+		warcRecord{fields: request, block: bytes.NewReader(requestBlock), length: int64(len(requestBlock))},
+	)
+}
+
+// warcRecord is a record to write: its header fields but Content-Length,
+// and its block.
+type warcRecord struct {
+	fields []string
+	block  io.Reader
+	length int64
+}
+
+// writeRecords appends records to the file, next to each other.
+func (t *warcTransport) writeRecords(records ...warcRecord) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, rec := range records {
+		var out io.Writer = t.file
+		var zw *gzip.Writer
+		if t.compress {
+			zw = gzip.NewWriter(t.file)
+			out = zw
+		}
+		w := bufio.NewWriter(out)
+		w.WriteString("WARC/1.1\r\n")
+		for _, field := range rec.fields {
+			w.WriteString(field + "\r\n")
+		}
+		fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", rec.length)
+		if _, err := io.Copy(w, rec.block); err != nil {
+			return err
+		}
+		w.WriteString("\r\n\r\n")
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if zw != nil {
+			if err := zw.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requestHead returns the request as sent: its request line, headers and
+// body.
+func requestHead(req *http.Request, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&b, "Host: %s\r\n", host)
+	req.Header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
+// responseHead returns the status line and headers of a response.
+func responseHead(resp *http.Response) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// warcBody copies a response body to a spool file as it is read, for the
+// response record written once it was read to the end or closed.
+type warcBody struct {
+	body    io.ReadCloser
+	spool   *os.File
+	size    int64
+	payload hash.Hash // Digest of the body
+	block   hash.Hash // Digest of the headers and body
+	save    func(truncated bool)
+	once    sync.Once
+}
+
+func (b *warcBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.write(p[:n])
+	}
+	if err == io.EOF {
+		b.once.Do(func() { b.save(false) })
+	}
+	return n, err
+}
+
+// Close reads up to warcDrainLimit more of the body first, to archive it
+// whole if it's short.
+func (b *warcBody) Close() error {
+	b.once.Do(func() {
+		n, err := io.Copy(writerFunc(b.write), io.LimitReader(b.body, warcDrainLimit))
+		b.save(err != nil || n == warcDrainLimit)
+	})
+	return b.body.Close()
+}
+
+func (b *warcBody) write(p []byte) {
+	b.spool.Write(p)
+	b.payload.Write(p)
+	b.block.Write(p)
+	b.size += int64(len(p))
+}
+
+// writerFunc turns a function into an io.Writer.
+type writerFunc func(p []byte)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	f(p)
+	return len(p), nil
+}
+
+// warcDate formats a time as WARC-Date wants it.
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// warcDigest formats a SHA-1 digest the way WARC tools write them.
+func warcDigest(h hash.Hash) string {
+	return "sha1:" + base32.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// newRecordID returns a random (version 4) UUID URN, unique to a record.
+func newRecordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
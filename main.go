@@ -1,15 +1,62 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
+	"time"
+	"wget/background"
 	"wget/config"
 	"wget/download"
+	"wget/history"
+	"wget/httpclient"
 	"wget/mirror"
+	"wget/sitemap"
+	"wget/tui"
+	"wget/utils"
 )
 
+// exitInterrupted is the exit status of downloads stopped by SIGINT or SIGTERM.
+const exitInterrupted = 130
+
+// exitCode returns the exit status for a failed download.
+func exitCode(err error) int {
+	if errors.Is(err, download.ErrInterrupted) {
+		return exitInterrupted
+	}
+	return 1
+}
+
+// exitHooks run before the process ends, as os.Exit skips deferred calls.
+var exitHooks []func()
+
+// atExit registers f to run when main returns or calls exit.
+func atExit(f func()) {
+	exitHooks = append(exitHooks, f)
+}
+
+// runExitHooks runs the registered exit hooks once.
+func runExitHooks() {
+	hooks := exitHooks
+	exitHooks = nil
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// exit runs the exit hooks and ends the process with the given status.
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
 func expandPath(path string) (string, error) {
 	if strings.HasPrefix(path, "~/") {
 		homeDir, err := os.UserHomeDir()
@@ -21,50 +68,653 @@ func expandPath(path string) (string, error) {
 	return path, nil
 }
 
+// sharedSettings holds the values derived from the flags that several modes use.
+type sharedSettings struct {
+	newerThan time.Time
+	quota     *utils.Quota
+	client    *http.Client
+	maxDepth  int // Levels of links a crawl follows (-l)
+
+	acceptRegex *regexp.Regexp // Compiled --accept-regex, nil when not set
+	rejectRegex *regexp.Regexp // Compiled --reject-regex, nil when not set
+
+	monthlyQuota int64  // Bytes allowed per calendar month, 0 when unlimited
+	historyFile  string // File recording the usage of past runs
+}
+
+// parseSharedSettings parses the flag values shared by several modes.
+func parseSharedSettings(flags *config.Flags) (*sharedSettings, error) {
+	shared := &sharedSettings{}
+
+	if flags.Quota != "" {
+		limit, err := utils.ParseSize(flags.Quota)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota: %v", err)
+		}
+		shared.quota = utils.NewQuota(limit)
+	}
+
+	if flags.MonthlyQuota != "" {
+		if err := shared.applyMonthlyQuota(flags); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags.NewerThan != "" {
+		newerThan, err := utils.ParseDate(flags.NewerThan)
+		if err != nil {
+			return nil, err
+		}
+		shared.newerThan = newerThan
+	}
+
+	maxDepth, err := mirror.ParseLevel(flags.Level)
+	if err != nil {
+		return nil, err
+	}
+	shared.maxDepth = maxDepth
+
+	if flags.AcceptRegex != "" {
+		if shared.acceptRegex, err = regexp.Compile(flags.AcceptRegex); err != nil {
+			return nil, fmt.Errorf("invalid --accept-regex: %v", err)
+		}
+	}
+	if flags.RejectRegex != "" {
+		if shared.rejectRegex, err = regexp.Compile(flags.RejectRegex); err != nil {
+			return nil, fmt.Errorf("invalid --reject-regex: %v", err)
+		}
+	}
+
+	return shared, nil
+}
+
+// applyMonthlyQuota refuses to run once the monthly quota is used up and
+// otherwise caps the download quota of this run to what is left of it.
+func (s *sharedSettings) applyMonthlyQuota(flags *config.Flags) error {
+	limit, err := utils.ParseSize(flags.MonthlyQuota)
+	if err != nil {
+		return fmt.Errorf("invalid monthly quota: %v", err)
+	}
+
+	s.historyFile = flags.HistoryFile
+	if s.historyFile == "" {
+		if s.historyFile, err = history.DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	used, err := history.MonthUsage(s.historyFile, time.Now())
+	if err != nil {
+		return err
+	}
+	remaining := limit - used
+	if remaining <= 0 {
+		return fmt.Errorf("monthly quota of %s exhausted (%s used this month)", utils.FormatBytes(limit), utils.FormatBytes(used))
+	}
+
+	s.monthlyQuota = limit
+	if s.quota == nil || remaining < s.quota.Limit() {
+		s.quota = utils.NewQuota(remaining)
+	}
+	return nil
+}
+
+// recordUsage adds the data transferred by this run to the history file.
+func (s *sharedSettings) recordUsage() {
+	if s.monthlyQuota == 0 || s.quota.Used() == 0 {
+		return
+	}
+	now := time.Now()
+	if err := history.Record(s.historyFile, s.quota.Used(), now); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if used, err := history.MonthUsage(s.historyFile, now); err == nil {
+		fmt.Printf("monthly usage: %s of %s\n", utils.FormatBytes(used), utils.FormatBytes(s.monthlyQuota))
+	}
+}
+
+// newHTTPClient builds the HTTP client shared by all modes.
+func newHTTPClient(flags *config.Flags) (*http.Client, error) {
+	cfg := httpclient.Config{
+		ServerResponse: flags.ServerResponse,
+		Family:         flags.InetFamily,
+		PreferFamily:   flags.PreferFamily,
+		TLS: httpclient.TLSConfig{
+			Insecure:      flags.NoCheckCertificate,
+			CACertificate: flags.CACertificate,
+			Certificate:   flags.Certificate,
+			PrivateKey:    flags.PrivateKey,
+			MinVersion:    flags.SecureProtocol,
+			Pins:          flags.PinSHA256,
+			OCSPStaple:    flags.OCSPStaple,
+		},
+		DisableHTTP2: !flags.HTTP2,
+		EnableHTTP3:  flags.HTTP3,
+
+		AuthNegotiate: flags.AuthNegotiate,
+		Compression:   flags.Compression,
+
+		MaxRedirect: flags.MaxRedirect,
+
+		MaxIdleConnsPerHost: flags.MaxIdlePerHost,
+		DisableKeepAlives:   flags.NoKeepAlive,
+		ConnectTimeout:      time.Duration(flags.ConnectTimeout * float64(time.Second)),
+		ResponseTimeout:     time.Duration(flags.ResponseTimeout * float64(time.Second)),
+
+		CacheDir: flags.CacheDir,
+
+		MaxRPS:        flags.MaxRPS,
+		MaxRPSPerHost: flags.MaxRPSPerHost,
+		Wait:          time.Duration(flags.Wait * float64(time.Second)),
+		RandomWait:    flags.RandomWait,
+
+		AutoConcurrency:      flags.AutoConcurrency,
+		MaxConcurrentPerHost: flags.MaxConcurrentPerHost,
+
+		SafeMode: flags.SafeMode,
+
+		RecordDir: flags.RecordDir,
+		ReplayDir: flags.ReplayDir,
+
+		WARCFile: flags.WarcFile,
+	}
+	if cfg.WARCFile != "" {
+		cfg.WARCFile = httpclient.WARCPath(cfg.WARCFile, !flags.NoWarcGzip)
+	}
+	for _, dir := range []*string{&cfg.CacheDir, &cfg.RecordDir, &cfg.ReplayDir, &cfg.WARCFile} {
+		if *dir == "" {
+			continue
+		}
+		var err error
+		if *dir, err = expandPath(*dir); err != nil {
+			return nil, err
+		}
+	}
+	for _, section := range flags.Sections {
+		override, err := hostOverride(section, cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Overrides = append(cfg.Overrides, override)
+	}
+	if flags.Mirror && flags.RateLimit != "" {
+		// Downloads limit each file as they write it; a mirror as a whole.
+		limit, err := utils.ParseRateLimit(flags.RateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --rate-limit %q: %v", flags.RateLimit, err)
+		}
+		cfg.RateLimit = limit
+	}
+	if flags.ExtractLinksOnly {
+		// Keep stdout free for the extracted links.
+		cfg.Log = os.Stderr
+	}
+	return httpclient.New(cfg)
+}
+
+// hostOverride converts a section of the config file to the client's
+// override. Its TLS options are added to the shared ones.
+func hostOverride(section config.Section, shared httpclient.TLSConfig) (httpclient.Override, error) {
+	override := httpclient.Override{
+		Host:     section.Host,
+		URL:      section.URL,
+		Headers:  section.Headers,
+		User:     section.User,
+		Password: section.Password,
+		MaxRPS:   section.MaxRPS,
+	}
+	for _, header := range section.Headers {
+		if name, _, found := strings.Cut(header, ":"); !found || strings.TrimSpace(name) == "" {
+			return override, fmt.Errorf("invalid header %q, expected \"Name: value\"", header)
+		}
+	}
+	if section.RateLimit != "" {
+		limit, err := utils.ParseRateLimit(section.RateLimit)
+		if err != nil || limit <= 0 {
+			return override, fmt.Errorf("invalid rate limit %q in config file", section.RateLimit)
+		}
+		override.RateLimit = limit
+	}
+	if section.HasTLS() {
+		tls := shared
+		tls.Insecure = tls.Insecure || section.NoCheckCertificate
+		if section.CACertificate != "" {
+			tls.CACertificate = section.CACertificate
+		}
+		if section.Certificate != "" {
+			tls.Certificate, tls.PrivateKey = section.Certificate, section.PrivateKey
+		} else if section.PrivateKey != "" {
+			tls.PrivateKey = section.PrivateKey
+		}
+		if section.SecureProtocol != "" {
+			tls.MinVersion = section.SecureProtocol
+		}
+		override.TLS = &tls
+	}
+	return override, nil
+}
+
+// printResumeHint prints the command that picks up an interrupted download:
+// the same one with -c, which resumes the partial files and skips those
+// already complete. A batch with a state file resumes by running it again.
+func printResumeHint(flags *config.Flags) {
+	if flags.OutputFile == "-" {
+		return // A stream to stdout can't be resumed
+	}
+	args := os.Args[1:]
+	if !flags.Continue && flags.StateFile == "" {
+		args = append([]string{"-c"}, args...)
+	}
+	command := shellQuote(os.Args[0])
+	for _, arg := range args {
+		command += " " + shellQuote(arg)
+	}
+	if flags.StateFile != "" {
+		fmt.Printf("Progress is recorded in %s, to resume run the same command:\n  %s\n", flags.StateFile, command)
+		return
+	}
+	fmt.Printf("To resume, run:\n  %s\n", command)
+}
+
+// printMirrorResumeHint prints the command that resumes an interrupted
+// mirror from its saved frontier: the same one with --continue-mirror.
+func printMirrorResumeHint(flags *config.Flags) {
+	args := os.Args[1:]
+	if !flags.ContinueMirror {
+		args = append([]string{"--continue-mirror"}, args...)
+	}
+	command := shellQuote(os.Args[0])
+	for _, arg := range args {
+		command += " " + shellQuote(arg)
+	}
+	fmt.Printf("To resume, run:\n  %s\n", command)
+}
+
+// shellQuote quotes an argument for a POSIX shell, unless it is safe as is.
+func shellQuote(arg string) string {
+	safe := arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@%+", r))
+	}) < 0
+	if safe {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// downloadOptions builds the download settings from the parsed command-line flags.
+func downloadOptions(flags *config.Flags, shared *sharedSettings) download.Options {
+	// Like GNU wget, an explicit -O name is overwritten rather than numbered.
+	collision := flags.Collision
+	if flags.OutputFile != "" && !flags.NoClobber {
+		collision = download.CollisionOverwrite
+	}
+
+	return download.Options{
+		OutputFile: flags.OutputFile,
+		OutputDir:  flags.OutputDir,
+		RateLimit:  flags.RateLimit,
+		Background: flags.Background,
+		Method:     flags.Method,
+		PostData:   flags.PostData,
+		BodyFile:   flags.BodyFile,
+		Headers:    flags.Headers,
+
+		ContentDisposition: flags.ContentDisposition,
+		NewerThan:          shared.newerThan,
+		Timestamping:       flags.Timestamping,
+		Collision:          collision,
+		Checksum:           flags.Checksum,
+		TrustServerNames:   flags.TrustServerNames,
+		Exec:               flags.Exec,
+		MaxConcurrent:      flags.MaxConcurrent,
+		RelayTo:            flags.RelayTo,
+		ProgressMode:       flags.Progress,
+		Continue:           flags.Continue,
+		Sparse:             flags.Sparse,
+		StateFile:          flags.StateFile,
+		URLDB:              flags.URLDB,
+		StripTracking:      flags.StripTracking,
+		ReportFile:         flags.ReportFile,
+		TempDir:            flags.TempDir,
+		Fsync:              flags.Fsync,
+		Direct:             flags.Direct,
+
+		Quota:  shared.quota,
+		Client: shared.client,
+	}
+}
+
+// inputEntries returns the downloads listed by the input file (-i) and the
+// pages of the --input-sitemap, each page once.
+func inputEntries(flags *config.Flags, shared *sharedSettings) ([]download.Entry, error) {
+	var entries []download.Entry
+	if flags.InputFile != "" {
+		var err error
+		if entries, err = download.ReadEntriesFromFile(flags.InputFile); err != nil {
+			return nil, err
+		}
+	}
+	if flags.InputSitemap != "" {
+		pages, err := sitemap.Fetch(shared.client, flags.InputSitemap)
+		if err != nil {
+			return nil, err
+		}
+		if len(pages) == 0 {
+			return nil, fmt.Errorf("no URLs found in sitemap %s", flags.InputSitemap)
+		}
+		seen := make(map[string]bool)
+		for _, page := range pages {
+			if seen[page.Loc] {
+				continue
+			}
+			seen[page.Loc] = true
+			entries = append(entries, download.Entry{URL: page.Loc})
+		}
+	}
+	return entries, nil
+}
+
+// inputURLs returns the URLs of the input file and sitemap when given, and
+// the URL arguments otherwise.
+func inputURLs(flags *config.Flags, shared *sharedSettings) ([]string, error) {
+	if flags.InputFile == "" && flags.InputSitemap == "" {
+		return flags.URLs, nil
+	}
+	entries, err := inputEntries(flags, shared)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(entries))
+	for i, entry := range entries {
+		urls[i] = entry.URL
+	}
+	return urls, nil
+}
+
+// extractLinks crawls the URL argument like mirror mode, writing the discovered
+// URLs to stdout or the --links-output file instead of downloading them.
+func extractLinks(flags *config.Flags, shared *sharedSettings) error {
+	if len(flags.URLs) != 1 {
+		return fmt.Errorf("link extraction requires exactly one URL")
+	}
+
+	params := mirror.GetMirrorParams(flags.URLs[0], "", false, flags.RejectTypes, flags.ExcludePaths)
+	if params == nil {
+		return fmt.Errorf("failed to create mirror options")
+	}
+	params.Client = shared.client
+	params.MaxDepth = shared.maxDepth
+	params.MaxConcurrent = flags.ConcurrentRequests
+	params.StripQueryParams = flags.StripQueryParams
+	params.KeepQueryParams = flags.KeepQueryParams
+	params.StripTracking = flags.StripTracking
+	params.NoRobots = flags.NoRobots
+	params.IgnoreNofollow = flags.IgnoreNofollow
+	params.NoParent = flags.NoParent
+	params.AcceptTypes = flags.AcceptTypes
+	params.AcceptRegex = shared.acceptRegex
+	params.RejectRegex = shared.rejectRegex
+	params.SpanHosts = flags.SpanHosts
+	params.Domains = flags.Domains
+	params.ExcludeDomains = flags.ExcludeDomains
+	params.ScanScripts = flags.ScanScripts
+	params.UseDynamic = flags.UseDynamic
+	params.ExtractOnly = true
+	params.LinkExts = flags.LinkExts
+	params.Log = os.Stderr
+
+	if flags.LinkRegex != "" {
+		pattern, err := regexp.Compile(flags.LinkRegex)
+		if err != nil {
+			return fmt.Errorf("invalid --link-regex: %v", err)
+		}
+		params.LinkPattern = pattern
+	}
+
+	if flags.LinksOutput != "" {
+		file, err := os.Create(flags.LinksOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		params.LinkOutput = file
+	}
+
+	return params.Mirror()
+}
+
+// saveSingleFile saves the page of the URL argument as one self-contained
+// file, named after the URL unless -O gives a name.
+func saveSingleFile(ctx context.Context, flags *config.Flags, shared *sharedSettings) error {
+	if len(flags.URLs) != 1 {
+		return errors.New("single file mode requires exactly one URL")
+	}
+	params := mirror.GetMirrorParams(flags.URLs[0], flags.OutputDir, false, nil, nil)
+	if params == nil {
+		return errors.New("failed to create mirror options")
+	}
+	params.Context = ctx
+	params.Client = shared.client
+	params.UseDynamic = flags.UseDynamic
+	params.ConsentBypass = flags.ConsentBypass
+	if flags.MaxFileSize != "" {
+		size, err := utils.ParseSize(flags.MaxFileSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-file-size: %v", err)
+		}
+		params.MaxFileSize = size
+	}
+
+	dir, err := expandPath(flags.OutputDir)
+	if err != nil {
+		return err
+	}
+	name := flags.OutputFile
+	if name == "-" {
+		return errors.New("--single-file can't write to standard output")
+	}
+	if name == "" {
+		name = mirror.SingleFileName(params.URL)
+	}
+	return params.SaveSingleFile(filepath.Join(dir, name))
+}
+
+// runServe serves a mirror over HTTP until Ctrl-C (wget serve <mirror-dir>).
+func runServe(args []string) {
+	flags := config.InitServeFlags(args)
+	if flags == nil {
+		exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := mirror.Serve(ctx, flags.Dir, flags.Listen, os.Stdout); err != nil {
+		fmt.Println("Error:", err)
+		exit(1)
+	}
+}
+
 func main() {
+    defer runExitHooks()
+
+    if len(os.Args) > 1 && os.Args[1] == "serve" {
+        runServe(os.Args[2:])
+        return
+    }
+
     // Initialize flags and parse command-line arguments
     flags := config.InitFlags()
    // flag.Parse()
+    if flags == nil {
+        exit(1)
+    }
+
+    shared, err := parseSharedSettings(flags)
+    if err != nil {
+        fmt.Println("Error:", err)
+        exit(1)
+    }
+
+    // The client limits the requests to each host, the workers only bound the total
+    if flags.AutoConcurrency {
+        flags.MaxConcurrent = httpclient.MaxAutoConcurrency
+        flags.ConcurrentRequests = httpclient.MaxAutoConcurrency
+    }
+
+    // With -O -, stdout carries the downloaded data, so progress and messages go to stderr
+    stdout := os.Stdout
+    if flags.OutputFile == "-" {
+        os.Stdout = os.Stderr
+    }
     
-    // If background download flag is set, redirect output to a log file
+    // In background mode, run again detached from the terminal and leave the work to that copy
     if flags.Background {
-        logFile, err := os.Create("wget-log") // Create a log file
-        if err != nil {
-            fmt.Println("Error creating log file:", err)
+        if !background.IsChild() {
+            pid, logName, err := background.Start("wget-log", flags.PIDFile)
+            if err != nil {
+                fmt.Println("Error:", err)
+                exit(1)
+            }
+            fmt.Printf("Continuing in background, pid %d.\n", pid)
+            fmt.Printf("Output will be written to '%s'.\n", logName)
             return
         }
-        defer func() {
-            closeErr := logFile.Close()
-            if closeErr != nil {
-                fmt.Println("Error closing log file:", closeErr)
-            }
-        }()
-        fmt.Println("Output will be written to 'wget-log'.")
+        // Output already goes to the log; keep going if a hangup is sent anyway
+        signal.Ignore(syscall.SIGHUP)
+        atExit(func() { background.RemovePIDFile(flags.PIDFile) })
+    }
+
+    // The dashboard takes over the terminal; everything else printed goes to its log pane
+    var dashboard *tui.Dashboard
+    if flags.TUI {
+        if dashboard, err = tui.New(os.Stdin, os.Stdout); err != nil {
+            fmt.Println("Error:", err)
+            exit(1)
+        }
+        atExit(dashboard.Close)
+        os.Stdout = dashboard.Output()
+        os.Stderr = dashboard.Output()
+    }
 
-        os.Stdout = logFile // Redirect stdout to log file
-        os.Stderr = logFile // Redirect stderr to log file
+    // Created after the output redirection so header dumps end up in the log
+    if shared.client, err = newHTTPClient(flags); err != nil {
+        fmt.Println("Error:", err)
+        exit(1)
+    }
+    // A hook rather than a defer, so failed and interrupted runs are counted
+    // too. Dry runs leave the history file alone, as they write nothing else.
+    if !flags.DryRun {
+        atExit(shared.recordUsage)
     }
     
     
+    // Stop downloads (and spider checks) cleanly on Ctrl-C or SIGTERM, keeping the partial files
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    // If spider flag is set, only check the URL arguments (or the URLs of the input file)
+    if flags.Spider {
+        urls, err := inputURLs(flags, shared)
+        if err != nil {
+            fmt.Println("Error reading URLs:", err)
+            exit(1)
+        }
+        if err := download.SpiderContext(ctx, urls, downloadOptions(flags, shared)); err != nil {
+            exit(exitCode(err))
+        }
+        return
+    }
+
+    // If warm flag is set without --mirror, fetch the URLs to fill the caches in front of them
+    if flags.Warm && !flags.Mirror {
+        urls, err := inputURLs(flags, shared)
+        if err != nil {
+            fmt.Println("Error reading URLs:", err)
+            exit(1)
+        }
+        if err := download.WarmContext(ctx, urls, downloadOptions(flags, shared)); err != nil {
+            fmt.Println("Error warming caches:", err)
+            exit(exitCode(err))
+        }
+        return
+    }
+
+    // With the dashboard, download the URLs of the input file (or the URL arguments) as one batch
+    if dashboard != nil {
+        entries := download.EntriesForURLs(flags.URLs)
+        if flags.InputFile != "" || flags.InputSitemap != "" {
+            if entries, err = inputEntries(flags, shared); err != nil {
+                fmt.Println("Error reading URLs:", err)
+                exit(1)
+            }
+        }
+        opts := downloadOptions(flags, shared)
+        opts.OutputFile = ""
+        if err := dashboard.Run(ctx, entries, opts); err != nil {
+            fmt.Println("Error downloading multiple files:", err)
+            if errors.Is(err, download.ErrInterrupted) {
+                printResumeHint(flags)
+            }
+            exit(exitCode(err))
+        }
+        return
+    }
+
         // If input file is provided, read URLs and initiate downloading multiple files
-        if flags.InputFile != "" {
-            urls, err := download.ReadURLsFromFile(flags.InputFile) // Correct call
+        if flags.InputFile != "" || flags.InputSitemap != "" {
+            entries, err := inputEntries(flags, shared) // Plain URL list, CSV, JSON or sitemap pages
             if err != nil {
-                fmt.Println("Error reading URLs from file:", err)
-                os.Exit(1)
+                fmt.Println("Error reading URLs:", err)
+                exit(1)
             }
-            download.DownloadMultipleFiles(urls, flags.OutputDir, flags.RateLimit, flags.Background)
-            if err != nil {
+            opts := downloadOptions(flags, shared)
+            opts.OutputFile = ""
+            if err := download.DownloadEntriesContext(ctx, entries, opts); err != nil {
                 fmt.Println("Error downloading multiple files:", err)
+                if errors.Is(err, download.ErrInterrupted) {
+                    printResumeHint(flags)
+                }
+                exit(exitCode(err))
             }
             return
         }
+    // If listing flag is set, download the directory listing specified by the URL argument
+    if flags.Listing {
+        if len(flags.URLs) != 1 {
+            fmt.Println("Listing mode requires exactly one URL")
+            exit(1)
+        }
+        if err := download.DownloadListingContext(ctx, flags.URLs[0], downloadOptions(flags, shared)); err != nil {
+            fmt.Printf("listing download failed: %v\n", err)
+            if errors.Is(err, download.ErrInterrupted) {
+                printResumeHint(flags)
+                exit(exitInterrupted)
+            }
+        }
+        return
+    }
+    // If extract-links-only flag is set, crawl the URL argument and only report the links found
+    if flags.ExtractLinksOnly {
+        stop() // The crawler can't be interrupted cleanly yet, keep the default signal handling
+        if err := extractLinks(flags, shared); err != nil {
+            fmt.Fprintf(os.Stderr, "link extraction failed: %v\n", err)
+            exit(1)
+        }
+        return
+    }
+    // If single-file flag is set, save the page of the URL argument with its resources inlined
+    if flags.SingleFile {
+        if err := saveSingleFile(ctx, flags, shared); err != nil {
+            fmt.Println("Error:", err)
+            exit(exitCode(err))
+        }
+        return
+    }
     // If mirror flag is set, mirror the website specified by the URL argument
     if flags.Mirror {
-
         if len(flags.URLs) != 1 {
             fmt.Println("Mirror mode requires exactly one URL")
-            os.Exit(1)
+            exit(1)
         }
         
         // Set output directory
@@ -72,7 +722,7 @@ func main() {
 		if flags.OutputDir != "" {
 			if expanded, err := expandPath(flags.OutputDir); err != nil {
                 fmt.Printf("error: %v\n", err)
-				os.Exit(1) 
+				exit(1) 
 			} else {
 				outputDir = expanded
 			}
@@ -82,14 +732,98 @@ func main() {
 		MirrorParams := mirror.GetMirrorParams(flags.URLs[0], outputDir, flags.ConvertLinks, flags.RejectTypes, flags.ExcludePaths)
 		if MirrorParams == nil {
             fmt.Printf("failed to create mirror options\n")
-			os.Exit(1)
+			exit(1)
 		}
+		MirrorParams.NewerThan = shared.newerThan
+		MirrorParams.MaxDepth = shared.maxDepth
+		MirrorParams.MaxConcurrent = flags.ConcurrentRequests
+
+		depthRules, err := mirror.ParseDepthRules(flags.DepthRules)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			exit(1)
+		}
+		if flags.PageRequisites {
+			mirror.AddPageRequisites(depthRules)
+		}
+		MirrorParams.DepthRules = depthRules
+
+		restrictions, err := mirror.ParseRestrictFileNames(flags.RestrictFileNames)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			exit(1)
+		}
+		MirrorParams.RestrictFileNames = restrictions
+		MirrorParams.NoHostDirectories = flags.NoHostDirectories
+		MirrorParams.CutDirs = flags.CutDirs
+		MirrorParams.NoDirectories = flags.NoDirectories
+
+		transforms, err := mirror.ParseTransforms(flags.Transforms)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			exit(1)
+		}
+		MirrorParams.Transforms = transforms
+		MirrorParams.TransformExec = flags.TransformExec
+		MirrorParams.ConsentBypass = flags.ConsentBypass
+		MirrorParams.StripQueryParams = flags.StripQueryParams
+		MirrorParams.KeepQueryParams = flags.KeepQueryParams
+		MirrorParams.StripTracking = flags.StripTracking
+		MirrorParams.NoRobots = flags.NoRobots
+		MirrorParams.IgnoreNofollow = flags.IgnoreNofollow
+		MirrorParams.NoParent = flags.NoParent
+		MirrorParams.AcceptTypes = flags.AcceptTypes
+		MirrorParams.AcceptRegex = shared.acceptRegex
+		MirrorParams.RejectRegex = shared.rejectRegex
+		MirrorParams.SpanHosts = flags.SpanHosts
+		MirrorParams.Domains = flags.Domains
+		MirrorParams.ExcludeDomains = flags.ExcludeDomains
+		MirrorParams.ScanScripts = flags.ScanScripts
+		MirrorParams.UseDynamic = flags.UseDynamic
+		MirrorParams.AdjustExtension = flags.AdjustExt
+		MirrorParams.BackupConverted = flags.BackupOrig
+		MirrorParams.Incremental = flags.Incremental
+		MirrorParams.ContinueMirror = flags.ContinueMirror
+		MirrorParams.Context = ctx
+		MirrorParams.ReportFile = flags.ReportFile
+		MirrorParams.WARCOnly = flags.WarcOnly
+		if flags.MaxFileSize != "" {
+			if MirrorParams.MaxFileSize, err = utils.ParseSize(flags.MaxFileSize); err != nil {
+				fmt.Printf("error: invalid --max-file-size: %v\n", err)
+				exit(1)
+			}
+		}
+		if flags.MaxTotalSize != "" {
+			if MirrorParams.MaxTotalSize, err = utils.ParseSize(flags.MaxTotalSize); err != nil {
+				fmt.Printf("error: invalid --max-total-size: %v\n", err)
+				exit(1)
+			}
+		}
+		MirrorParams.Dedup = flags.Dedup
+		MirrorParams.ArchiveOutput = flags.ArchiveOutput
+		MirrorParams.ArchiveOnly = flags.ArchiveOnly
+		MirrorParams.DryRun = flags.DryRun
+		MirrorParams.Timestamping = flags.Timestamping
+		MirrorParams.Conflict = flags.Conflict
+		MirrorParams.Quota = shared.quota
+		MirrorParams.Client = shared.client
+		MirrorParams.AtomicPublish = flags.AtomicPublish
+		MirrorParams.KeepSnapshots = flags.KeepSnapshots
+		MirrorParams.WarmOnly = flags.Warm
 
 		// Start mirroring
-		fmt.Printf("Starting mirror of %s\n", flags.URLs[0])
-		fmt.Printf("Output directory: %s\n", outputDir)
+		if !flags.Warm && !flags.DryRun {
+			fmt.Printf("Starting mirror of %s\n", flags.URLs[0])
+			fmt.Printf("Output directory: %s\n", outputDir)
+		}
 
 		if err := MirrorParams.Mirror(); err != nil {
+            if errors.Is(err, download.ErrInterrupted) {
+                if !flags.DryRun {
+                    printMirrorResumeHint(flags)
+                }
+                exit(exitInterrupted)
+            }
             fmt.Printf("mirroring failed: %v\n", err)
             return
 			//os.Exit(1) 
@@ -104,8 +838,16 @@ func main() {
     }
     fileURL := flags.URLs[0]
    
-    if err := download.DownloadFile(fileURL, flags.OutputFile, flags.OutputDir, flags.RateLimit , flags.Background); err != nil {
+    opts := downloadOptions(flags, shared)
+    if flags.OutputFile == "-" {
+        opts.Output = stdout
+    }
+    opts.Sources = flags.AltURLs
+    if err := download.DownloadFileContext(ctx, fileURL, opts); err != nil {
         fmt.Printf("download failed: %v\n", err)
-        return 
+        if errors.Is(err, download.ErrInterrupted) {
+            printResumeHint(flags)
+        }
+        exit(exitCode(err))
     }
 }
@@ -0,0 +1,228 @@
+package mirror
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wget/utils"
+)
+
+// archiveStateFiles are the files the crawl keeps for its next run, left
+// out of archives.
+var archiveStateFiles = map[string]bool{
+	frontierName:   true,
+	manifestName:   true,
+	validatorsName: true,
+}
+
+// archiveWorkDir is the directory in the output directory --archive-only
+// mirrors into, removed once the crawl is complete and archived. An
+// interrupted crawl leaves it, with its frontier, for --continue-mirror.
+const archiveWorkDir = ".wget-archive"
+
+// crawlArchived mirrors the site with crawl and writes the tree to
+// ArchiveOutput. With ArchiveOnly, the files are only kept in the archive.
+func (m *MirrorParams) crawlArchived(crawl func() error) error {
+	dir := m.OutputDir
+	if m.AtomicPublish {
+		dir = filepath.Join(m.OutputDir, currentLinkName)
+	}
+	if m.ArchiveOnly {
+		dir = filepath.Join(m.OutputDir, archiveWorkDir)
+		if !m.ContinueMirror {
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("failed to clear %s: %v", dir, err)
+			}
+		}
+		m.OutputDir = dir
+	}
+
+	if err := crawl(); err != nil {
+		return err
+	}
+	files, size, err := writeArchive(m.ArchiveOutput, dir)
+	if err != nil {
+		return err
+	}
+	m.logf("Archived %d files (%s) to %s\n", files, utils.FormatBytes(size), m.ArchiveOutput)
+	if m.ArchiveOnly && !m.budgetSpent() {
+		os.RemoveAll(dir)
+	}
+	return nil
+}
+
+// writeArchive writes the files below dir to an archive at path, a zip
+// file when it ends with .zip and a tar.gz otherwise, streaming each file
+// into it. It returns the number of files and their size. The archive is
+// written under a temporary name and renamed when complete. Symbolic links
+// are kept as links in tar archives; zip archives hold the content they
+// point at.
+func writeArchive(path, dir string) (files int, size int64, err error) {
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	// The "current" symlink of --atomic is archived as the snapshot it points at
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return 0, 0, fmt.Errorf("failed to write archive %s: %v", path, err)
+	}
+	// The archive may be written inside the tree it archives
+	skip := make(map[string]bool)
+	for _, p := range []string{path, tmp} {
+		if abs, err := filepath.Abs(p); err == nil {
+			skip[abs] = true
+		}
+	}
+
+	var w archiveWriter
+	if strings.HasSuffix(path, ".zip") {
+		w = &zipArchive{zw: zip.NewWriter(out)}
+	} else {
+		gz := gzip.NewWriter(out)
+		w = &tarArchive{gz: gz, tw: tar.NewWriter(gz)}
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if abs, err := filepath.Abs(p); err == nil && skip[abs] {
+			return nil
+		}
+		if d.IsDir() && rel == archiveWorkDir {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && archiveStateFiles[rel] {
+			return nil
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		n, err := w.add(p, filepath.ToSlash(rel), info)
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %v", p, err)
+		}
+		if !info.IsDir() {
+			files++
+			size += n
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.close()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write archive %s: %v", path, err)
+	}
+	return files, size, nil
+}
+
+// archiveWriter adds files to an archive.
+type archiveWriter interface {
+	// add adds the file at path under name, returning the bytes of content
+	// written.
+	add(path, name string, info fs.FileInfo) (int64, error)
+	close() error
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) add(path, name string, info fs.FileInfo) (int64, error) {
+	if info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if info, err = os.Stat(path); err != nil {
+			return 0, err
+		}
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return 0, err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	} else {
+		header.Method = zip.Deflate
+	}
+	w, err := a.zw.CreateHeader(header)
+	if err != nil || info.IsDir() {
+		return 0, err
+	}
+	return copyFile(w, path)
+}
+
+func (a *zipArchive) close() error {
+	return a.zw.Close()
+}
+
+type tarArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarArchive) add(path, name string, info fs.FileInfo) (int64, error) {
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return 0, err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return 0, err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := a.tw.WriteHeader(header); err != nil || !info.Mode().IsRegular() {
+		return 0, err
+	}
+	return copyFile(a.tw, path)
+}
+
+func (a *tarArchive) close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// copyFile copies the content of the file at path to w.
+func copyFile(w io.Writer, path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return io.Copy(w, file)
+}
@@ -0,0 +1,53 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+)
+
+// Policies for mirror target files that already exist from a prior run.
+const (
+	ConflictOverwrite = "overwrite" // Replace the existing file (default)
+	ConflictSkip      = "skip"      // Keep the existing file and don't fetch it again
+	ConflictRename    = "rename"    // Move the existing file aside as file.1, file.2, ...
+	ConflictNewer     = "newer"     // Only replace the file if the server has a newer version
+)
+
+// fileExists reports whether a regular file exists at path.
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// moveExistingFile moves the file left at outputPath by a previous run
+// aside with --conflict=rename. It reports whether the download may go on.
+func (m *MirrorParams) moveExistingFile(outputPath string) bool {
+	if m.Conflict != ConflictRename {
+		return true
+	}
+	backup, err := backupExistingFile(outputPath)
+	if err != nil {
+		m.logf("failed to back up %s: %v\n", outputPath, err)
+		return false
+	}
+	if backup != "" {
+		m.logf("Moved existing file %s to %s\n", outputPath, backup)
+	}
+	return true
+}
+
+// backupExistingFile moves an existing file at path to the first free
+// numbered name (path.1, path.2, ...) so a new download can take its place.
+// It returns the backup name, or an empty string if there was nothing to move.
+func backupExistingFile(path string) (string, error) {
+	if !fileExists(path) {
+		return "", nil
+	}
+
+	for i := 1; ; i++ {
+		backup := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			return backup, os.Rename(path, backup)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package mirror
+
+import (
+	"net/http"
+	"time"
+)
+
+// consentCookies record that the visitor already answered the cookie dialog
+// of the common consent managers, so the dialog isn't shown. Where the
+// format records a choice, it is "necessary cookies only".
+var consentCookies = []http.Cookie{
+	// Osano cookieconsent
+	{Name: "cookieconsent_status", Value: "dismiss"},
+	// Cookiebot
+	{Name: "CookieConsent", Value: "{stamp:%27-1%27%2Cnecessary:true%2Cpreferences:false%2Cstatistics:false%2Cmarketing:false%2Cmethod:%27explicit%27%2Cver:1}"},
+	// OneTrust
+	{Name: "OptanonAlertBoxClosed", Value: time.Now().UTC().Format(time.RFC3339)},
+	// CookieYes / GDPR Cookie Consent
+	{Name: "cookielawinfo-checkbox-necessary", Value: "yes"},
+	{Name: "viewed_cookie_policy", Value: "yes"},
+	// Complianz
+	{Name: "cmplz_banner-status", Value: "dismissed"},
+	// Cookie Notice
+	{Name: "cookie_notice_accepted", Value: "true"},
+	// GDPR Cookie Compliance
+	{Name: "moove_gdpr_popup", Value: "%7B%22strict%22%3A%221%22%7D"},
+	// Google, "reject all"
+	{Name: "CONSENT", Value: "PENDING+999"},
+	{Name: "SOCS", Value: "CAE"},
+}
+
+// consentSelectors match the overlays of the common consent managers, which
+// are removed from saved pages when the cookies didn't prevent them.
+var consentSelectors = []string{
+	"#onetrust-consent-sdk",
+	"#onetrust-banner-sdk",
+	"#CybotCookiebotDialog",
+	"#CybotCookiebotDialogBodyUnderlay",
+	"div.cc-window",
+	"div.cc-banner",
+	"#cookie-law-info-bar",
+	"#cookie-law-info-again",
+	"div.cmplz-cookiebanner",
+	"#cookie-notice",
+	"#moove_gdpr_cookie_info_bar",
+	"#usercentrics-root",
+	"#qc-cmp2-container",
+	"div.fc-consent-root",
+	"#didomi-host",
+	"#truste-consent-track",
+	"div.osano-cm-window",
+	"#cookiescript_injected",
+	"#BorlabsCookieBox",
+	"#cmpbox",
+	"#cmpbox2",
+	"div.cookie-consent",
+	"div.cookie-banner",
+	"#cookie-banner",
+	"#cookieConsent",
+}
+
+// consentTransforms are the strip rules removing the consent overlays.
+var consentTransforms = mustParseTransforms(consentSelectors)
+
+// mustParseTransforms turns selectors into strip rules, panicking on the
+// invalid selectors that can only come from a mistake in this file.
+func mustParseTransforms(selectors []string) []Transform {
+	rules := make([]string, len(selectors))
+	for i, sel := range selectors {
+		rules[i] = TransformStrip + "=" + sel
+	}
+	transforms, err := ParseTransforms(rules)
+	if err != nil {
+		panic(err)
+	}
+	return transforms
+}
+
+// addConsentCookies adds the consent cookies to a request of the crawl.
+func addConsentCookies(req *http.Request) {
+	for i := range consentCookies {
+		req.AddCookie(&consentCookies[i])
+	}
+}
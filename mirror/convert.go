@@ -0,0 +1,165 @@
+package mirror
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// origSuffix is added to the name of the backup of a file kept as
+// downloaded before its links were converted (-K).
+const origSuffix = ".orig"
+
+// localFiles collects the files saved by a crawl, so links can be converted
+// once it ends (-k): only then is it known which of the URLs a page links to
+// were saved, and under which name.
+type localFiles struct {
+	mu    sync.Mutex
+	paths map[string]string // Output path of each saved URL, by urlKey
+	pages []savedPage       // HTML pages and stylesheets saved, whose links are converted
+}
+
+// savedPage is an HTML page or stylesheet saved by the crawl.
+type savedPage struct {
+	url  *url.URL
+	path string
+	css  bool
+}
+
+// recordLocalFile notes the file a URL was saved at, when links are
+// converted.
+func (m *MirrorParams) recordLocalFile(u *url.URL, outputPath, contentType string) {
+	if !m.ConvertLinks {
+		return
+	}
+	m.files.mu.Lock()
+	defer m.files.mu.Unlock()
+	if m.files.paths == nil {
+		m.files.paths = make(map[string]string)
+	}
+	m.files.paths[m.urlKey(u)] = outputPath
+
+	isHTML := strings.Contains(contentType, "text/html")
+	if isHTML || strings.Contains(contentType, "text/css") {
+		m.files.pages = append(m.files.pages, savedPage{url: u, path: outputPath, css: !isHTML})
+	}
+}
+
+// convertLinks points the links of the pages saved by the crawl at the
+// local copies of their targets, for viewing the mirror offline. Links to
+// files that weren't saved, by this crawl or an earlier one, are made
+// absolute so they still work.
+func (m *MirrorParams) convertLinks() {
+	m.files.mu.Lock()
+	defer m.files.mu.Unlock()
+
+	converted := 0
+	for _, page := range m.files.pages {
+		info, err := os.Stat(page.path)
+		if err != nil {
+			continue
+		}
+		body, err := os.ReadFile(page.path)
+		if err != nil {
+			m.logf("failed to read %s: %v\n", page.path, err)
+			continue
+		}
+
+		link := func(val string) string {
+			return m.convertLink(page, val)
+		}
+		var rewritten []byte
+		if page.css {
+			rewritten = []byte(rewriteCSSLinks(string(body), link))
+		} else if rewritten, err = rewriteHTMLLinks(body, linkRewriter{link: link, cssLink: link}); err != nil {
+			m.logf("failed to parse HTML of %s: %v\n", page.path, err)
+			continue
+		}
+		if string(rewritten) == string(body) {
+			continue
+		}
+
+		if m.BackupConverted {
+			if err := backupOriginal(page.path, body, info); err != nil {
+				m.logf("failed to back up %s: %v\n", page.path, err)
+				continue
+			}
+		}
+		if err := os.WriteFile(page.path, rewritten, info.Mode()); err != nil {
+			m.logf("failed to write file: %v\n", err)
+			continue
+		}
+		// Keep the time set from Last-Modified for timestamping.
+		os.Chtimes(page.path, info.ModTime(), info.ModTime())
+		converted++
+	}
+	m.logf("Converted links in %d files\n", converted)
+}
+
+// backupOriginal saves body, the file at path as downloaded, as path.orig
+// with the same modification time, so -N compares the server's file with it
+// rather than with the converted copy.
+func backupOriginal(path string, body []byte, info os.FileInfo) error {
+	backup := path + origSuffix
+	if err := os.WriteFile(backup, body, info.Mode()); err != nil {
+		return err
+	}
+	return os.Chtimes(backup, info.ModTime(), info.ModTime())
+}
+
+// originalPath returns the file holding the local copy of outputPath as it
+// was downloaded: its .orig backup with -K, when there is one.
+func (m *MirrorParams) originalPath(outputPath string) string {
+	if m.BackupConverted && fileExists(outputPath+origSuffix) {
+		return outputPath + origSuffix
+	}
+	return outputPath
+}
+
+// convertLink returns a link of a saved page as it should appear in the
+// local copy: the relative path to the local file it points to, keeping the
+// fragment, or else the absolute URL. Links that aren't http or https are
+// left alone.
+func (m *MirrorParams) convertLink(page savedPage, val string) string {
+	if val == "" || strings.HasPrefix(val, "#") {
+		return val
+	}
+	ref, err := url.Parse(strings.TrimSpace(val))
+	if err != nil {
+		return val
+	}
+	target := page.url.ResolveReference(ref)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return val
+	}
+
+	if m.hostAllowed(target.Host) {
+		if path, ok := m.localFile(target); ok {
+			dir := filepath.Dir(page.path)
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				link := localLink(rel)
+				if target.Fragment != "" {
+					link += "#" + target.EscapedFragment()
+				}
+				return link
+			}
+		}
+	}
+	if ref.IsAbs() || ref.Host != "" {
+		return val
+	}
+	return target.String()
+}
+
+// localFile returns the local file a URL was saved at, by this crawl or, when
+// the file is still there, an earlier one. The caller must hold m.files.mu.
+func (m *MirrorParams) localFile(u *url.URL) (string, bool) {
+	u = m.normalizeURL(u)
+	if path, ok := m.files.paths[m.urlKey(u)]; ok {
+		return path, true
+	}
+	path := m.outputPath(u)
+	return path, fileExists(path)
+}
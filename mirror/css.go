@@ -0,0 +1,234 @@
+package mirror
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// cssRef is a URL referenced by a stylesheet, from url() or @import.
+type cssRef struct {
+	url        string // The URL with CSS escapes decoded
+	start, end int    // Byte range of the whole reference: url(...) or the @import string
+	quote      byte   // Quote the URL was written with, 0 for an unquoted url()
+	function   bool   // Written as url(...) rather than as a bare @import string
+}
+
+// format returns the reference pointing at newURL instead, written the way
+// the original was.
+func (r cssRef) format(newURL string) string {
+	if r.quote == 0 {
+		return "url(" + escapeCSS(newURL, " \t\n\r\f()'\"\\") + ")"
+	}
+	quoted := string(r.quote) + escapeCSS(newURL, string(r.quote)+"\\\n") + string(r.quote)
+	if r.function {
+		return "url(" + quoted + ")"
+	}
+	return quoted
+}
+
+// escapeCSS escapes the special characters of s with backslashes, newlines
+// (which can't be escaped that way) as a hex escape.
+func escapeCSS(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r' || r == '\f' || r == '\t':
+			b.WriteString(`\` + strconv.FormatInt(int64(r), 16) + " ")
+		case strings.ContainsRune(special, r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// parseCSSRefs finds the URLs referenced by a stylesheet: url() values,
+// quoted or not, and the strings of @import rules. Comments and other
+// strings are skipped, so URLs in them aren't mistaken for references.
+func parseCSSRefs(css string) []cssRef {
+	var refs []cssRef
+	inImport := false // Between @import and the end of its URL
+	for i := 0; i < len(css); {
+		c := css[i]
+		switch {
+		case strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return refs
+			}
+			i += end + 4
+
+		case c == '"' || c == '\'':
+			value, end := parseCSSString(css, i)
+			if inImport {
+				refs = append(refs, cssRef{url: value, start: i, end: end, quote: c})
+				inImport = false
+			}
+			i = end
+
+		case c == '\\':
+			// An escaped character of an identifier, never a string or url( start.
+			i += 2
+
+		case c == '@' && hasPrefixFold(css[i+1:], "import") && !isCSSNameByte(byteAt(css, i+7)):
+			inImport = true
+			i += 7
+
+		case (c == 'u' || c == 'U') && hasPrefixFold(css[i:], "url(") && (i == 0 || !isCSSNameByte(css[i-1])):
+			if ref, ok := parseCSSURL(css, i); ok {
+				refs = append(refs, ref)
+				inImport = false
+				i = ref.end
+			} else {
+				i += 4
+			}
+
+		case c == ';' || c == '{' || c == '}':
+			inImport = false
+			i++
+
+		default:
+			i++
+		}
+	}
+	return refs
+}
+
+// parseCSSURL parses the url() function starting at css[start].
+func parseCSSURL(css string, start int) (cssRef, bool) {
+	i := skipCSSSpace(css, start+4)
+	ref := cssRef{start: start, function: true}
+	if i < len(css) && (css[i] == '"' || css[i] == '\'') {
+		ref.quote = css[i]
+		ref.url, i = parseCSSString(css, i)
+		i = skipCSSSpace(css, i)
+		if i >= len(css) || css[i] != ')' {
+			return cssRef{}, false
+		}
+		ref.end = i + 1
+		return ref, true
+	}
+
+	var b strings.Builder
+	for i < len(css) {
+		c := css[i]
+		switch {
+		case c == ')':
+			ref.url = b.String()
+			ref.end = i + 1
+			return ref, true
+		case c == '\\':
+			r, next := parseCSSEscape(css, i)
+			b.WriteString(r)
+			i = next
+		case isCSSSpace(c):
+			// Only spaces before the closing parenthesis are allowed.
+			i = skipCSSSpace(css, i)
+			if i >= len(css) || css[i] != ')' {
+				return cssRef{}, false
+			}
+		case c == '"' || c == '\'' || c == '(':
+			return cssRef{}, false
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return cssRef{}, false
+}
+
+// parseCSSString parses the quoted string starting at css[start], returning
+// its decoded value and the offset after the closing quote. An unescaped
+// newline or the end of the input ends it early, as in browsers.
+func parseCSSString(css string, start int) (string, int) {
+	quote := css[start]
+	var b strings.Builder
+	i := start + 1
+	for i < len(css) {
+		c := css[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1
+		case c == '\n':
+			return b.String(), i
+		case c == '\\' && i+1 < len(css) && (css[i+1] == '\n' || css[i+1] == '\r' || css[i+1] == '\f'):
+			// An escaped newline continues the string on the next line.
+			i += 2
+			if css[i-1] == '\r' && byteAt(css, i) == '\n' {
+				i++
+			}
+		case c == '\\':
+			r, next := parseCSSEscape(css, i)
+			b.WriteString(r)
+			i = next
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), i
+}
+
+// parseCSSEscape decodes the escape starting with the backslash at css[i]:
+// up to six hex digits and an optional space, or any other character as is.
+func parseCSSEscape(css string, i int) (string, int) {
+	i++
+	if i >= len(css) {
+		return "", i
+	}
+	j := i
+	for j < len(css) && j-i < 6 && isHexByte(css[j]) {
+		j++
+	}
+	if j == i {
+		r, size := utf8.DecodeRuneInString(css[i:])
+		return string(r), i + size
+	}
+	code, _ := strconv.ParseUint(css[i:j], 16, 32)
+	if code == 0 || code > utf8.MaxRune || (code >= 0xD800 && code <= 0xDFFF) {
+		code = utf8.RuneError
+	}
+	if j < len(css) && isCSSSpace(css[j]) {
+		j++
+	}
+	return string(rune(code)), j
+}
+
+func skipCSSSpace(css string, i int) int {
+	for i < len(css) && isCSSSpace(css[i]) {
+		i++
+	}
+	return i
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isHexByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// isCSSNameByte reports whether c can be part of an identifier, so "url("
+// or "@import" preceded or followed by it is part of a longer name.
+func isCSSNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c >= 0x80
+}
+
+// byteAt returns css[i], or 0 past the end.
+func byteAt(css string, i int) byte {
+	if i < len(css) {
+		return css[i]
+	}
+	return 0
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,108 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Ways duplicate files are stored with --dedup.
+const (
+	DedupHardlink = "hardlink" // Hard link duplicates to the first copy
+	DedupSymlink  = "symlink"  // Make duplicates relative symbolic links to the first copy
+)
+
+// dedupIndex maps the content of the files saved by the crawl to the first
+// file saved with it.
+type dedupIndex struct {
+	mu    sync.Mutex
+	paths map[[sha256.Size]byte]string // By SHA-256 of the content
+	files int                          // Duplicates replaced by links
+	bytes int64                        // Space the links saved
+}
+
+// dedupe replaces a file just saved by a link to an earlier file of the
+// crawl with the same content. HTML and CSS files are left alone: their
+// links are converted for their own location, which a shared copy can't be.
+func (m *MirrorParams) dedupe(outputPath, contentType string, size int64) {
+	if m.Dedup == "" || size == 0 || strings.Contains(contentType, "text/html") || strings.Contains(contentType, "text/css") {
+		return
+	}
+	sum, err := fileSum(outputPath)
+	if err != nil {
+		return
+	}
+
+	m.dedup.mu.Lock()
+	defer m.dedup.mu.Unlock()
+	if m.dedup.paths == nil {
+		m.dedup.paths = make(map[[sha256.Size]byte]string)
+	}
+	original, ok := m.dedup.paths[sum]
+	if !ok || original == outputPath {
+		m.dedup.paths[sum] = outputPath
+		return
+	}
+
+	if err := linkDuplicate(original, outputPath, m.Dedup); err != nil {
+		m.logf("Warning: failed to link %s to %s, keeping the copy: %v\n", outputPath, original, err)
+		return
+	}
+	m.dedup.files++
+	m.dedup.bytes += size
+}
+
+// linkDuplicate replaces the file at path by a link to original, through a
+// temporary name so a failure leaves the copy in place.
+func linkDuplicate(original, path, mode string) error {
+	tmp := path + ".dedup"
+	os.Remove(tmp)
+	var err error
+	if mode == DedupSymlink {
+		var target string
+		if target, err = filepath.Rel(filepath.Dir(path), original); err == nil {
+			err = os.Symlink(target, tmp)
+		}
+	} else {
+		err = os.Link(original, tmp)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// unshare removes the file a previous run left at path before it is
+// written anew, in case it is a link: writing through it would change the
+// file it shares its content with.
+func (m *MirrorParams) unshare(path string) {
+	if m.Dedup == "" {
+		return
+	}
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		os.Remove(path)
+	}
+}
+
+// fileSum returns the SHA-256 of the content of a file.
+func fileSum(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
@@ -0,0 +1,153 @@
+package mirror
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resource classes that can be given their own recursion depth.
+const (
+	ClassHTML   = "html"
+	ClassCSS    = "css"
+	ClassImage  = "image"
+	ClassScript = "script"
+	ClassFont   = "font"
+	ClassMedia  = "media"
+	ClassOther  = "other"
+)
+
+// UnlimitedDepth marks a resource class that is fetched at any depth.
+const UnlimitedDepth = -1
+
+// DefaultDepth is the number of levels of links followed without -l.
+const DefaultDepth = 5
+
+// requisiteClasses are the resource classes a saved page needs to display
+// correctly (wget's "page requisites").
+var requisiteClasses = []string{ClassCSS, ClassImage, ClassScript, ClassFont, ClassMedia}
+
+// classExtensions maps file extensions to their resource class. URLs without
+// a known extension are treated as HTML pages.
+var classExtensions = map[string]string{
+	".html": ClassHTML, ".htm": ClassHTML, ".xhtml": ClassHTML, ".php": ClassHTML, ".asp": ClassHTML, ".aspx": ClassHTML, ".jsp": ClassHTML,
+	".css": ClassCSS,
+	".png": ClassImage, ".jpg": ClassImage, ".jpeg": ClassImage, ".gif": ClassImage, ".svg": ClassImage, ".webp": ClassImage, ".ico": ClassImage, ".bmp": ClassImage, ".avif": ClassImage,
+	".js": ClassScript, ".mjs": ClassScript,
+	".woff": ClassFont, ".woff2": ClassFont, ".ttf": ClassFont, ".otf": ClassFont, ".eot": ClassFont,
+	".mp4": ClassMedia, ".webm": ClassMedia, ".ogg": ClassMedia, ".mp3": ClassMedia, ".wav": ClassMedia, ".m4a": ClassMedia, ".mov": ClassMedia,
+}
+
+// resourceClass guesses the class of a URL from its extension.
+func resourceClass(u *url.URL) string {
+	ext := strings.ToLower(filepath.Ext(u.Path))
+	if ext == "" {
+		return ClassHTML
+	}
+	if class, ok := classExtensions[ext]; ok {
+		return class
+	}
+	return ClassOther
+}
+
+// depthLimit returns the maximum recursion depth for a URL, taking the
+// per-class depth rules into account.
+func (m *MirrorParams) depthLimit(u *url.URL) int {
+	if limit, ok := m.DepthRules[resourceClass(u)]; ok {
+		return limit
+	}
+	return m.MaxDepth
+}
+
+// crawlLevel collects the links found on the pages of one level of the
+// crawl, which make up the next level. The crawl finishes a level before it
+// starts the next, so every URL is first reached by a shortest path and gets
+// its true depth, however the downloads of a level interleave.
+type crawlLevel struct {
+	depth int // Links followed from the start page to reach the URLs
+	mu    sync.Mutex
+	urls  []string
+
+	// URLs of the current level the server asked to fetch again later, and
+	// the time they may be.
+	retries []string
+	retryAt time.Time
+}
+
+// add queues a URL for the level.
+func (l *crawlLevel) add(u string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.urls = append(l.urls, u)
+}
+
+// ParseLevel parses the value of -l: a number of levels, or "inf" (or 0,
+// as in GNU wget) for no limit.
+func ParseLevel(level string) (int, error) {
+	level = strings.TrimSpace(level)
+	if level == "inf" || level == "0" {
+		return UnlimitedDepth, nil
+	}
+	depth, err := strconv.Atoi(level)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("invalid level %q, expected a number or inf", level)
+	}
+	return depth, nil
+}
+
+// ParseDepthRules parses per-class depth rules such as "html:3,image:inf",
+// where "inf" means the class is fetched at any depth.
+func ParseDepthRules(spec string) (map[string]int, error) {
+	rules := make(map[string]int)
+	if strings.TrimSpace(spec) == "" {
+		return rules, nil
+	}
+
+	for _, rule := range strings.Split(spec, ",") {
+		class, depth, found := strings.Cut(strings.TrimSpace(rule), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid depth rule %q, expected class:depth", rule)
+		}
+
+		class = strings.ToLower(strings.TrimSpace(class))
+		if !isResourceClass(class) {
+			return nil, fmt.Errorf("unknown resource class %q in depth rule", class)
+		}
+
+		depth = strings.TrimSpace(depth)
+		if depth == "inf" {
+			rules[class] = UnlimitedDepth
+			continue
+		}
+		limit, err := strconv.Atoi(depth)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid depth %q in depth rule", depth)
+		}
+		rules[class] = limit
+	}
+
+	return rules, nil
+}
+
+// AddPageRequisites makes the resources a page needs to display (CSS,
+// images, scripts, fonts and media) fetchable at any depth, unless the rules
+// already set a depth for them.
+func AddPageRequisites(rules map[string]int) {
+	for _, class := range requisiteClasses {
+		if _, ok := rules[class]; !ok {
+			rules[class] = UnlimitedDepth
+		}
+	}
+}
+
+func isResourceClass(class string) bool {
+	switch class {
+	case ClassHTML, ClassCSS, ClassImage, ClassScript, ClassFont, ClassMedia, ClassOther:
+		return true
+	}
+	return false
+}
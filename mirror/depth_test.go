@@ -0,0 +1,112 @@
+package mirror
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseDepthRules(t *testing.T) {
+	tests := []struct {
+		spec string
+		want map[string]int
+	}{
+		{"", map[string]int{}},
+		{"  ", map[string]int{}},
+		{"html:3", map[string]int{ClassHTML: 3}},
+		{"html:3,image:inf", map[string]int{ClassHTML: 3, ClassImage: UnlimitedDepth}},
+		{" CSS : 0 , font:2", map[string]int{ClassCSS: 0, ClassFont: 2}},
+		{"other:1,media:inf,script:4", map[string]int{ClassOther: 1, ClassMedia: UnlimitedDepth, ClassScript: 4}},
+	}
+	for _, tt := range tests {
+		got, err := ParseDepthRules(tt.spec)
+		if err != nil {
+			t.Errorf("ParseDepthRules(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDepthRules(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseDepthRulesErrors(t *testing.T) {
+	for _, spec := range []string{"html", "html:", "html:-1", "html:two", "video:2", ":3", "html:3,"} {
+		if rules, err := ParseDepthRules(spec); err == nil {
+			t.Errorf("ParseDepthRules(%q) = %v, want an error", spec, rules)
+		}
+	}
+}
+
+func TestDepthLimit(t *testing.T) {
+	m := &MirrorParams{
+		MaxDepth:   2,
+		DepthRules: map[string]int{ClassImage: UnlimitedDepth, ClassCSS: 0, ClassOther: 4},
+	}
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"http://example.com/", 2},                                 // Directories are pages
+		{"http://example.com/about", 2},                            // So are paths without extension
+		{"http://example.com/index.html", 2},                       // No rule for html
+		{"http://example.com/logo.PNG", UnlimitedDepth},            // Extensions are case insensitive
+		{"http://example.com/img/photo.jpg?w=200", UnlimitedDepth}, // The query doesn't count
+		{"http://example.com/style.css", 0},
+		{"http://example.com/app.js", 2},      // No rule for scripts
+		{"http://example.com/archive.zip", 4}, // Unknown extensions are "other"
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.depthLimit(u); got != tt.want {
+			t.Errorf("depthLimit(%s) = %d, want %d", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestAddPageRequisites(t *testing.T) {
+	rules := map[string]int{ClassHTML: 1, ClassImage: 3}
+	AddPageRequisites(rules)
+	want := map[string]int{
+		ClassHTML:   1, // Pages keep their depth
+		ClassImage:  3, // An explicit rule wins over -p
+		ClassCSS:    UnlimitedDepth,
+		ClassScript: UnlimitedDepth,
+		ClassFont:   UnlimitedDepth,
+		ClassMedia:  UnlimitedDepth,
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("AddPageRequisites = %v, want %v", rules, want)
+	}
+}
+
+// Links are queued against the depth of the level they are found for, not
+// a counter shared by the pages being crawled at the same time.
+func TestEnqueueDepth(t *testing.T) {
+	m := &MirrorParams{MaxDepth: 1, DepthRules: map[string]int{ClassImage: 2}}
+	page, _ := url.Parse("http://example.com/page.html")
+	image, _ := url.Parse("http://example.com/photo.png")
+
+	deep := &crawlLevel{depth: 3}
+	m.enqueue(page, deep)
+	m.enqueue(image, deep)
+	if len(deep.urls) != 0 {
+		t.Errorf("queued %v at depth 3, want nothing", deep.urls)
+	}
+
+	next := &crawlLevel{depth: 2}
+	m.enqueue(page, next)
+	m.enqueue(image, next)
+	if want := []string{image.String()}; !reflect.DeepEqual(next.urls, want) {
+		t.Errorf("queued %v at depth 2, want %v", next.urls, want)
+	}
+
+	// Queued once, however many pages link to it.
+	m.enqueue(image, next)
+	if len(next.urls) != 1 {
+		t.Errorf("queued %v, want photo.png once", next.urls)
+	}
+}
@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dryRunPlan collects the files a dry run would save.
+type dryRunPlan struct {
+	mu    sync.Mutex
+	paths map[string]string // URL of each file, by path relative to the output directory
+}
+
+// dryRun crawls the site like a mirror without writing anything: only the
+// pages that may contain links are fetched, to follow them. It prints the
+// files the mirror would save and where, the URLs it would skip and why,
+// and the broken links found.
+func (m *MirrorParams) dryRun() error {
+	m.logf("Dry run of the mirror of %s, nothing is written\n", m.URL)
+	err := m.ProcessUrlWrapper(m.URL)
+	m.printPlan()
+	return err
+}
+
+// plan records a file the mirror would save, and logs it the first time,
+// not again when a busy server has it fetched later.
+func (m *MirrorParams) plan(u *url.URL) {
+	outputPath := m.outputPath(u)
+	rel, err := filepath.Rel(m.OutputDir, outputPath)
+	if err != nil {
+		rel = outputPath
+	}
+	rel = filepath.ToSlash(rel)
+
+	m.planned.mu.Lock()
+	defer m.planned.mu.Unlock()
+	if m.planned.paths == nil {
+		m.planned.paths = make(map[string]string)
+	}
+	if _, ok := m.planned.paths[rel]; !ok {
+		m.logf("Would download: %s -> %s\n", u, outputPath)
+	}
+	m.planned.paths[rel] = u.String()
+}
+
+// printPlan prints the layout of the files the dry run found, as a tree
+// of the output directory, followed by the skipped URLs and broken links.
+// Pages that turned out broken are left out of the tree.
+func (m *MirrorParams) printPlan() {
+	rec := m.summarize()
+	broken := make(map[string]bool)
+	for _, link := range rec.Broken {
+		broken[link.URL] = true
+	}
+
+	m.planned.mu.Lock()
+	var paths []string
+	for path, u := range m.planned.paths {
+		if !broken[u] {
+			paths = append(paths, path)
+		}
+	}
+	m.planned.mu.Unlock()
+	sort.Strings(paths)
+
+	m.logf("\n%d files would be saved in %s:\n", len(paths), m.OutputDir)
+	var shown []string // Directories of the previous path
+	for _, path := range paths {
+		parts := strings.Split(path, "/")
+		dirs, name := parts[:len(parts)-1], parts[len(parts)-1]
+		common := 0
+		for common < len(dirs) && common < len(shown) && dirs[common] == shown[common] {
+			common++
+		}
+		for i := common; i < len(dirs); i++ {
+			m.logf("  %s%s/\n", strings.Repeat("  ", i), dirs[i])
+		}
+		m.logf("  %s%s\n", strings.Repeat("  ", len(dirs)), name)
+		shown = dirs
+	}
+	m.printSkipped(rec)
+}
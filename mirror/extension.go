@@ -0,0 +1,41 @@
+package mirror
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// adjustExtension returns the path an HTML page or a stylesheet is saved
+// under with -E: outputPath with ".html" or ".css" appended when it doesn't
+// already end with a matching extension, so the file opens correctly from
+// disk. Other content is saved as is.
+func adjustExtension(outputPath, contentType string) string {
+	ext := strings.ToLower(filepath.Ext(outputPath))
+	switch {
+	case strings.Contains(contentType, "text/html"):
+		if ext != ".html" && ext != ".htm" {
+			return outputPath + ".html"
+		}
+	case strings.Contains(contentType, "text/css"):
+		if ext != ".css" {
+			return outputPath + ".css"
+		}
+	}
+	return outputPath
+}
+
+// previouslyAdjusted returns the path a file was saved under with an
+// adjusted extension by an earlier run, when there is one and no file at
+// outputPath, so --conflict and timestamping find it. Otherwise it returns
+// outputPath.
+func previouslyAdjusted(outputPath string) string {
+	if fileExists(outputPath) {
+		return outputPath
+	}
+	for _, ext := range []string{".html", ".css"} {
+		if fileExists(outputPath + ext) {
+			return outputPath + ext
+		}
+	}
+	return outputPath
+}
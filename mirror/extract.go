@@ -0,0 +1,75 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// logf writes a progress message to the configured log destination.
+func (m *MirrorParams) logf(format string, args ...interface{}) {
+	fmt.Fprintf(m.logWriter(), format, args...)
+}
+
+// logWriter returns the destination of the progress messages, stdout when
+// Log is unset.
+func (m *MirrorParams) logWriter() io.Writer {
+	if m.Log == nil {
+		return os.Stdout
+	}
+	return m.Log
+}
+
+// reportLink writes a discovered URL to the link output if it passes the
+// configured regex and extension filters.
+func (m *MirrorParams) reportLink(u *url.URL) {
+	if !m.matchesLinkFilter(u) {
+		return
+	}
+
+	m.outputMutex.Lock()
+	defer m.outputMutex.Unlock()
+
+	if m.LinkOutput == nil {
+		fmt.Fprintln(os.Stdout, u.String())
+		return
+	}
+	fmt.Fprintln(m.LinkOutput, u.String())
+}
+
+// matchesLinkFilter reports whether a URL should be emitted in extract mode.
+func (m *MirrorParams) matchesLinkFilter(u *url.URL) bool {
+	if m.LinkPattern != nil && !m.LinkPattern.MatchString(u.String()) {
+		return false
+	}
+
+	if len(m.LinkExts) == 0 {
+		return true
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(u.Path)), ".")
+	for _, allowed := range m.LinkExts {
+		if strings.EqualFold(ext, strings.TrimPrefix(allowed, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayContainLinks reports whether a URL may point to an HTML page or a
+// stylesheet, or to a script with --scan-scripts, judging by its extension.
+// Other resources are never fetched when only extracting links.
+func (m *MirrorParams) mayContainLinks(u *url.URL) bool {
+	if strings.HasSuffix(u.Path, "/") || (m.ScanScripts && isScriptPath(u)) {
+		return true
+	}
+
+	switch strings.ToLower(filepath.Ext(u.Path)) {
+	case "", ".html", ".htm", ".xhtml", ".php", ".asp", ".aspx", ".jsp", ".css":
+		return true
+	}
+	return false
+}
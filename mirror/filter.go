@@ -0,0 +1,42 @@
+package mirror
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// accepted reports whether a URL passes the accept filters: -A, matching
+// its file name or extension, and --accept-regex, matching its path. A URL
+// passes filters that aren't set.
+func (m *MirrorParams) accepted(u *url.URL) bool {
+	if len(m.AcceptTypes) > 0 && !matchesType(m.AcceptTypes, u.Path) {
+		return false
+	}
+	return m.AcceptRegex == nil || m.AcceptRegex.MatchString(u.Path)
+}
+
+// rejectedByRegex reports whether --reject-regex matches the path of a URL.
+func (m *MirrorParams) rejectedByRegex(u *url.URL) bool {
+	return m.RejectRegex != nil && m.RejectRegex.MatchString(u.Path)
+}
+
+// matchesType reports whether the file name of a URL path is one of the
+// types: a file name, an extension, or a shell pattern such as "*.tar.gz".
+func matchesType(types []string, urlPath string) bool {
+	name := path.Base(urlPath)
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	for _, t := range types {
+		if strings.ContainsAny(t, "*?[") {
+			if ok, _ := path.Match(strings.ToLower(t), strings.ToLower(name)); ok {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(name, t) || (ext != "" && strings.EqualFold(ext, t)) {
+			return true
+		}
+	}
+	return false
+}
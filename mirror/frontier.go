@@ -0,0 +1,223 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// frontierName is the file in the output directory holding the state of an
+// unfinished crawl, which --continue-mirror resumes from.
+const frontierName = "wget-frontier.json"
+
+// frontierSaveInterval is how often the frontier is saved during a crawl,
+// the most work a crash loses.
+const frontierSaveInterval = 30 * time.Second
+
+// frontierRecord is the on-disk format of the frontier.
+type frontierRecord struct {
+	URL     string         `json:"url"`     // Start URL of the crawl
+	Saved   time.Time      `json:"saved"`   // When the frontier was saved
+	Depth   int            `json:"depth"`   // Depth of the pending URLs
+	Pending []string       `json:"pending"` // URLs of the level being crawled not fetched yet
+	Next    []string       `json:"next"`    // URLs queued for the next level
+	Visited []string       `json:"visited"` // urlKey of every URL queued so far
+	Files   []frontierFile `json:"files,omitempty"`
+}
+
+// frontierFile is a file saved before the interruption, whose links are
+// still to be converted (-k).
+type frontierFile struct {
+	URL  string `json:"url"`
+	Path string `json:"path"`
+	Type string `json:"type,omitempty"` // "html" or "css" for the pages whose links are converted
+}
+
+// frontier tracks the progress of the level being crawled, to save it.
+type frontier struct {
+	mu    sync.Mutex
+	depth int
+	level []string        // URLs of the level being crawled
+	done  map[string]bool // URLs of the level fetched
+	next  *crawlLevel
+}
+
+// savesFiles reports whether the crawl saves files, and so a frontier to
+// resume from. Warming, link extraction and dry runs save none, they simply
+// start over.
+func (m *MirrorParams) savesFiles() bool {
+	return !m.WarmOnly && !m.ExtractOnly && !m.DryRun
+}
+
+// context returns the context of the crawl, which never ends when Context
+// is unset.
+func (m *MirrorParams) context() context.Context {
+	if m.Context == nil {
+		return context.Background()
+	}
+	return m.Context
+}
+
+// interrupted reports whether the crawl was asked to stop.
+func (m *MirrorParams) interrupted() bool {
+	return m.context().Err() != nil
+}
+
+// startLevel notes the URLs of the level about to be crawled, at the given
+// depth, and the level collecting their links.
+func (m *MirrorParams) startLevel(depth int, urls []string, next *crawlLevel) {
+	m.frontier.mu.Lock()
+	defer m.frontier.mu.Unlock()
+	m.frontier.depth = depth
+	m.frontier.level = urls
+	m.frontier.done = make(map[string]bool)
+	m.frontier.next = next
+}
+
+// fetched notes that a URL of the level being crawled was fetched. A fetch
+// cut short by the interruption doesn't count, the URL is fetched again on
+// resuming.
+func (m *MirrorParams) fetched(u string) {
+	if m.interrupted() {
+		return
+	}
+	m.frontier.mu.Lock()
+	defer m.frontier.mu.Unlock()
+	m.frontier.done[u] = true
+}
+
+// writeFrontier saves the state of the crawl to the output directory,
+// through a temporary file so a crash while writing it leaves the previous
+// one intact.
+func (m *MirrorParams) writeFrontier() error {
+	rec := frontierRecord{URL: m.URL, Saved: time.Now()}
+
+	m.frontier.mu.Lock()
+	rec.Depth = m.frontier.depth
+	for _, u := range m.frontier.level {
+		if !m.frontier.done[u] {
+			rec.Pending = append(rec.Pending, u)
+		}
+	}
+	if next := m.frontier.next; next != nil {
+		next.mu.Lock()
+		rec.Pending = append(rec.Pending, next.retries...)
+		rec.Next = append(rec.Next, next.urls...)
+		next.mu.Unlock()
+	}
+	m.frontier.mu.Unlock()
+
+	m.visited.Range(func(key, _ any) bool {
+		rec.Visited = append(rec.Visited, key.(string))
+		return true
+	})
+	sort.Strings(rec.Visited)
+
+	m.files.mu.Lock()
+	pages := make(map[string]string)
+	for _, page := range m.files.pages {
+		pages[page.path] = "html"
+		if page.css {
+			pages[page.path] = "css"
+		}
+	}
+	for key, path := range m.files.paths {
+		rec.Files = append(rec.Files, frontierFile{URL: key, Path: path, Type: pages[path]})
+	}
+	m.files.mu.Unlock()
+	sort.Slice(rec.Files, func(i, j int) bool { return rec.Files[i].URL < rec.Files[j].URL })
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.OutputDir, frontierName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to save the crawl frontier: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save the crawl frontier: %v", err)
+	}
+	return nil
+}
+
+// saveFrontierPeriodically saves the frontier every frontierSaveInterval
+// until the returned function is called.
+func (m *MirrorParams) saveFrontierPeriodically() (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(frontierSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.writeFrontier(); err != nil {
+					m.logf("Warning: %v\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// loadFrontier reads the frontier an interrupted crawl of the same URL
+// left in the output directory, restoring the URLs it queued and the files
+// it saved. It returns nil when there is none.
+func (m *MirrorParams) loadFrontier() (*frontierRecord, error) {
+	data, err := os.ReadFile(filepath.Join(m.OutputDir, frontierName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the crawl frontier: %v", err)
+	}
+	var rec frontierRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("invalid crawl frontier %s: %v", frontierName, err)
+	}
+	if rec.URL != m.URL {
+		return nil, fmt.Errorf("the crawl frontier in %s is a mirror of %s, not %s", m.OutputDir, rec.URL, m.URL)
+	}
+
+	for _, key := range rec.Visited {
+		m.visited.Store(key, true)
+	}
+	m.files.mu.Lock()
+	defer m.files.mu.Unlock()
+	for _, file := range rec.Files {
+		if m.files.paths == nil {
+			m.files.paths = make(map[string]string)
+		}
+		m.files.paths[file.URL] = file.Path
+		if file.Type == "" {
+			continue
+		}
+		// The key of a page is its normalized URL, which its links resolve against alike.
+		if u, err := url.Parse(file.URL); err == nil {
+			m.files.pages = append(m.files.pages, savedPage{url: u, path: file.Path, css: file.Type == "css"})
+		}
+	}
+	return &rec, nil
+}
+
+// removeFrontier deletes the frontier of a crawl that ran to the end.
+func (m *MirrorParams) removeFrontier() {
+	path := filepath.Join(m.OutputDir, frontierName)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.logf("Warning: failed to remove %s: %v\n", path, err)
+	}
+}
@@ -0,0 +1,48 @@
+package mirror
+
+import (
+	"net"
+	"strings"
+)
+
+// spansHosts reports whether the crawl may leave the start host.
+func (m *MirrorParams) spansHosts() bool {
+	return m.SpanHosts || len(m.Domains) > 0
+}
+
+// hostAllowed reports whether the crawl follows links to a host: the start
+// host, or with -H any host, or with -D the listed domains and their
+// subdomains, but never those of --exclude-domains.
+func (m *MirrorParams) hostAllowed(host string) bool {
+	if host == m.baseHost {
+		return true
+	}
+	if !m.spansHosts() {
+		return false
+	}
+	name := hostName(host)
+	if inDomains(name, m.ExcludeDomains) {
+		return false
+	}
+	return len(m.Domains) == 0 || inDomains(name, m.Domains)
+}
+
+// inDomains reports whether a host name is one of the domains or one of
+// their subdomains.
+func inDomains(name string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostName returns a host without its port, in lower case.
+func hostName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,28 @@
+package mirror
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// layoutPath applies the directory options of GNU wget to a local path
+// (host/dirs.../name): -nH drops the host directory, --cut-dirs the first
+// CutDirs directories of the URL path, and -nd all directories. Files that
+// end up with the same path overwrite each other, converted links point at
+// whichever was saved last.
+func (m *MirrorParams) layoutPath(path string) string {
+	if !m.NoHostDirectories && m.CutDirs == 0 && !m.NoDirectories {
+		return path
+	}
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if m.NoDirectories || len(parts) < 2 {
+		return parts[len(parts)-1]
+	}
+
+	host, dirs, name := parts[0], parts[1:len(parts)-1], parts[len(parts)-1]
+	dirs = dirs[min(m.CutDirs, len(dirs)):]
+	if !m.NoHostDirectories {
+		dirs = append([]string{host}, dirs...)
+	}
+	return filepath.Join(append(dirs, name)...)
+}
@@ -0,0 +1,61 @@
+package mirror
+
+import (
+	"errors"
+	"io"
+)
+
+// errFileTooLarge is returned reading a body longer than MaxFileSize.
+var errFileTooLarge = errors.New("file larger than --max-file-size")
+
+// tooLarge reports whether a response announcing length bytes (-1 when
+// unknown) is over MaxFileSize.
+func (m *MirrorParams) tooLarge(length int64) bool {
+	return m.MaxFileSize > 0 && length > m.MaxFileSize
+}
+
+// limitSize makes reading body fail with errFileTooLarge past MaxFileSize,
+// for responses that don't announce their length.
+func (m *MirrorParams) limitSize(body io.ReadCloser) io.ReadCloser {
+	if m.MaxFileSize <= 0 {
+		return body
+	}
+	return &sizeLimitedBody{ReadCloser: body, remaining: m.MaxFileSize}
+}
+
+type sizeLimitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *sizeLimitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errFileTooLarge
+	}
+	// Read one byte past the limit to tell a body of exactly the limit from a longer one.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// bodyFailed reports a failure to read the body of a URL: a skip when it
+// was over MaxFileSize.
+func (m *MirrorParams) bodyFailed(urlStr string, err error) {
+	if errors.Is(err, errFileTooLarge) {
+		m.skip(urlStr, skipTooLarge)
+		return
+	}
+	m.logf("failed to read %s: %v\n", urlStr, err)
+}
+
+// budgetSpent reports whether the files saved so far add up to
+// MaxTotalSize, when the crawl stops starting new ones.
+func (m *MirrorParams) budgetSpent() bool {
+	return m.MaxTotalSize > 0 && m.stats.total() >= m.MaxTotalSize
+}
@@ -1,7 +1,8 @@
 package mirror
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,8 +13,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"golang.org/x/net/html"
+	"wget/download"
+	"wget/httpclient"
+	"wget/utils"
 )
 
 // A structure holding the parameters used during the mirroring process
@@ -21,17 +25,117 @@ type MirrorParams struct {
 	URL           string
 	OutputDir     string
 	ConvertLinks  bool
-	UseDynamic    bool
+	UseDynamic    bool // Render HTML pages in headless Chrome before extracting links (--dynamic)
 	RejectTypes   []string
 	ExcludePaths  []string
-	visited       sync.Map // Concurrent-safe map
-	currentDepth  int
-	maxDepth      int
-	depthMutex    sync.Mutex // Protects currentDepth
+	AcceptTypes   []string       // Only save files with these names or extensions (-A)
+	AcceptRegex   *regexp.Regexp // Only save files whose path matches (--accept-regex)
+	RejectRegex   *regexp.Regexp // Don't fetch URLs whose path matches (--reject-regex)
+	NoParent      bool           // Don't crawl above the directory of the start URL (--no-parent)
+	visited       sync.Map       // URLs queued so far, by urlKey
+	MaxDepth      int            // Levels of links followed from the start page (-l), or UnlimitedDepth
 	baseHost      string
-	MaxConcurrent int
+	MaxConcurrent int            // Number of requests in flight at once (--concurrent-requests)
+	DepthRules    map[string]int // Per resource class depth limits, overriding MaxDepth
+	Client        *http.Client   // Client used for all requests, one of the crawl's own when nil
+	ownClient     *http.Client   // Client built when Client is nil
+	clientOnce    sync.Once
+
+	ExtractOnly bool           // Report discovered URLs instead of saving them
+	WarmOnly    bool           // Fetch every URL and discard the bodies to warm caches, saving nothing (--warm)
+	LinkPattern *regexp.Regexp // Only report URLs matching this pattern
+	LinkExts    []string       // Only report URLs with one of these extensions
+	LinkOutput  io.Writer      // Destination of reported URLs, stdout when nil
+	Log         io.Writer      // Destination of progress messages, stdout when nil
+	outputMutex sync.Mutex     // Serializes writes to LinkOutput
+
+	OnProgress download.ProgressFunc // Called once for each saved file, from concurrent goroutines
+
+	stats crawlStats // Per-type and per-directory statistics of saved files
+	warm  warmStats  // Cache statuses of the responses in warm mode
+
+	Quota        *utils.Quota // Byte quota for the whole mirror (-Q), counting the bytes fetched, saved or not
+	quotaSkipped []string     // URLs not downloaded because the quota ran out
+	quotaMutex   sync.Mutex   // Protects quotaSkipped
+
+	Timestamping bool   // Only download files newer than the local copy (-N)
+	Conflict     string // What to do with files left by a prior run (see Conflict* constants)
+
+	AtomicPublish bool // Mirror into a new snapshot and switch the "current" symlink on success
+	KeepSnapshots int  // Number of previous snapshots kept when publishing atomically
+
+	NewerThan time.Time            // Only save content modified after this date
+	lastMods  map[string]time.Time // Page lastmod dates read from the sitemap
+
+	shortened pathManifest // Files saved under a shortened path
+
+	Transforms    []Transform // Rules applied to the HTML of saved pages (--transform)
+	TransformExec string      // Shell command filtering the HTML of saved pages (--transform-exec)
+	ConsentBypass bool        // Send consent cookies and remove cookie dialogs from saved pages (--consent-bypass)
+
+	StripQueryParams []string // Query parameters dropped from crawled URLs, as shell patterns (e.g., utm_*)
+	KeepQueryParams  []string // Query parameters kept in crawled URLs, all others are dropped
+	StripTracking    bool     // Drop the tracking parameters of utils.TrackingParams from crawled URLs (--strip-tracking)
+
+	NoRobots bool     // Ignore robots.txt and nofollow (--no-robots)
+	robots   sync.Map // *hostRobots of each host crawled, by host
+
+	IgnoreNofollow bool // Follow the links marked rel=nofollow and those of pages with meta robots nofollow (--ignore-nofollow)
+
+	SpanHosts      bool     // Follow links to other hosts (-H)
+	Domains        []string // Only span to these domains and their subdomains (-D)
+	ExcludeDomains []string // Never span to these domains (--exclude-domains)
+
+	ScanScripts bool // Queue the asset URLs found in the strings of JavaScript and JSON responses (--scan-scripts)
+
+	throttled sync.Map // Times the server answered 429 or 503 for a URL, by URL
+
+	renderer *renderer // Headless browser pages are rendered in, with UseDynamic
+
+	AdjustExtension bool // Save HTML and CSS under a .html or .css name (-E)
+
+	files           localFiles // Files saved by the crawl, for converting links once it ends
+	BackupConverted bool       // Keep the files converted links are written to as downloaded, as file.orig (-K)
+
+	Incremental bool           // Only fetch the files of earlier runs again if they changed (--incremental)
+	validators  validatorCache // ETag and Last-Modified of the files mirrored
+
+	RestrictFileNames FileNameRestrictions // Sanitization of local file names (--restrict-file-names)
+
+	NoHostDirectories bool // Don't save files below a directory named after the host (-nH)
+	CutDirs           int  // Leading directories of URL paths left out of local paths (--cut-dirs)
+	NoDirectories     bool // Save all files in the output directory itself (-nd)
+
+	Context        context.Context // Stops the crawl when done, saving the frontier to resume from; never when nil
+	ContinueMirror bool            // Resume the crawl an interrupted run left a frontier of (--continue-mirror)
+	frontier       frontier        // Progress of the level being crawled
+
+	summary    crawlSummary // Skipped URLs and broken links
+	ReportFile string       // Write the summary of the mirror to this file as JSON (--report-file)
+
+	WARCOnly bool // Only fetch files for the WARC file the client archives them in, saving none (--warc-only)
+
+	MaxFileSize  int64 // Skip files larger than this, unlimited when 0 (--max-file-size)
+	MaxTotalSize int64 // Stop the crawl once its files add up to this, unlimited when 0 (--max-total-size)
+
+	Dedup string     // Replace files with the content of one saved before by links, DedupHardlink or DedupSymlink (--dedup)
+	dedup dedupIndex // Content of the files saved
+
+	ArchiveOutput string // Write the mirrored tree to this .zip, .tar.gz or .tgz file once the crawl ends (--archive-output)
+	ArchiveOnly   bool   // Keep the mirrored files in the archive only (--archive-only)
+
+	DryRun  bool       // Only report the files the mirror would save and the URLs it would skip (--dry-run)
+	planned dryRunPlan // Files the dry run found
 }
 
+// userAgent is the User-Agent crawl requests are sent with, a browser's, as
+// some sites serve other clients a reduced page.
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// DefaultConcurrency is the number of requests a crawl has in flight at once
+// without --concurrent-requests.
+const DefaultConcurrency = 8
+
 // GetMirrorParams parses the parameters passed for mirroring.
 // It then populates the MirrorParams struct using the values.
 func GetMirrorParams(urlStr, outputDir string, convertLinks bool, rejectTypes []string, excludePaths []string) *MirrorParams {
@@ -47,58 +151,36 @@ func GetMirrorParams(urlStr, outputDir string, convertLinks bool, rejectTypes []
 		ConvertLinks:  convertLinks,
 		RejectTypes:   rejectTypes,
 		ExcludePaths:  excludePaths,
-		maxDepth:      5, // Maximum depth for nested links
+		MaxDepth:      DefaultDepth, // Maximum depth for nested links
 		baseHost:      baseURL.Host,
-		MaxConcurrent: 100000,
+		MaxConcurrent: DefaultConcurrency,
 	}
 }
 
 // ProcessUrl handles the URL passed for mirroring.
 // It downloads the resources based on the specified parameters such as output name, directory, reject, and exclude.
-// It handles the nested links recurssively.
-func (m *MirrorParams) ProcessUrl(urlStr string, wg *sync.WaitGroup, sem chan struct{}) {
-	defer wg.Done()          // mark when all goroutines have finished execution
-	sem <- struct{}{}        // Acquire semaphore
-	defer func() { <-sem }() // Ensure semaphore is released when the function completes.
-
+// The links found on the page are queued on next, the following level of the crawl.
+func (m *MirrorParams) ProcessUrl(urlStr string, next *crawlLevel) {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		fmt.Printf("failed to parse URL %s: %v\n", urlStr, err)
-		return
-	}
-
-	cleanURL := *parsedURL
-	cleanURL.Fragment = ""
-	cleanURL.RawQuery = ""
-	urlKey := cleanURL.String()
-
-	// Use sync.Map for thread safety
-	if _, exists := m.visited.Load(urlKey); exists {
+		m.logf("failed to parse URL %s: %v\n", urlStr, err)
 		return
 	}
-	m.visited.Store(urlKey, true)
 
-	// Protect `currentDepth` with a mutex
-	m.depthMutex.Lock()
-	if m.currentDepth > m.maxDepth {
-		m.depthMutex.Unlock()
+	if parsedURL.Host != "" && !m.hostAllowed(parsedURL.Host) {
+		m.skip(urlStr, skipExternal)
 		return
 	}
-	m.currentDepth++
-	m.depthMutex.Unlock()
 
-	defer func() {
-		m.depthMutex.Lock()
-		m.currentDepth--
-		m.depthMutex.Unlock()
-	}()
-
-	if parsedURL.Host != "" && parsedURL.Host != m.baseHost {
-		fmt.Printf("Skipping external domain: %s\n", urlStr)
+	// The start page was asked for explicitly, --no-parent only limits the crawl.
+	if next.depth > 1 && m.inParent(parsedURL) {
+		m.skip(urlStr, skipParent)
 		return
 	}
 
-	if strings.Contains(parsedURL.Path, "/js/") {
+	// The start page was asked for explicitly, --reject-regex only limits the crawl.
+	if next.depth > 1 && m.rejectedByRegex(parsedURL) {
+		m.skip(urlStr, skipRegex)
 		return
 	}
 
@@ -107,11 +189,18 @@ func (m *MirrorParams) ProcessUrl(urlStr string, wg *sync.WaitGroup, sem chan st
 		normalizedPath := strings.Trim(parsedURL.Path, "/")
 
 		if strings.HasPrefix(normalizedPath, normalizedExclude) {
-			fmt.Printf("Skipping excluded path: %s\n", urlStr)
+			m.skip(urlStr, skipExcluded)
 			return
 		}
 	}
 
+	robots := m.robotsFor(parsedURL)
+	// The start page was asked for explicitly, robots.txt only limits the crawl.
+	if next.depth > 1 && !robots.allowed(parsedURL) {
+		m.skip(urlStr, skipRobots)
+		return
+	}
+
 	filename := filepath.Base(parsedURL.Path)
 	if filename == "" || filename == "/" {
 		filename = "index.html"
@@ -121,7 +210,7 @@ func (m *MirrorParams) ProcessUrl(urlStr string, wg *sync.WaitGroup, sem chan st
 
 	for _, rejectedType := range m.RejectTypes {
 		if strings.EqualFold(filename, rejectedType) {
-			fmt.Printf("Skipping rejected file: %s\n", urlStr)
+			m.skip(urlStr, skipRejected)
 			shouldSaveFile = false
 		}
 	}
@@ -131,255 +220,484 @@ func (m *MirrorParams) ProcessUrl(urlStr string, wg *sync.WaitGroup, sem chan st
 		ext = strings.TrimPrefix(ext, ".")
 		for _, rejectedType := range m.RejectTypes {
 			if strings.EqualFold(ext, rejectedType) {
-				fmt.Printf("Skipping rejected file type: %s\n", urlStr)
+				m.skip(urlStr, skipRejected)
 				shouldSaveFile = false
 			}
 		}
 	}
 
-	if shouldSaveFile {
-		fmt.Printf("Downloading: %s\n", urlStr)
+	// Pages that aren't accepted are still fetched for their links, as with GNU wget.
+	if shouldSaveFile && !m.accepted(parsedURL) {
+		shouldSaveFile = false
+		if !m.mayContainLinks(parsedURL) {
+			m.skip(urlStr, skipNotAccepted)
+			return
+		}
 	}
 
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		fmt.Printf("failed to create request: %v\n", err)
-		return
+	if shouldSaveFile && m.isOlderThanCutoff(parsedURL) {
+		m.skip(urlStr, skipNotNewer)
+		shouldSaveFile = false
+		if !m.mayContainLinks(parsedURL) {
+			return
+		}
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Printf("failed to download %s: %v\n", urlStr, err)
+	if shouldSaveFile && m.Quota.Exceeded() {
+		m.recordQuotaSkip(urlStr)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("failed to download %s: status code %d\n", urlStr, resp.StatusCode)
+	if m.WarmOnly {
+		// Every URL is fetched, pages are only kept in memory to follow their links.
+		shouldSaveFile = false
+	} else if shouldSaveFile && m.ExtractOnly {
+		// Only report the link; pages that may contain further links are still
+		// fetched below so the crawl can continue, but nothing is saved.
+		m.reportLink(parsedURL)
+		shouldSaveFile = false
+		if !m.mayContainLinks(parsedURL) {
+			return
+		}
+	} else if shouldSaveFile && m.DryRun {
+		// Only pages are fetched, for their links.
+		m.plan(parsedURL)
+		shouldSaveFile = false
+		if !m.mayContainLinks(parsedURL) {
+			return
+		}
+	} else if shouldSaveFile {
+		m.logf("Downloading: %s\n", urlStr)
+	}
+	// With --warc-only, files are only archived by the client, never saved.
+	archiveOnly := shouldSaveFile && m.WARCOnly
+	if archiveOnly {
+		shouldSaveFile = false
+	}
+
+	outputPath := m.outputPath(parsedURL)
+
+	if shouldSaveFile && m.Conflict == ConflictSkip && fileExists(outputPath) {
+		// Keep the existing copy, but still follow the links it contains.
+		m.logf("Skipping existing file: %s\n", outputPath)
+		if body, contentType, ok := readLocalCopy(m.originalPath(outputPath)); ok {
+			m.processBody(parsedURL, body, contentType, outputPath, false, next)
+		}
 		return
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(m.context(), "GET", urlStr, nil)
 	if err != nil {
-		fmt.Printf("failed to read response body: %v\n", err)
+		m.logf("failed to create request: %v\n", err)
 		return
 	}
 
-	outputPath := filepath.Join(m.OutputDir, m.convertToLocalPath(parsedURL))
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+	if m.ConsentBypass {
+		addConsentCookies(req)
+	}
 
-	if strings.HasSuffix(outputPath, "/") || outputPath == m.OutputDir {
-		outputPath = filepath.Join(outputPath, "index.html")
+	useTimestamps := shouldSaveFile && (m.Timestamping || m.Conflict == ConflictNewer)
+	if useTimestamps {
+		utils.SetIfModifiedSince(req, m.originalPath(outputPath))
+	}
+	conditional := useTimestamps
+	if shouldSaveFile && m.incremental() && m.setConditional(req, parsedURL, outputPath) {
+		conditional = true
 	}
 
-	if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
-		outputPath = filepath.Join(outputPath, "index.html")
+	robots.wait()
+	resp, err := m.httpClient().Do(req)
+	if err != nil {
+		if m.interrupted() {
+			return // Fetched again on resuming
+		}
+		m.logf("failed to download %s: %v\n", urlStr, err)
+		m.broken(parsedURL, 0, err)
+		return
 	}
+	defer resp.Body.Close()
 
-	if shouldSaveFile {
-		dir := filepath.Dir(outputPath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			fmt.Printf("failed to create directory %s: %v\n", dir, err)
+	var body []byte
+	var contentType string
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		// The local copy is current; reuse it so its links are still followed.
+		m.logf("Not modified: %s\n", urlStr)
+		shouldSaveFile = false
+		var ok bool
+		if body, contentType, ok = readLocalCopy(m.originalPath(outputPath)); !ok {
 			return
 		}
-
-		if err := os.WriteFile(outputPath, body, 0644); err != nil {
-			fmt.Printf("failed to write file: %v\n", err)
+	} else {
+		if httpclient.Throttled(resp) && m.retryLater(urlStr, resp, next) {
 			return
 		}
-	}
-
-	contentType := resp.Header.Get("Content-Type")
-	if strings.Contains(contentType, "text/html") {
-		doc, err := html.Parse(bytes.NewReader(body))
-		if err != nil {
-			fmt.Printf("failed to parse HTML: %v\n", err)
+		if resp.StatusCode != http.StatusOK {
+			m.logf("failed to download %s: status code %d\n", urlStr, resp.StatusCode)
+			m.broken(parsedURL, resp.StatusCode, nil)
 			return
 		}
+		if m.tooLarge(resp.ContentLength) {
+			m.skip(urlStr, skipTooLarge)
+			return
+		}
+		resp.Body = m.limitSize(resp.Body)
 
-		var processNode func(*html.Node)
-		processNode = func(n *html.Node) {
-			if n.Type == html.ElementNode {
-				for i := 0; i < len(n.Attr); i++ {
-					attr := n.Attr[i]
-					switch attr.Key {
-					case "href", "src":
-						absURL, err := m.getAbsoluteURL(parsedURL, attr.Val)
-						if err != nil {
-							fmt.Printf("Warning: Failed to resolve URL %s: %v\n", attr.Val, err)
-							continue
-						}
-						if strings.Contains(absURL.String(), "google-analytics.com") || strings.Contains(absURL.String(), "analytics.js") {
-							continue
-						}
-
-						if absURL.Host == m.baseHost {
-							if m.ConvertLinks {
-								localPath := m.getRelativePath(parsedURL, absURL)
-								n.Attr[i].Val = localPath
-							} else {
-								n.Attr[i].Val = absURL.String()
-							}
-
-							cleanAbsURL := *absURL
-							cleanAbsURL.Fragment = ""
-							cleanAbsURL.RawQuery = ""
-
-							if _, exists := m.visited.Load(cleanAbsURL.String()); exists {
-								continue
-							}
-
-							wg.Add(1)
-							go m.ProcessUrl(absURL.String(), wg, sem)
-						}
-					case "style":
-						urls := extractURLsFromCSS(attr.Val)
-						for _, cssURL := range urls {
-							absURL, err := m.getAbsoluteURL(parsedURL, cssURL)
-							if err != nil {
-								fmt.Printf("Warning: Failed to resolve URL %s: %v\n", cssURL, err)
-								continue
-							}
-							if absURL.Host == m.baseHost {
-								localPath := m.getRelativePath(parsedURL, absURL)
-								if m.ConvertLinks {
-									attr.Val = strings.ReplaceAll(attr.Val, fmt.Sprintf(`url('%s')`, cssURL), fmt.Sprintf(`url('%s')`, localPath))
-									attr.Val = strings.ReplaceAll(attr.Val, fmt.Sprintf(`url("%s")`, cssURL), fmt.Sprintf(`url("%s")`, localPath))
-									attr.Val = strings.ReplaceAll(attr.Val, fmt.Sprintf(`url(%s)`, cssURL), fmt.Sprintf(`url(%s')`, localPath))
-									n.Attr[i] = attr
-								}
-								cleanAbsURL := *absURL
-								cleanAbsURL.Fragment = ""
-								cleanAbsURL.RawQuery = ""
-								if _, exists := m.visited.Load(cleanAbsURL.String()); exists {
-									continue
-								}
-
-								wg.Add(1)
-								go m.ProcessUrl(absURL.String(), wg, sem)
-
-							}
-						}
-					case "integrity":
-						if i < len(n.Attr)-1 {
-							n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
-							i--
-						} else {
-							n.Attr = n.Attr[:i]
-						}
-					}
-				}
-
-				if n.Data == "style" && n.FirstChild != nil {
-					cssContent := n.FirstChild.Data
-					urls := extractURLsFromCSS(cssContent)
-					for _, cssURL := range urls {
-						absURL, err := m.getAbsoluteURL(parsedURL, cssURL)
-						if err != nil {
-							fmt.Printf("Warning: Failed to resolve URL %s: %v\n", cssURL, err)
-							continue
-						}
-
-						if absURL.Host == m.baseHost {
-							localPath := m.getRelativePath(parsedURL, absURL)
-							if m.ConvertLinks {
-								cssContent = strings.ReplaceAll(cssContent, fmt.Sprintf(`url('%s')`, cssURL), fmt.Sprintf(`url('%s')`, localPath))
-								cssContent = strings.ReplaceAll(cssContent, fmt.Sprintf(`url("%s")`, cssURL), fmt.Sprintf(`url("%s")`, localPath))
-								cssContent = strings.ReplaceAll(cssContent, fmt.Sprintf(`url(%s)`, cssURL), fmt.Sprintf(`url(%s')`, localPath))
-								n.FirstChild.Data = cssContent
-							}
-
-							cleanAbsURL := *absURL
-							cleanAbsURL.Fragment = ""
-							cleanAbsURL.RawQuery = ""
-
-							if _, exists := m.visited.Load(cleanAbsURL.String()); exists {
-								continue
-							}
-
-							wg.Add(1)
-							go m.ProcessUrl(absURL.String(), wg, sem)
-						}
-					}
-				}
+		contentType = resp.Header.Get("Content-Type")
+		if m.AdjustExtension {
+			outputPath = adjustExtension(outputPath, contentType)
+		}
+		isParseable := strings.Contains(contentType, "text/html") || strings.Contains(contentType, "text/css") ||
+			(m.ScanScripts && isScript(contentType, parsedURL))
+		if (m.ExtractOnly || m.DryRun) && !isParseable {
+			return
+		}
+		if m.WarmOnly && !isParseable {
+			size, err := io.Copy(m.Quota.Writer(io.Discard), resp.Body)
+			if err != nil {
+				m.bodyFailed(urlStr, err)
+				return
 			}
+			m.warmed(urlStr, resp, size)
+			return
+		}
 
-			for c := n.FirstChild; c != nil; c = c.NextSibling {
-				processNode(c)
+		if shouldSaveFile && m.isResponseOlderThanCutoff(resp) {
+			m.skip(urlStr, skipNotNewer)
+			shouldSaveFile = false
+			if !isParseable {
+				return
 			}
 		}
-		processNode(doc)
 
-		if shouldSaveFile {
-			var buf bytes.Buffer
-			if err := html.Render(&buf, doc); err != nil {
-				fmt.Printf("failed to render HTML: %v\n", err)
-				<-sem
+		if useTimestamps && utils.IsLocalCopyCurrent(m.originalPath(outputPath), resp) {
+			m.logf("Not modified: %s\n", urlStr)
+			shouldSaveFile = false
+			if !isParseable {
 				return
 			}
+		}
+
+		if shouldSaveFile && m.incremental() {
+			m.recordValidators(parsedURL, resp)
+		}
 
-			if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
-				fmt.Printf("failed to write updated HTML: %v\n", err)
-				<-sem
+		if archiveOnly && !isParseable {
+			// Read to the end, for the archive to hold all of it.
+			size, err := io.Copy(m.Quota.Writer(io.Discard), resp.Body)
+			if err != nil {
+				m.bodyFailed(urlStr, err)
 				return
 			}
+			m.stats.record(parsedURL, contentType, size)
+			return
 		}
-	} else if strings.Contains(contentType, "text/css") {
-		cssContent := string(body)
-		urls := extractURLsFromCSS(cssContent)
-		for _, cssURL := range urls {
-			absURL, err := m.getAbsoluteURL(parsedURL, cssURL)
-			if err != nil {
-				fmt.Printf("Warning: Failed to resolve URL %s: %v\n", cssURL, err)
-				continue
+		if !isParseable {
+			// Only pages are searched for links, anything else (videos,
+			// archives) goes straight to disk rather than through memory.
+			if !shouldSaveFile || !m.moveExistingFile(outputPath) {
+				return
+			}
+			size, err := m.saveStream(parsedURL, resp.Body, contentType, outputPath)
+			if errors.Is(err, errFileTooLarge) {
+				m.skip(urlStr, skipTooLarge)
+				return
+			} else if err != nil {
+				m.logf("failed to save %s: %v\n", urlStr, err)
+				return
+			}
+			if useTimestamps {
+				utils.SetModTime(outputPath, resp)
 			}
+			m.stats.record(parsedURL, contentType, size)
+			return
+		}
 
-			if absURL.Host == m.baseHost {
-				localPath := m.getRelativePath(parsedURL, absURL)
-				if m.ConvertLinks {
-					cssContent = strings.ReplaceAll(cssContent, fmt.Sprintf(`url('%s')`, cssURL), fmt.Sprintf(`url('%s')`, localPath))
-					cssContent = strings.ReplaceAll(cssContent, fmt.Sprintf(`url("%s")`, cssURL), fmt.Sprintf(`url("%s")`, localPath))
-					cssContent = strings.ReplaceAll(cssContent, fmt.Sprintf(`url(%s)`, cssURL), fmt.Sprintf(`url(%s')`, localPath))
-				}
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			m.bodyFailed(urlStr, err)
+			return
+		}
+		// Pages fetched only for their links count too: the quota caps the transfer.
+		m.Quota.Add(int64(len(body)))
+		if m.renderer != nil && strings.Contains(contentType, "text/html") {
+			body = m.rendered(urlStr, body)
+		}
+		if m.WarmOnly {
+			m.warmed(urlStr, resp, int64(len(body)))
+		}
 
-				cleanAbsURL := *absURL
-				cleanAbsURL.Fragment = ""
-				cleanAbsURL.RawQuery = ""
+		if shouldSaveFile && !m.moveExistingFile(outputPath) {
+			return
+		}
 
-				if _, exists := m.visited.Load(cleanAbsURL.String()); exists {
-					continue
-				}
+		if shouldSaveFile && useTimestamps {
+			// Runs after the final (possibly link-converted) write below.
+			defer utils.SetModTime(outputPath, resp)
+		}
+	}
+
+	if shouldSaveFile || archiveOnly {
+		m.stats.record(parsedURL, contentType, int64(len(body)))
+	}
+
+	m.processBody(parsedURL, body, contentType, outputPath, shouldSaveFile, next)
+}
+
+// processBody saves a downloaded resource and, for HTML and CSS content,
+// queues the same-host links it contains. The links of HTML pages are made
+// absolute, unless links are converted once the crawl ends: pages are then
+// saved as downloaded until then.
+func (m *MirrorParams) processBody(parsedURL *url.URL, body []byte, contentType, outputPath string, shouldSaveFile bool, next *crawlLevel) {
+	if strings.Contains(contentType, "text/html") {
+		rewritten, err := m.rewriteHTML(parsedURL, body, next)
+		if err != nil {
+			m.logf("failed to parse HTML: %v\n", err)
+		} else if !m.ConvertLinks {
+			body = rewritten
+		}
+	} else if strings.Contains(contentType, "text/css") {
+		body = []byte(m.rewriteCSS(parsedURL, string(body), next))
+	} else if m.ScanScripts && isScript(contentType, parsedURL) {
+		m.scanScript(parsedURL, body, next)
+	}
+
+	if !shouldSaveFile {
+		return
+	}
+	if strings.Contains(contentType, "text/html") {
+		body = m.transformHTML(parsedURL, outputPath, body)
+	}
+
+	dir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		m.logf("failed to create directory %s: %v\n", dir, err)
+		return
+	}
+
+	m.unshare(outputPath)
+	if err := os.WriteFile(outputPath, body, 0644); err != nil {
+		m.logf("failed to write file: %v\n", err)
+		return
+	}
+	m.saved(parsedURL, outputPath, contentType, int64(len(body)))
+}
+
+// saved records a file saved by the crawl.
+func (m *MirrorParams) saved(u *url.URL, outputPath, contentType string, size int64) {
+	m.dedupe(outputPath, contentType, size)
+	m.recordShortenedPath(u, outputPath)
+	m.recordLocalFile(u, outputPath, contentType)
+
+	if m.OnProgress != nil {
+		m.OnProgress(download.Progress{URL: u.String(), File: outputPath, Downloaded: size, Total: size, Done: true})
+	}
+}
+
+// ProcessUrlWrapper crawls the site from urlStr level by level: a pool of
+// MaxConcurrent workers fetches the pages of a level from a bounded queue
+// and the links found on them form the next level, until a level is empty.
+// The frontier of the crawl is saved periodically and when Context ends, in
+// which case it returns download.ErrInterrupted.
+func (m *MirrorParams) ProcessUrlWrapper(urlStr string) error {
+	if u, err := url.Parse(urlStr); err == nil {
+		u = m.normalizeURL(u)
+		m.visited.Store(m.urlKey(u), true)
+		urlStr = u.String()
+	}
+	workers := m.MaxConcurrent
+	if workers < 1 {
+		workers = DefaultConcurrency
+	}
+	m.summary.started = time.Now()
 
-				wg.Add(1)
-				go m.ProcessUrl(absURL.String(), wg, sem)
+	level, depth := []string{urlStr}, 0
+	var queued []string // URLs of the next level queued before resuming
+	if m.savesFiles() {
+		if m.ContinueMirror {
+			rec, err := m.loadFrontier()
+			if err != nil {
+				return err
+			}
+			if rec != nil {
+				m.logf("Resuming the crawl saved %s: %d URLs pending, %d queued\n", rec.Saved.Format(time.DateTime), len(rec.Pending), len(rec.Next))
+				level, depth, queued = rec.Pending, rec.Depth, rec.Next
+				if len(level) == 0 {
+					level, depth, queued = queued, depth+1, nil
+				}
 			}
 		}
+		defer m.saveFrontierPeriodically()()
+	}
 
-		if shouldSaveFile {
-			if err := os.WriteFile(outputPath, []byte(cssContent), 0644); err != nil {
-				fmt.Printf("failed to write updated CSS: %v\n", err)
-				return
+	for ; len(level) > 0; depth++ {
+		next := &crawlLevel{depth: depth + 1, urls: queued}
+		queued = nil
+		m.startLevel(depth, level, next)
+		m.processLevel(level, next, workers)
+		// URLs the server was too busy for are fetched again once the rest
+		// of the level is done and the delay it asked for has passed.
+		for retries, at := next.takeRetries(); len(retries) > 0; retries, at = next.takeRetries() {
+			if !m.sleepUntil(at) {
+				for _, u := range retries {
+					next.retry(u, at) // Left pending in the frontier
+				}
+				break
 			}
+			m.startLevel(depth, retries, next)
+			m.processLevel(retries, next, workers)
 		}
+		if m.interrupted() {
+			return m.stopInterrupted()
+		}
+		if m.budgetSpent() {
+			m.stopBudgetSpent()
+			break
+		}
+		level = next.urls
+	}
+	if m.ConvertLinks && m.savesFiles() {
+		m.convertLinks()
+	}
+	m.writeState()
+	if m.savesFiles() && !m.budgetSpent() {
+		m.removeFrontier()
 	}
+	m.printStats()
+	m.printQuotaSummary()
+	m.reportSummary()
+	return nil
 }
 
-func (m *MirrorParams) ProcessUrlWrapper(urlStr string) error {
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, m.MaxConcurrent) // Limit concurrency
+// sleepUntil waits until the given time, reporting false when Context ended
+// first.
+func (m *MirrorParams) sleepUntil(at time.Time) bool {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-m.context().Done():
+		return false
+	}
+}
 
-	wg.Add(1)
-	go m.ProcessUrl(urlStr, &wg, sem)
+// stopInterrupted saves the state of an interrupted crawl to resume it
+// from with --continue-mirror.
+func (m *MirrorParams) stopInterrupted() error {
+	m.writeState()
+	m.reportSummary()
+	if m.savesFiles() {
+		if err := m.writeFrontier(); err != nil {
+			m.logf("%v\n", err)
+		} else {
+			m.logf("\nCrawl interrupted, its frontier is saved in %s\n", filepath.Join(m.OutputDir, frontierName))
+		}
+	}
+	return download.ErrInterrupted
+}
+
+// stopBudgetSpent ends the crawl once MaxTotalSize was saved, keeping its
+// frontier to continue it with a larger budget.
+func (m *MirrorParams) stopBudgetSpent() {
+	m.logf("\n--max-total-size of %s reached, stopping the crawl\n", utils.FormatBytes(m.MaxTotalSize))
+	if !m.savesFiles() {
+		return
+	}
+	if err := m.writeFrontier(); err != nil {
+		m.logf("%v\n", err)
+	} else {
+		m.logf("Its frontier is saved in %s, continue it with --continue-mirror\n", filepath.Join(m.OutputDir, frontierName))
+	}
+}
 
+// writeState saves the files the next run reads back: the manifest of
+// shortened paths and the validators of the files.
+func (m *MirrorParams) writeState() {
+	if err := m.writeManifest(); err != nil {
+		m.logf("%v\n", err)
+	}
+	if m.incremental() {
+		if err := m.writeValidators(); err != nil {
+			m.logf("%v\n", err)
+		}
+	}
+}
+
+// processLevel fetches the URLs of a level with a pool of workers, queuing
+// the links they contain in next. It stops handing out URLs once Context
+// ends.
+func (m *MirrorParams) processLevel(urls []string, next *crawlLevel, workers int) {
+	queue := make(chan string, 2*workers)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(urls)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range queue {
+				if m.budgetSpent() {
+					continue // Left pending in the frontier
+				}
+				m.ProcessUrl(u, next)
+				m.fetched(u)
+			}
+		}()
+	}
+feed:
+	for _, u := range urls {
+		if m.budgetSpent() {
+			break
+		}
+		select {
+		case queue <- u:
+		case <-m.context().Done():
+			break feed
+		}
+	}
+	close(queue)
 	wg.Wait()
-	return nil
 }
 
-// convertToLocalPath transforms a URL to local file path
+// convertToLocalPath transforms a URL to local file path, shortened if it
+// would exceed the limits of the file system
 func (m *MirrorParams) convertToLocalPath(u *url.URL) string {
+	return m.shortenPath(m.localPath(u))
+}
+
+// outputPath returns the path in the output directory a URL is saved at,
+// index.html inside the directory when the URL maps to one. With -E, it is
+// the path a previous run saved the file at with an adjusted extension.
+func (m *MirrorParams) outputPath(u *url.URL) string {
+	outputPath := filepath.Join(m.OutputDir, m.convertToLocalPath(u))
+
+	if strings.HasSuffix(outputPath, "/") || outputPath == m.OutputDir {
+		outputPath = filepath.Join(outputPath, "index.html")
+	}
+
+	if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
+		outputPath = filepath.Join(outputPath, "index.html")
+	}
+	if m.AdjustExtension {
+		outputPath = previouslyAdjusted(outputPath)
+	}
+	return outputPath
+}
+
+// localPath returns the local path of a URL before shortening, with the
+// normalized query string in the file name so pages differing only in
+// their query are saved apart. Converted links are derived from it too.
+func (m *MirrorParams) localPath(u *url.URL) string {
+	path := localPathFor(u)
+	if query := m.normalizeURL(u).RawQuery; query != "" {
+		path = withQuery(path, query)
+	}
+	return m.restrictPath(m.layoutPath(path))
+}
+
+// localPathFor returns the local path a URL maps to, before shortening
+func localPathFor(u *url.URL) string {
 	// Get the path without query parameters and fragments
 	cleanPath := u.Path
 
@@ -462,17 +780,78 @@ func hasDynamicParts(parts []string) bool {
 }
 
 func (m *MirrorParams) Mirror() error {
+	if m.UseDynamic {
+		r, err := newRenderer()
+		if err != nil {
+			return err
+		}
+		defer r.close()
+		m.renderer = r
+	}
+
+	if m.ExtractOnly {
+		m.logf("Extracting links from %s\n", m.URL)
+		return m.ProcessUrlWrapper(m.URL)
+	}
+	if m.WarmOnly {
+		return m.warmCrawl()
+	}
+	if m.DryRun {
+		return m.dryRun()
+	}
+
+	crawl := m.crawl
+	if m.AtomicPublish {
+		crawl = m.publishAtomically
+	}
+	if m.ArchiveOutput != "" {
+		return m.crawlArchived(crawl)
+	}
+	return crawl()
+}
+
+// crawl mirrors the site into the output directory.
+func (m *MirrorParams) crawl() error {
 	// Create output directory
 	if err := os.MkdirAll(m.OutputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %v", err)
 	}
 
-	fmt.Printf("Starting mirror of %s\n", m.URL)
-	fmt.Printf("Output directory: %s\n", m.OutputDir)
+	m.logf("Starting mirror of %s\n", m.URL)
+	m.logf("Output directory: %s\n", m.OutputDir)
+
+	if !m.NewerThan.IsZero() {
+		m.loadSitemapDates()
+	}
+	if m.incremental() {
+		m.loadValidators()
+	}
 
 	return m.ProcessUrlWrapper(m.URL)
 }
 
+// httpClient returns the HTTP client the crawl should use: Client, or else
+// a client of the crawl's own keeping a connection open to the host for
+// each concurrent request, where http.DefaultClient keeps two.
+func (m *MirrorParams) httpClient() *http.Client {
+	if m.Client != nil {
+		return m.Client
+	}
+	m.clientOnce.Do(func() {
+		client, err := httpclient.New(httpclient.Config{
+			Log:                 m.logWriter(),
+			MaxRedirect:         20,
+			MaxIdleConnsPerHost: max(m.MaxConcurrent, DefaultConcurrency),
+		})
+		if err != nil {
+			m.logf("Warning: %v, using the default client\n", err)
+			client = http.DefaultClient
+		}
+		m.ownClient = client
+	})
+	return m.ownClient
+}
+
 // getAbsoluteURL transforms relative URL to Absolute URL
 func (m *MirrorParams) getAbsoluteURL(base *url.URL, ref string) (*url.URL, error) {
 	refURL, err := url.Parse(ref)
@@ -482,43 +861,11 @@ func (m *MirrorParams) getAbsoluteURL(base *url.URL, ref string) (*url.URL, erro
 	return base.ResolveReference(refURL), nil
 }
 
-// getRelativePath converts a URL to a relative link path for use in HTML
-func (m *MirrorParams) getRelativePath(base, ref *url.URL) string {
-	// If the reference URL is absolute (starts with a protocol), keep it as is
-	if ref.Scheme != "" || ref.Host != "" {
-		if ref.Host != base.Host {
-			// External link, keep it as is
-			return ref.String()
-		}
-	}
-
-	// Get the local path for the reference URL
-	localPath := m.convertToLocalPath(ref)
-
-	// Get the local path for the base URL
-	basePath := m.convertToLocalPath(base)
-	baseDir := filepath.Dir(basePath)
-
-	// Calculate the relative path from base to ref
-	rel, err := filepath.Rel(baseDir, localPath)
-	if err != nil {
-		// Fallback to absolute path if relative path calculation fails
-		return "/" + localPath
-	}
-
+// localLink returns the link to a local file at the relative path rel, with
+// the characters special in URLs escaped so that percent signs, spaces or
+// "?" in file names don't change where the link points.
+func localLink(rel string) string {
 	// Convert Windows backslashes to forward slashes for URLs
-	return strings.ReplaceAll(rel, "\\", "/")
-}
-
-func extractURLsFromCSS(css string) []string {
-	var urls []string
-	// Match url(...) patterns in CSS
-	urlPattern := regexp.MustCompile(`url\(['"]?([^'"\)]+)['"]?\)`)
-	matches := urlPattern.FindAllStringSubmatch(css, -1)
-	for _, match := range matches {
-		if len(match) >= 2 {
-			urls = append(urls, match[1])
-		}
-	}
-	return urls
+	link := &url.URL{Path: filepath.ToSlash(rel)}
+	return link.String()
 }
@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wget/sitemap"
+)
+
+// loadSitemapDates reads /sitemap.xml of the mirrored host (if any) and
+// remembers the lastmod date of each listed page, so pages older than the
+// --newer-than cutoff can be recognized before they are requested.
+func (m *MirrorParams) loadSitemapDates() {
+	baseURL, err := url.Parse(m.URL)
+	if err != nil {
+		return
+	}
+
+	sitemapURL := url.URL{Scheme: baseURL.Scheme, Host: baseURL.Host, Path: "/sitemap.xml"}
+	entries, err := sitemap.Fetch(m.httpClient(), sitemapURL.String())
+	if err != nil {
+		return
+	}
+
+	m.lastMods = make(map[string]time.Time)
+	for _, entry := range entries {
+		if entry.LastMod.IsZero() {
+			continue
+		}
+		if u, err := url.Parse(entry.Loc); err == nil {
+			m.lastMods[cleanURLKey(u)] = entry.LastMod
+		}
+	}
+	m.logf("Loaded %d lastmod dates from %s\n", len(m.lastMods), sitemapURL.String())
+}
+
+// isOlderThanCutoff reports whether the sitemap says the URL was last
+// modified before the --newer-than cutoff.
+func (m *MirrorParams) isOlderThanCutoff(u *url.URL) bool {
+	if m.NewerThan.IsZero() {
+		return false
+	}
+	lastMod, ok := m.lastMods[cleanURLKey(u)]
+	return ok && !lastMod.After(m.NewerThan)
+}
+
+// isResponseOlderThanCutoff reports whether the Last-Modified header of a
+// response is before the --newer-than cutoff.
+func (m *MirrorParams) isResponseOlderThanCutoff(resp *http.Response) bool {
+	if m.NewerThan.IsZero() {
+		return false
+	}
+	lastMod, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return err == nil && !lastMod.After(m.NewerThan)
+}
+
+// cleanURLKey returns the URL without its query string and fragment, the
+// form used to identify pages during the crawl.
+func cleanURLKey(u *url.URL) string {
+	clean := *u
+	clean.Fragment = ""
+	clean.RawQuery = ""
+	return clean.String()
+}
+
+// readLocalCopy loads a previously mirrored HTML or CSS file so its links can
+// be followed when the server reports it unchanged. Other file types are not
+// read since they contain no links.
+func readLocalCopy(path string) ([]byte, string, bool) {
+	contentType := mime.TypeByExtension(filepath.Ext(strings.TrimSuffix(path, origSuffix)))
+	if !strings.Contains(contentType, "text/html") && !strings.Contains(contentType, "text/css") {
+		return nil, contentType, false
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, contentType, false
+	}
+	return body, contentType, true
+}
@@ -0,0 +1,79 @@
+package mirror
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// followsNofollow reports whether the crawl leaves the links marked
+// nofollow alone, by rel=nofollow or the meta robots tag of their page.
+// --no-robots ignores them too, as robots=off does in GNU wget.
+func (m *MirrorParams) followsNofollow() bool {
+	return !m.IgnoreNofollow && !m.NoRobots
+}
+
+// nofollowLinks adapts the rewriter of a page's links so those marked
+// nofollow are made absolute without being queued: links with
+// rel=nofollow, or all of them when the meta robots tag of the page says
+// nofollow. The images, stylesheets and icons the page is displayed with
+// are still fetched.
+func (m *MirrorParams) nofollowLinks(pageURL *url.URL, body []byte, links linkRewriter) linkRewriter {
+	if !m.followsNofollow() {
+		return links
+	}
+	links.nofollow = func(val string) string {
+		absURL, err := m.getAbsoluteURL(pageURL, strings.TrimSpace(val))
+		if err != nil || val == "" || strings.HasPrefix(val, "#") {
+			return val
+		}
+		return absURL.String()
+	}
+	if metaNofollow(body) {
+		m.logf("Not following the links of %s: meta robots nofollow\n", pageURL)
+		links.requisite = links.link
+		links.link = links.nofollow
+	}
+	return links
+}
+
+// metaNofollow reports whether the meta robots tag of an HTML document
+// forbids following its links, with "nofollow" or "none".
+func metaNofollow(body []byte) bool {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.DataAtom == atom.Body {
+				return false // Meta tags belong in the head
+			}
+			name, _ := attrValue(token, "name")
+			if token.DataAtom != atom.Meta || !strings.EqualFold(name, "robots") {
+				continue
+			}
+			content, _ := attrValue(token, "content")
+			for _, directive := range strings.Split(strings.ToLower(content), ",") {
+				if d := strings.TrimSpace(directive); d == "nofollow" || d == "none" {
+					return true
+				}
+			}
+		}
+	}
+}
+
+// hasRel reports whether the rel attribute of a tag lists a link type.
+func hasRel(token *html.Token, rel string) bool {
+	types, _ := attrValue(*token, "rel")
+	for _, r := range strings.Fields(strings.ToLower(types)) {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package mirror
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// startDir returns the directory of the start URL, with a trailing slash.
+// As with GNU wget, "/docs/" is its own directory but "/docs" is in "/".
+func (m *MirrorParams) startDir() string {
+	start, err := url.Parse(m.URL)
+	if err != nil {
+		return "/"
+	}
+	dir := start.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return dir
+}
+
+// inParent reports whether --no-parent keeps the crawl away from u: a URL
+// of the start host outside the directory of the start URL.
+func (m *MirrorParams) inParent(u *url.URL) bool {
+	if !m.NoParent || (u.Host != "" && u.Host != m.baseHost) {
+		return false
+	}
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	return !strings.HasPrefix(p, m.startDir())
+}
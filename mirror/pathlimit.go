@@ -0,0 +1,161 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Limits applied to local paths, so pathological URLs don't make saving
+// fail with ENAMETOOLONG halfway through a crawl.
+const (
+	maxNameLen    = 200  // Bytes per path component, below the usual 255 to leave room for backup suffixes
+	maxPathLen    = 1024 // Bytes of the whole output path (PATH_MAX on macOS, Linux allows 4096)
+	maxDirDepth   = 32   // Directories below the host directory
+	fallbackLen   = 64   // Bytes of the file name kept when the whole path has to be replaced
+	pathHashLen   = 12   // Hex digits of the hash standing in for the part cut off
+	maxExtLen     = 16   // Longer "extensions" are just part of the name
+	shortenedMark = "~"  // Precedes the hash in shortened names
+)
+
+// manifestName is the file in the output directory listing the files saved
+// under a shortened path.
+const manifestName = "wget-manifest.json"
+
+// manifestEntry records a file saved under a shortened path.
+type manifestEntry struct {
+	URL      string `json:"url"`
+	Path     string `json:"path"`     // Where the file was saved, relative to the output directory
+	Original string `json:"original"` // The path the URL maps to, which was too long
+}
+
+// pathManifest collects the files of a crawl saved under a shortened path.
+type pathManifest struct {
+	mu      sync.Mutex
+	entries map[string]manifestEntry // By Path
+}
+
+// shortenPath returns path, a local path relative to the output directory,
+// with over-long components truncated, excessive nesting collapsed and, if
+// it is still too long, everything but the host (or with -nH the first
+// directory) and file name replaced. The
+// parts removed are replaced by a hash of them, so the result is still
+// unique and the same URL always maps to the same file, which keeps
+// converted links pointing at the right place.
+func (m *MirrorParams) shortenPath(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) < 2 {
+		return shortenName(path, maxNameLen) // Saved without directories (-nd)
+	}
+	host, dirs, name := shortenName(parts[0], maxNameLen), parts[1:len(parts)-1], parts[len(parts)-1]
+
+	for i, dir := range dirs {
+		dirs[i] = shortenName(dir, maxNameLen)
+	}
+	if len(dirs) > maxDirDepth {
+		rest := strings.Join(dirs[maxDirDepth-1:], "/")
+		dirs = append(dirs[:maxDirDepth-1], shortenedMark+pathHash(rest))
+	}
+
+	short := filepath.Join(host, filepath.Join(dirs...), shortenName(name, maxNameLen))
+	if len(m.OutputDir)+1+len(short) > maxPathLen || (m.RestrictFileNames.Windows && len(short) > windowsMaxPathLen) {
+		// A very long host or output directory, or many long directories.
+		short = filepath.Join(host, shortenedMark+pathHash(path), shortenName(name, fallbackLen))
+	}
+	return short
+}
+
+// shortenName cuts a path component down to limit bytes, replacing the end
+// of the name with a hash of the whole name but keeping its extension.
+func shortenName(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtLen {
+		ext = ""
+	}
+	suffix := shortenedMark + pathHash(name) + ext
+
+	n := limit - len(suffix)
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return name[:n] + suffix
+}
+
+// pathHash returns a short hash identifying s.
+func pathHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:pathHashLen]
+}
+
+// recordShortenedPath adds the file saved at outputPath to the manifest if
+// the path of u had to be shortened.
+func (m *MirrorParams) recordShortenedPath(u *url.URL, outputPath string) {
+	original := m.localPath(u)
+	if original == m.convertToLocalPath(u) {
+		return
+	}
+	rel, err := filepath.Rel(m.OutputDir, outputPath)
+	if err != nil {
+		rel = outputPath
+	}
+
+	m.shortened.mu.Lock()
+	defer m.shortened.mu.Unlock()
+	if m.shortened.entries == nil {
+		m.shortened.entries = make(map[string]manifestEntry)
+	}
+	m.shortened.entries[rel] = manifestEntry{URL: u.String(), Path: rel, Original: original}
+}
+
+// writeManifest saves the shortened paths of the crawl to the manifest in
+// the output directory, keeping the entries of earlier runs.
+func (m *MirrorParams) writeManifest() error {
+	m.shortened.mu.Lock()
+	defer m.shortened.mu.Unlock()
+
+	if len(m.shortened.entries) == 0 {
+		return nil
+	}
+
+	manifestPath := filepath.Join(m.OutputDir, manifestName)
+	entries := make(map[string]manifestEntry)
+	if data, err := os.ReadFile(manifestPath); err == nil {
+		var previous []manifestEntry
+		if json.Unmarshal(data, &previous) == nil {
+			for _, entry := range previous {
+				entries[entry.Path] = entry
+			}
+		}
+	}
+	for path, entry := range m.shortened.entries {
+		entries[path] = entry
+	}
+
+	list := make([]manifestEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	m.logf("Saved %d files under shortened paths, see %s\n", len(m.shortened.entries), manifestPath)
+	return nil
+}
@@ -0,0 +1,128 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"wget/download"
+)
+
+const (
+	snapshotsDirName   = "snapshots"
+	currentLinkName    = "current"
+	tempSnapshotPrefix = ".tmp-"
+)
+
+// publishAtomically mirrors the site into a fresh snapshot directory and,
+// only once the crawl has succeeded, atomically points the "current" symlink
+// in the output directory at it. A web server serving "current" therefore
+// never sees a half-finished crawl. Older snapshots beyond KeepSnapshots are
+// removed afterwards.
+func (m *MirrorParams) publishAtomically() error {
+	rootDir := m.OutputDir
+	snapshotsDir := filepath.Join(rootDir, snapshotsDirName)
+	if err := os.MkdirAll(snapshotsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create snapshots directory: %v", err)
+	}
+
+	name := time.Now().Format("20060102-150405")
+	if m.ContinueMirror {
+		if interrupted := interruptedSnapshot(snapshotsDir); interrupted != "" {
+			name = interrupted
+		}
+	}
+	tempDir := filepath.Join(snapshotsDir, tempSnapshotPrefix+name)
+	finalDir := filepath.Join(snapshotsDir, name)
+
+	m.OutputDir = tempDir
+	err := m.crawl()
+	m.OutputDir = rootDir
+	if errors.Is(err, download.ErrInterrupted) {
+		return err // Kept for --continue-mirror
+	} else if err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+
+	if err := os.Rename(tempDir, finalDir); err != nil {
+		return fmt.Errorf("failed to finalize snapshot: %v", err)
+	}
+
+	if err := swapSymlink(filepath.Join(snapshotsDirName, name), filepath.Join(rootDir, currentLinkName)); err != nil {
+		return fmt.Errorf("failed to publish snapshot: %v", err)
+	}
+	m.logf("Published snapshot %s\n", finalDir)
+
+	return pruneSnapshots(snapshotsDir, name, m.KeepSnapshots)
+}
+
+// interruptedSnapshot returns the name of the latest snapshot whose crawl
+// was interrupted, leaving a frontier to resume from, or "" if there is none.
+func interruptedSnapshot(snapshotsDir string) string {
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		return ""
+	}
+	latest := ""
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), tempSnapshotPrefix)
+		if ok && entry.IsDir() && fileExists(filepath.Join(snapshotsDir, entry.Name(), frontierName)) && name > latest {
+			latest = name
+		}
+	}
+	return latest
+}
+
+// swapSymlink atomically replaces the symlink at linkPath so it points to
+// target, by creating a temporary link and renaming it over the old one.
+func swapSymlink(target, linkPath string) error {
+	tempLink := linkPath + ".tmp"
+	os.Remove(tempLink)
+	if err := os.Symlink(target, tempLink); err != nil {
+		return err
+	}
+	if err := os.Rename(tempLink, linkPath); err != nil {
+		os.Remove(tempLink)
+		return err
+	}
+	return nil
+}
+
+// pruneSnapshots removes all but the keep most recent snapshots preceding
+// the current one, along with leftovers of failed or interrupted crawls.
+func pruneSnapshots(snapshotsDir, current string, keep int) error {
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		return err
+	}
+
+	var previous []string
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == current {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), tempSnapshotPrefix) {
+			os.RemoveAll(filepath.Join(snapshotsDir, entry.Name()))
+			continue
+		}
+		previous = append(previous, entry.Name())
+	}
+
+	// Snapshot names are timestamps, so sorting them orders them by age.
+	sort.Strings(previous)
+	if keep < 0 {
+		keep = 0
+	}
+	for len(previous) > keep {
+		if err := os.RemoveAll(filepath.Join(snapshotsDir, previous[0])); err != nil {
+			return fmt.Errorf("failed to remove old snapshot %s: %v", previous[0], err)
+		}
+		previous = previous[1:]
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package mirror
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"wget/utils"
+)
+
+// querySeparator joins a file name and the query string of its URL, as
+// wget does where "?" can't be used in file names.
+const querySeparator = "@"
+
+// unsafeQueryChars are the characters of a query string that can't be part
+// of a file name on some systems, or would change the meaning of a
+// converted link pointing at the file.
+const unsafeQueryChars = `%/\?:*"<>|`
+
+// filtersQuery reports whether the crawl normalizes query strings. Without
+// --strip-query-params, --keep-query-params or --strip-tracking, they are
+// kept as they are.
+func (m *MirrorParams) filtersQuery() bool {
+	return len(m.StripQueryParams) > 0 || len(m.KeepQueryParams) > 0 || m.StripTracking
+}
+
+// keepQueryParam reports whether a query parameter survives normalization:
+// it must match KeepQueryParams, when set, and must not match
+// StripQueryParams, nor be a tracking parameter with StripTracking. The
+// lists hold shell patterns such as utm_*.
+func (m *MirrorParams) keepQueryParam(name string) bool {
+	if len(m.KeepQueryParams) > 0 && !matchesAny(m.KeepQueryParams, name) {
+		return false
+	}
+	if m.StripTracking && utils.IsTrackingParam(name) {
+		return false
+	}
+	return !matchesAny(m.StripQueryParams, name)
+}
+
+// matchesAny reports whether name matches one of the shell patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeURL drops the query parameters the crawl ignores and sorts the
+// rest, so URLs differing only in tracking parameters or parameter order
+// are fetched and saved once.
+func (m *MirrorParams) normalizeURL(u *url.URL) *url.URL {
+	if !m.filtersQuery() || u.RawQuery == "" {
+		return u
+	}
+	values, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return u
+	}
+	for name := range values {
+		if !m.keepQueryParam(name) {
+			values.Del(name)
+		}
+	}
+	normalized := *u
+	normalized.RawQuery = values.Encode()
+	return &normalized
+}
+
+// urlKey identifies a URL during the crawl: its normalized form without the
+// fragment. URLs differing in their query string are different pages.
+func (m *MirrorParams) urlKey(u *url.URL) string {
+	key := *m.normalizeURL(u)
+	key.Fragment = ""
+	return key.String()
+}
+
+// withQuery adds a query string to the file name of a local path, before
+// its extension so the file still opens with the right application, e.g.
+// page/index@id=1.html for /page?id=1. Escaped and unsafe characters are
+// replaced and a hash of the query keeps the name unique.
+func withQuery(localPath, query string) string {
+	dir, name := filepath.Split(localPath)
+	ext := filepath.Ext(name)
+	suffix := query
+	if strings.ContainsAny(query, unsafeQueryChars) {
+		suffix = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(unsafeQueryChars, r) {
+				return '_'
+			}
+			return r
+		}, query) + shortenedMark + pathHash(query)
+	}
+	return filepath.Join(dir, strings.TrimSuffix(name, ext)+querySeparator+suffix+ext)
+}
@@ -0,0 +1,30 @@
+package mirror
+
+import (
+	"wget/utils"
+)
+
+// recordQuotaSkip remembers a URL that wasn't downloaded because the
+// download quota was used up.
+func (m *MirrorParams) recordQuotaSkip(urlStr string) {
+	m.skip(urlStr, skipQuota)
+	m.quotaMutex.Lock()
+	defer m.quotaMutex.Unlock()
+	m.quotaSkipped = append(m.quotaSkipped, urlStr)
+}
+
+// printQuotaSummary lists the URLs skipped because of the download quota.
+func (m *MirrorParams) printQuotaSummary() {
+	m.quotaMutex.Lock()
+	defer m.quotaMutex.Unlock()
+
+	if len(m.quotaSkipped) == 0 {
+		return
+	}
+
+	m.logf("\nDownload quota of %s exceeded (%s downloaded), skipped %d files:\n",
+		utils.FormatBytes(m.Quota.Limit()), utils.FormatBytes(m.Quota.Used()), len(m.quotaSkipped))
+	for _, urlStr := range m.quotaSkipped {
+		m.logf("- %s\n", urlStr)
+	}
+}
@@ -0,0 +1,76 @@
+package mirror
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// isRefresh reports whether a tag is a meta refresh, which sends the browser
+// to the URL of its content attribute.
+func isRefresh(token *html.Token) bool {
+	equiv, _ := attrValue(*token, "http-equiv")
+	return token.DataAtom == atom.Meta && strings.EqualFold(strings.TrimSpace(equiv), "refresh")
+}
+
+// refreshURL finds the URL of the content attribute of a meta refresh tag,
+// such as "5; url='page.html'" or "0;page.html", parsed the way browsers do.
+// It returns the byte range of the URL in content, or ok false when the
+// refresh reloads the page itself.
+func refreshURL(content string) (start, end int, ok bool) {
+	const space = " \t\n\r\f"
+	skipSpace := func(i int) int {
+		for i < len(content) && strings.IndexByte(space, content[i]) >= 0 {
+			i++
+		}
+		return i
+	}
+
+	// The delay, then a ; or , before the URL
+	i := skipSpace(0)
+	for i < len(content) && (content[i] >= '0' && content[i] <= '9' || content[i] == '.') {
+		i++
+	}
+	i = skipSpace(i)
+	if i < len(content) && (content[i] == ';' || content[i] == ',') {
+		i++
+	}
+	i = skipSpace(i)
+
+	// An optional "url =" before the URL itself
+	if len(content)-i >= 3 && strings.EqualFold(content[i:i+3], "url") {
+		if j := skipSpace(i + 3); j < len(content) && content[j] == '=' {
+			i = skipSpace(j + 1)
+		}
+	}
+
+	end = len(content)
+	if i < len(content) && (content[i] == '\'' || content[i] == '"') {
+		quote := content[i]
+		i++
+		if n := strings.IndexByte(content[i:], quote); n >= 0 {
+			end = i + n
+		}
+	} else {
+		end = i + len(strings.TrimRight(content[i:], space))
+	}
+	if i >= end {
+		return 0, 0, false
+	}
+	return i, end, true
+}
+
+// rewriteRefresh rewrites the URL of the content attribute of a meta
+// refresh tag, keeping the delay and the way it is written.
+func rewriteRefresh(content string, link func(string) string) string {
+	start, end, ok := refreshURL(content)
+	if !ok {
+		return content
+	}
+	newURL := link(content[start:end])
+	if newURL == content[start:end] {
+		return content
+	}
+	return content[:start] + newURL + content[end:]
+}
@@ -0,0 +1,93 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// renderTimeout bounds the rendering of a page, scripts that never settle
+// included.
+const renderTimeout = 30 * time.Second
+
+// renderSettle is how long a page's scripts get to run after the document
+// is loaded, for content fetched and inserted once the page is shown.
+const renderSettle = 500 * time.Millisecond
+
+// serializeDocument returns the document as the browser holds it once the
+// scripts ran, with its doctype.
+const serializeDocument = `(document.doctype ? new XMLSerializer().serializeToString(document.doctype) + "\n" : "") + document.documentElement.outerHTML`
+
+// renderer renders HTML pages in a headless Chrome (--dynamic), so that
+// links inserted by JavaScript are found and client-rendered pages are
+// saved with their content. Each page gets a tab of its own.
+//
+// Chrome makes its own connections: its requests bypass the crawl's HTTP
+// client, so the proxy, authentication, rate limits, redirect checks, WARC
+// file, cache and recording don't apply to them. --safe-mode is refused
+// with --dynamic for that reason.
+type renderer struct {
+	browser context.Context
+	cancel  context.CancelFunc
+}
+
+// newRenderer starts a headless Chrome or Chromium, found in the PATH.
+func newRenderer() (*renderer, error) {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.UserAgent(userAgent))
+	if os.Geteuid() == 0 {
+		// Chrome refuses to start as root with its sandbox enabled.
+		opts = append(opts, chromedp.NoSandbox)
+	}
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	browser, cancelBrowser := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(browser); err != nil {
+		cancelBrowser()
+		cancelAlloc()
+		return nil, fmt.Errorf("failed to start headless Chrome (is Chrome or Chromium installed?): %v", err)
+	}
+	return &renderer{browser: browser, cancel: func() {
+		cancelBrowser()
+		cancelAlloc()
+	}}, nil
+}
+
+// render loads a page in a new tab and returns its HTML after the scripts
+// ran. The browser fetches the page and its resources itself, outside the
+// crawl's HTTP client.
+func (r *renderer) render(pageURL string) ([]byte, error) {
+	tab, cancel := chromedp.NewContext(r.browser)
+	defer cancel()
+	ctx, cancelTimeout := context.WithTimeout(tab, renderTimeout)
+	defer cancelTimeout()
+
+	var html string
+	err := chromedp.Run(ctx,
+		chromedp.Navigate(pageURL),
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		chromedp.Sleep(renderSettle),
+		chromedp.Evaluate(serializeDocument, &html),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(html), nil
+}
+
+// close stops the browser.
+func (r *renderer) close() {
+	r.cancel()
+}
+
+// rendered returns the HTML of a page after rendering it, or body as it was
+// downloaded when rendering fails.
+func (m *MirrorParams) rendered(pageURL string, body []byte) []byte {
+	html, err := m.renderer.render(pageURL)
+	if err != nil {
+		m.logf("failed to render %s, keeping the HTML as served: %v\n", pageURL, err)
+		return body
+	}
+	return html
+}
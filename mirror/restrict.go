@@ -0,0 +1,121 @@
+package mirror
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FileNameRestrictions selects how local file names are sanitized
+// (--restrict-file-names), so a mirror made on Linux can be copied to
+// Windows or to FAT file systems. Characters that aren't allowed are
+// percent-encoded, as GNU wget does; converted links are escaped so they
+// still point at the files.
+type FileNameRestrictions struct {
+	Windows   bool // Escape the characters Windows reserves and avoid its device names, trailing dots and spaces
+	ASCII     bool // Escape the bytes of non-ASCII characters
+	Lowercase bool // Fold names to lower case
+	Uppercase bool // Fold names to upper case
+}
+
+// windowsReserved are the characters not allowed in Windows file names,
+// besides the control characters.
+const windowsReserved = `\:*?"<>|`
+
+// windowsMaxPathLen bounds the local paths of a mirror restricted for
+// Windows, relative to the output directory, leaving room for the directory
+// it is copied into below the 260 characters of MAX_PATH.
+const windowsMaxPathLen = 200
+
+// ParseRestrictFileNames parses the value of --restrict-file-names, a
+// comma-separated list of modes: unix (the default, no restrictions),
+// windows, ascii, lowercase and uppercase.
+func ParseRestrictFileNames(spec string) (FileNameRestrictions, error) {
+	var r FileNameRestrictions
+	for _, mode := range strings.Split(spec, ",") {
+		switch strings.ToLower(strings.TrimSpace(mode)) {
+		case "", "unix":
+		case "windows":
+			r.Windows = true
+		case "ascii":
+			r.ASCII = true
+		case "lowercase":
+			r.Lowercase = true
+		case "uppercase":
+			r.Uppercase = true
+		default:
+			return r, fmt.Errorf("invalid file name restriction %q, expected unix, windows, ascii, lowercase or uppercase", mode)
+		}
+	}
+	if r.Lowercase && r.Uppercase {
+		return r, fmt.Errorf("file names can't be restricted to both lowercase and uppercase")
+	}
+	return r, nil
+}
+
+// escapes reports whether names are percent-encoded.
+func (r FileNameRestrictions) escapes() bool {
+	return r.Windows || r.ASCII
+}
+
+// restrictPath applies the file name restrictions to each component of a
+// local path.
+func (m *MirrorParams) restrictPath(path string) string {
+	r := m.RestrictFileNames
+	if r == (FileNameRestrictions{}) {
+		return path
+	}
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i, part := range parts {
+		parts[i] = r.restrictName(part)
+	}
+	return filepath.Join(parts...)
+}
+
+// restrictName applies the restrictions to a single path component.
+func (r FileNameRestrictions) restrictName(name string) string {
+	switch {
+	case r.Lowercase:
+		name = strings.ToLower(name)
+	case r.Uppercase:
+		name = strings.ToUpper(name)
+	}
+	if !r.escapes() {
+		return name
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		last := i == len(name)-1
+		switch {
+		case c == '%',
+			r.ASCII && c >= 0x80,
+			r.Windows && (c < 0x20 || c == 0x7f || strings.IndexByte(windowsReserved, c) >= 0),
+			r.Windows && last && (c == '.' || c == ' ') && name != "." && name != "..":
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	name = b.String()
+	if r.Windows && isWindowsDeviceName(name) {
+		base, ext, _ := strings.Cut(name, ".")
+		name = base + "_"
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// isWindowsDeviceName reports whether Windows takes a file name for a
+// device, whatever its extension: CON, PRN, AUX, NUL, COM1-9 and LPT1-9.
+func isWindowsDeviceName(name string) bool {
+	base, _, _ := strings.Cut(strings.ToUpper(name), ".")
+	switch base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	return len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) && base[3] >= '1' && base[3] <= '9'
+}
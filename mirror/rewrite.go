@@ -0,0 +1,249 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// linkRewriter gives the new value of each link of a document: link that of
+// the URLs of HTML attributes, cssLink that of the references of stylesheets.
+// When set, requisite replaces link for the resources a page is displayed
+// with (see isRequisite), and nofollow for the links with rel=nofollow.
+type linkRewriter struct {
+	link      func(val string) string
+	cssLink   func(val string) string
+	requisite func(val string) string
+	nofollow  func(val string) string
+}
+
+// pageLinks returns the rewriter queueing the same-host links of a page.
+// The links of HTML attributes are made absolute, stylesheet references are
+// left alone. Links are converted for the local copy once the crawl ends.
+func (m *MirrorParams) pageLinks(pageURL *url.URL, next *crawlLevel) linkRewriter {
+	return linkRewriter{
+		link: func(val string) string {
+			return m.rewriteURL(pageURL, val, next)
+		},
+		cssLink: func(val string) string {
+			m.rewriteURL(pageURL, val, next)
+			return val
+		},
+	}
+}
+
+// rewriteHTML streams through an HTML document with a tokenizer, queueing the
+// same-host links it finds that aren't marked nofollow.
+func (m *MirrorParams) rewriteHTML(pageURL *url.URL, body []byte, next *crawlLevel) ([]byte, error) {
+	return rewriteHTMLLinks(body, m.nofollowLinks(pageURL, body, m.pageLinks(pageURL, next)))
+}
+
+// rewriteHTMLLinks rewrites the links of an HTML document. Only tags whose
+// URL attributes actually change are re-serialized; all other markup is
+// copied through byte for byte, so the saved page keeps its original
+// formatting.
+func rewriteHTMLLinks(body []byte, links linkRewriter) ([]byte, error) {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	var out bytes.Buffer
+	out.Grow(len(body))
+	inStyle := false
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return out.Bytes(), nil
+			}
+			return nil, z.Err()
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// Copy the raw bytes first: reading the token normalizes the buffer in place.
+			raw := append([]byte(nil), z.Raw()...)
+			token := z.Token()
+			if token.DataAtom == atom.Style && tt == html.StartTagToken {
+				inStyle = true
+			}
+			if rewriteAttrs(&token, links) {
+				out.WriteString(token.String())
+			} else {
+				out.Write(raw)
+			}
+
+		case html.TextToken:
+			if inStyle {
+				out.WriteString(rewriteCSSLinks(string(z.Raw()), links.cssLink))
+			} else {
+				out.Write(z.Raw())
+			}
+
+		case html.EndTagToken:
+			out.Write(z.Raw())
+			if name, _ := z.TagName(); string(name) == "style" {
+				inStyle = false
+			}
+
+		default:
+			out.Write(z.Raw())
+		}
+	}
+}
+
+// rewriteAttrs rewrites the links found in a tag's attributes. It reports
+// whether the tag was modified.
+func rewriteAttrs(token *html.Token, links linkRewriter) bool {
+	changed := false
+	attrs := token.Attr[:0]
+	linkFor := func(key string) func(string) string {
+		if links.requisite != nil && isRequisite(token, key) {
+			return links.requisite
+		}
+		if links.nofollow != nil && key == "href" && hasRel(token, "nofollow") {
+			return links.nofollow
+		}
+		return links.link
+	}
+
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "href", "src", "poster":
+			// src covers <source>, <video>, <audio> and <track> as well as
+			// <img>, and href covers <link rel=preload>.
+			if newVal := linkFor(attr.Key)(attr.Val); newVal != attr.Val {
+				attr.Val = newVal
+				changed = true
+			}
+		case "srcset", "imagesrcset":
+			// Responsive images of <img> and <picture> <source>, and preloads of them.
+			if newVal := rewriteSrcset(attr.Val, linkFor(attr.Key)); newVal != attr.Val {
+				attr.Val = newVal
+				changed = true
+			}
+		case "content":
+			// The target of <meta http-equiv="refresh" content="0; url=...">
+			if !isRefresh(token) {
+				break
+			}
+			if newVal := rewriteRefresh(attr.Val, linkFor(attr.Key)); newVal != attr.Val {
+				attr.Val = newVal
+				changed = true
+			}
+		case "style":
+			if newVal := rewriteCSSLinks(attr.Val, links.cssLink); newVal != attr.Val {
+				attr.Val = newVal
+				changed = true
+			}
+		case "integrity":
+			// Subresource integrity hashes no longer match rewritten files.
+			changed = true
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+
+	token.Attr = attrs
+	return changed
+}
+
+// isRequisite reports whether an attribute of a tag points at a resource
+// the page is displayed with: an image, a stylesheet or an icon. Links to
+// other pages, scripts and media are not.
+func isRequisite(token *html.Token, key string) bool {
+	switch token.DataAtom {
+	case atom.Img:
+		return key == "src" || key == "srcset"
+	case atom.Source:
+		return key == "srcset" // Images of a <picture>, <video> and <audio> sources have a src
+	case atom.Video:
+		return key == "poster"
+	case atom.Link:
+		return key == "href" && (hasRel(token, "stylesheet") || hasRel(token, "icon") || hasRel(token, "apple-touch-icon"))
+	}
+	return false
+}
+
+// rewriteURL queues a link of a page if it points to a crawled host and
+// returns it as an absolute URL.
+func (m *MirrorParams) rewriteURL(pageURL *url.URL, val string, next *crawlLevel) string {
+	absURL, err := m.getAbsoluteURL(pageURL, val)
+	if err != nil {
+		m.logf("Warning: Failed to resolve URL %s: %v\n", val, err)
+		return val
+	}
+	if strings.Contains(absURL.String(), "google-analytics.com") || strings.Contains(absURL.String(), "analytics.js") {
+		return val
+	}
+	absURL = m.normalizeURL(absURL)
+	if !m.hostAllowed(absURL.Host) {
+		return val
+	}
+
+	m.foundOn(absURL, pageURL)
+	m.enqueue(absURL, next)
+	return absURL.String()
+}
+
+// rewriteSrcset rewrites the URLs of the image candidates of a srcset
+// attribute, keeping the width and density descriptors.
+func rewriteSrcset(val string, link func(string) string) string {
+	candidates := parseSrcset(val)
+	changed := false
+	for i, c := range candidates {
+		if newURL := link(c.url); newURL != c.url {
+			candidates[i].url = newURL
+			changed = true
+		}
+	}
+	if !changed {
+		return val // Keep the original spacing
+	}
+	return formatSrcset(candidates)
+}
+
+// rewriteCSS queues the url() and @import references to crawled hosts of a
+// stylesheet.
+func (m *MirrorParams) rewriteCSS(pageURL *url.URL, cssContent string, next *crawlLevel) string {
+	return rewriteCSSLinks(cssContent, m.pageLinks(pageURL, next).cssLink)
+}
+
+// rewriteCSSLinks rewrites the url() and @import references of a stylesheet.
+// Only the references are rewritten, the rest of the stylesheet is kept as is.
+func rewriteCSSLinks(cssContent string, link func(string) string) string {
+	var out strings.Builder
+	last := 0
+	for _, ref := range parseCSSRefs(cssContent) {
+		// Inline data has nothing to fetch.
+		if ref.url == "" || hasPrefixFold(strings.TrimSpace(ref.url), "data:") {
+			continue
+		}
+		newURL := link(ref.url)
+		if newURL == ref.url {
+			continue
+		}
+		out.WriteString(cssContent[last:ref.start])
+		out.WriteString(ref.format(newURL))
+		last = ref.end
+	}
+	if last == 0 {
+		return cssContent
+	}
+	out.WriteString(cssContent[last:])
+	return out.String()
+}
+
+// enqueue queues a URL discovered on a page for the next level of the
+// crawl, unless it was already queued or lies beyond the depth limit of its
+// resource class.
+func (m *MirrorParams) enqueue(u *url.URL, next *crawlLevel) {
+	if limit := m.depthLimit(u); limit != UnlimitedDepth && next.depth > limit {
+		return
+	}
+	if _, queued := m.visited.LoadOrStore(m.urlKey(u), true); queued {
+		return
+	}
+	next.add(u.String())
+}
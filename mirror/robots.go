@@ -0,0 +1,217 @@
+package mirror
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsAgent is the product token matched against the User-agent lines of
+// robots.txt.
+const robotsAgent = "wget"
+
+// maxCrawlDelay caps the Crawl-delay of robots.txt, so a huge value doesn't
+// stall the mirror for hours.
+const maxCrawlDelay = 30 * time.Second
+
+// maxRobotsSize is the most of a robots.txt file that is read.
+const maxRobotsSize = 512 * 1024
+
+// robotsRules are the rules of robots.txt applying to the crawl.
+type robotsRules struct {
+	rules []robotsRule
+	delay time.Duration // Crawl-delay between requests
+
+	mu   sync.Mutex
+	next time.Time // Earliest time the next request may be sent
+}
+
+// robotsRule is an Allow or Disallow line.
+type robotsRule struct {
+	pattern *regexp.Regexp
+	length  int // Length of the path pattern, the most specific rule wins
+	allow   bool
+}
+
+// robotsGroup is a group of rules and the user agents it is meant for.
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// hostRobots holds the robots.txt rules of a host, fetched on first use.
+type hostRobots struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+// robotsFor returns the robots.txt rules of the host of u, nil when there
+// are none or robots.txt is ignored.
+func (m *MirrorParams) robotsFor(u *url.URL) *robotsRules {
+	if m.NoRobots {
+		return nil
+	}
+	entry, _ := m.robots.LoadOrStore(u.Host, &hostRobots{})
+	host := entry.(*hostRobots)
+	host.once.Do(func() { host.rules = m.loadRobots(u) })
+	return host.rules
+}
+
+// loadRobots fetches robots.txt from the host of u. As with GNU wget, a
+// missing or unreadable file places no restrictions on the crawl.
+func (m *MirrorParams) loadRobots(u *url.URL) *robotsRules {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+
+	resp, err := m.httpClient().Get(robotsURL.String())
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	rules := parseRobots(io.LimitReader(resp.Body, maxRobotsSize), robotsAgent)
+	if rules.delay > 0 {
+		m.logf("Honoring Crawl-delay of %s from %s\n", rules.delay, robotsURL.String())
+	}
+	return rules
+}
+
+// parseRobots reads the groups of a robots.txt file (RFC 9309) and returns
+// the rules of those naming agent, or of the "*" groups if none does.
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	var groups []robotsGroup
+	current := -1
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share the group that follows them.
+			if current < 0 || inRules {
+				groups = append(groups, robotsGroup{})
+				current = len(groups) - 1
+				inRules = false
+			}
+			groups[current].agents = append(groups[current].agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current < 0 {
+				continue
+			}
+			inRules = true
+			if value == "" {
+				continue // An empty Disallow allows everything
+			}
+			groups[current].rules = append(groups[current].rules, robotsRule{
+				pattern: compileRobotsPattern(value),
+				length:  len(value),
+				allow:   key == "allow",
+			})
+		case "crawl-delay":
+			if current < 0 {
+				continue
+			}
+			inRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				groups[current].delay = min(time.Duration(seconds*float64(time.Second)), maxCrawlDelay)
+			}
+		}
+	}
+
+	rules := &robotsRules{}
+	if !mergeGroups(rules, groups, func(a string) bool { return strings.HasPrefix(a, agent) }) {
+		mergeGroups(rules, groups, func(a string) bool { return a == "*" })
+	}
+	return rules
+}
+
+// mergeGroups adds the rules of the groups with an agent matching to rules,
+// and reports whether there were any such groups.
+func mergeGroups(rules *robotsRules, groups []robotsGroup, matches func(agent string) bool) bool {
+	found := false
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if matches(a) {
+				rules.rules = append(rules.rules, g.rules...)
+				rules.delay = max(rules.delay, g.delay)
+				found = true
+				break
+			}
+		}
+	}
+	return found
+}
+
+// compileRobotsPattern turns a path pattern into a regular expression: "*"
+// matches any characters and a trailing "$" anchors the end of the path.
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed reports whether the crawl may fetch u. The longest matching rule
+// decides, Allow winning ties; URLs no rule matches are allowed.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	if r == nil {
+		return true
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > length || rule.length == length && rule.allow {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow
+}
+
+// wait blocks until the Crawl-delay since the previous request has passed.
+func (r *robotsRules) wait() {
+	if r == nil || r.delay <= 0 {
+		return
+	}
+	r.mu.Lock()
+	slot := r.next
+	if now := time.Now(); slot.Before(now) {
+		slot = now
+	}
+	r.next = slot.Add(r.delay)
+	r.mu.Unlock()
+
+	time.Sleep(time.Until(slot))
+}
@@ -0,0 +1,91 @@
+package mirror
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// scriptStringPattern matches the string literals of JavaScript and JSON:
+// double or single quoted, or template literals without substitutions.
+var scriptStringPattern = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'` + "|`[^`$]*`")
+
+// assetExtensions are the extensions of the string literals --scan-scripts
+// takes for asset URLs. Other strings are far more likely to be text.
+var assetExtensions = map[string]bool{
+	".html": true, ".htm": true, ".css": true, ".js": true, ".mjs": true, ".json": true, ".xml": true, ".txt": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".avif": true, ".ico": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+	".mp4": true, ".webm": true, ".mp3": true, ".ogg": true, ".wav": true, ".pdf": true,
+}
+
+// isScript reports whether a response is JavaScript or JSON, by its content
+// type or, when the server doesn't say, by the extension of its URL.
+func isScript(contentType string, u *url.URL) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch {
+	case strings.Contains(mediaType, "javascript"), strings.Contains(mediaType, "ecmascript"),
+		mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return true
+	case mediaType == "" || mediaType == "application/octet-stream" || mediaType == "text/plain":
+		return isScriptPath(u)
+	}
+	return false
+}
+
+// isScriptPath reports whether a URL names a JavaScript or JSON file.
+func isScriptPath(u *url.URL) bool {
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".js", ".mjs", ".json":
+		return true
+	}
+	return false
+}
+
+// scanScript queues the asset URLs found in the string literals of a
+// JavaScript or JSON response (--scan-scripts). Scripts are saved as they
+// are, their links are never rewritten.
+func (m *MirrorParams) scanScript(scriptURL *url.URL, body []byte, next *crawlLevel) {
+	base, err := url.Parse(m.URL)
+	if err != nil {
+		base = scriptURL
+	}
+	for _, literal := range scriptStringPattern.FindAllString(string(body), -1) {
+		ref, ok := scriptAssetURL(literal[1 : len(literal)-1])
+		if !ok {
+			continue
+		}
+		// Bundles mostly refer to assets relative to the page that loads
+		// them, which is unknown here; the start page is the best guess.
+		// Explicitly relative paths follow the script itself.
+		from := base
+		if strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../") {
+			from = scriptURL
+		}
+		m.rewriteURL(from, ref, next)
+	}
+}
+
+// scriptAssetURL returns the URL held by the contents of a string literal
+// when it looks like the URL of an asset: no spaces, and a path ending in one
+// of the assetExtensions.
+func scriptAssetURL(s string) (string, bool) {
+	s = strings.ReplaceAll(s, `\/`, "/") // JSON escapes slashes
+	if s == "" || len(s) > 2048 || strings.ContainsAny(s, " \t\n\\<>{}|^\"'`") {
+		return "", false
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+	if !assetExtensions[strings.ToLower(path.Ext(u.Path))] {
+		return "", false
+	}
+	// A bare name such as "index.js" is more often a module name than a path.
+	if u.Scheme == "" && u.Host == "" && !strings.Contains(u.Path, "/") {
+		return "", false
+	}
+	return s, true
+}
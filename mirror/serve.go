@@ -0,0 +1,137 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serveTypes are content types of files common in mirrors that the mime
+// package doesn't know without a system mime.types file.
+var serveTypes = map[string]string{
+	".ico":   "image/x-icon",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".eot":   "application/vnd.ms-fontobject",
+	".txt":   "text/plain; charset=utf-8",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".mp3":   "audio/mpeg",
+}
+
+// Serve serves the mirror in dir over HTTP on addr until ctx ends, so an
+// offline copy can be checked in a browser. Requests are resolved the way
+// the crawl named the files (see resolveMirrorPath), and each one is
+// logged to log.
+func Serve(ctx context.Context, dir, addr string, log io.Writer) error {
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("cannot serve %s: %v", dir, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("cannot serve %s: not a directory", dir)
+	}
+	for ext, typ := range serveTypes {
+		if mime.TypeByExtension(ext) == "" {
+			mime.AddExtensionType(ext, typ)
+		}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           serveHandler(dir, log),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(log, "Serving %s at http://%s/ (Ctrl-C to stop)\n", dir, listener.Addr())
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveHandler serves the files of the mirror in dir, logging each request.
+func serveHandler(dir string, log io.Writer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		// The mirror may be updated while it is served
+		rec.Header().Set("Cache-Control", "no-cache")
+		name := resolveMirrorPath(dir, r.URL.Path, r.URL.RawQuery)
+		if info, err := os.Stat(name); err == nil && info.IsDir() && !strings.HasSuffix(r.URL.Path, "/") {
+			// http.ServeFile redirects relatively, which reads a host:port
+			// directory such as localhost:8080/ as a URL scheme
+			target := r.URL.EscapedPath() + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(rec, r, target, http.StatusMovedPermanently)
+		} else {
+			http.ServeFile(rec, r, name)
+		}
+		fmt.Fprintf(log, "%s %s %d\n", r.Method, r.URL.RequestURI(), rec.status)
+	})
+}
+
+// resolveMirrorPath returns the file of the mirror in dir that answers a
+// request. Besides the file at the path itself, it tries the names the
+// crawl gives files: with the query string in the name, or with the
+// ".html" or ".css" extension added by -E. A directory is returned as is,
+// to be redirected to with a trailing slash, which http.ServeFile answers
+// with its index.html or a listing.
+func resolveMirrorPath(dir, urlPath, query string) string {
+	name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+urlPath)))
+
+	var candidates []string
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		if query == "" || !strings.HasSuffix(urlPath, "/") {
+			return name
+		}
+		candidates = []string{filepath.Join(name, "index.html")}
+	} else {
+		candidates = []string{name, name + ".html", name + ".css"}
+	}
+
+	for _, candidate := range candidates {
+		if query != "" && fileExists(withQuery(candidate, query)) {
+			return withQuery(candidate, query)
+		}
+		if fileExists(candidate) {
+			return candidate
+		}
+	}
+	return name
+}
+
+// statusRecorder remembers the status of a response, for the request log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
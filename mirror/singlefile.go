@@ -0,0 +1,302 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wget/download"
+	"wget/utils"
+)
+
+// singleFile collects the resources of a page saved as a single file.
+type singleFile struct {
+	m         *MirrorParams
+	mhtml     bool
+	resources map[string]*resource // By URL, nil while a stylesheet is being inlined or when it failed
+	parts     []*resource          // Resources fetched, in order, the parts of an MHTML file
+	size      int64
+}
+
+// resource is an image, stylesheet or font of the page. The links of a
+// stylesheet are already rewritten.
+type resource struct {
+	url         string
+	contentType string
+	data        []byte
+}
+
+// SingleFileName returns the name a page saved as a single file gets
+// without -O: the last part of its URL path, index.html for a directory,
+// with a .html extension.
+func SingleFileName(pageURL string) string {
+	name := "index.html"
+	if u, err := url.Parse(pageURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	if ext := strings.ToLower(filepath.Ext(name)); ext != ".html" && ext != ".htm" {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".html"
+	}
+	return name
+}
+
+// isMHTMLPath reports whether a page is saved to path as MHTML rather than
+// HTML.
+func isMHTMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".mht" || ext == ".mhtml"
+}
+
+// SaveSingleFile saves the page at URL to outputPath as one self-contained
+// file (--single-file), like the "save page as single file" of browsers:
+// its images, stylesheets, icons and the fonts and images of the
+// stylesheets are inlined as data: URIs. With a .mht or .mhtml outputPath,
+// they are parts of an MHTML archive instead. Other links are made
+// absolute, so they keep working from the file.
+func (m *MirrorParams) SaveSingleFile(outputPath string) error {
+	pageURL, err := url.Parse(m.URL)
+	if err != nil {
+		return err
+	}
+	if m.UseDynamic {
+		r, err := newRenderer()
+		if err != nil {
+			return err
+		}
+		defer r.close()
+		m.renderer = r
+	}
+
+	s := &singleFile{m: m, mhtml: isMHTMLPath(outputPath), resources: make(map[string]*resource)}
+	m.logf("Downloading: %s\n", m.URL)
+	page, err := s.get(pageURL)
+	if err != nil {
+		if m.interrupted() {
+			return download.ErrInterrupted
+		}
+		return fmt.Errorf("failed to download %s: %v", m.URL, err)
+	}
+	if !strings.Contains(page.contentType, "text/html") {
+		return fmt.Errorf("%s is not an HTML page but %s", m.URL, page.contentType)
+	}
+	body := page.data
+	if m.renderer != nil {
+		body = m.rendered(m.URL, body)
+	}
+
+	html, err := rewriteHTMLLinks(body, linkRewriter{
+		link:      func(val string) string { return absoluteLink(pageURL, val) },
+		cssLink:   func(val string) string { return s.embed(pageURL, val) },
+		requisite: func(val string) string { return s.embed(pageURL, val) },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML of %s: %v", m.URL, err)
+	}
+	if m.interrupted() {
+		return download.ErrInterrupted
+	}
+
+	var out bytes.Buffer
+	if s.mhtml {
+		if err := writeMHTML(&out, m.URL, html, s.parts); err != nil {
+			return err
+		}
+	} else {
+		out.Write(html)
+	}
+	if dir := filepath.Dir(outputPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(outputPath, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	m.logf("Saved %s with %d resources (%s) to %s\n", m.URL, len(s.parts), utils.FormatBytes(s.size), outputPath)
+	return nil
+}
+
+// embed returns the value of a link to a resource of the document at base
+// in the single file: a data: URI holding it, or its absolute URL in MHTML
+// files. Resources that can't be fetched are left as absolute URLs.
+func (s *singleFile) embed(base *url.URL, val string) string {
+	trimmed := strings.TrimSpace(val)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || hasPrefixFold(trimmed, "data:") {
+		return val
+	}
+	ref, err := url.Parse(trimmed)
+	if err != nil {
+		return val
+	}
+	target := base.ResolveReference(ref)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return val
+	}
+	// SVG sprites are referenced as file.svg#icon
+	fragment := ""
+	if target.Fragment != "" {
+		fragment = "#" + target.EscapedFragment()
+	}
+	target.Fragment = ""
+
+	res := s.fetch(target)
+	if res == nil || s.mhtml {
+		return target.String() + fragment
+	}
+	return "data:" + res.contentType + ";base64," + base64.StdEncoding.EncodeToString(res.data) + fragment
+}
+
+// fetch returns a resource, downloading it the first time. The references
+// of a stylesheet are inlined in turn; one referencing a stylesheet being
+// inlined (an @import loop) gets its URL.
+func (s *singleFile) fetch(u *url.URL) *resource {
+	key := u.String()
+	if res, ok := s.resources[key]; ok {
+		return res
+	}
+	s.resources[key] = nil
+	if s.m.interrupted() {
+		return nil
+	}
+
+	s.m.logf("Downloading: %s\n", key)
+	res, err := s.get(u)
+	if err != nil {
+		if errors.Is(err, errFileTooLarge) {
+			s.m.skip(key, skipTooLarge)
+		} else if !s.m.interrupted() {
+			s.m.logf("failed to download %s: %v\n", key, err)
+		}
+		return nil
+	}
+	if strings.HasPrefix(res.contentType, "text/css") {
+		res.data = []byte(rewriteCSSLinks(string(res.data), func(val string) string {
+			return s.embed(u, val)
+		}))
+	}
+	s.resources[key] = res
+	s.parts = append(s.parts, res)
+	s.size += int64(len(res.data))
+	return res
+}
+
+// get downloads a URL, with the content type it was served with or else
+// sniffed, and its charset for text.
+func (s *singleFile) get(u *url.URL) (*resource, error) {
+	req, err := http.NewRequestWithContext(s.m.context(), "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+	if s.m.ConsentBypass {
+		addConsentCookies(req)
+	}
+	resp, err := s.m.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	if s.m.tooLarge(resp.ContentLength) {
+		return nil, errFileTooLarge
+	}
+	data, err := io.ReadAll(s.m.limitSize(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", nil
+	}
+	if charset := params["charset"]; charset != "" && strings.HasPrefix(mediaType, "text/") {
+		mediaType += ";charset=" + charset
+	}
+	return &resource{url: u.String(), contentType: mediaType, data: data}, nil
+}
+
+// absoluteLink returns a link of the page at base as an absolute URL, so it
+// points at the same place from the saved file. Links that aren't http or
+// https are left alone.
+func absoluteLink(base *url.URL, val string) string {
+	trimmed := strings.TrimSpace(val)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return val
+	}
+	ref, err := url.Parse(trimmed)
+	if err != nil || ref.IsAbs() {
+		return val
+	}
+	target := base.ResolveReference(ref)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return val
+	}
+	return target.String()
+}
+
+// writeMHTML writes a page and its resources as an MHTML archive: a
+// multipart/related message whose parts are found by their
+// Content-Location, the URL the page refers to them by.
+func writeMHTML(w io.Writer, pageURL string, html []byte, parts []*resource) error {
+	mw := multipart.NewWriter(w)
+	fmt.Fprintf(w, "From: <Saved by wget>\r\n")
+	fmt.Fprintf(w, "Snapshot-Content-Location: %s\r\n", pageURL)
+	fmt.Fprintf(w, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(w, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(w, "Content-Type: multipart/related;\r\n\ttype=\"text/html\";\r\n\tboundary=\"%s\"\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+		"Content-Location":          {pageURL},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write(html); err != nil {
+		return err
+	}
+	if err := qp.Close(); err != nil {
+		return err
+	}
+
+	for _, res := range parts {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {res.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Location":          {res.url},
+		})
+		if err != nil {
+			return err
+		}
+		// Base64 lines are at most 76 characters in MIME
+		encoded := base64.StdEncoding.EncodeToString(res.data)
+		for len(encoded) > 76 {
+			io.WriteString(part, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(part, encoded+"\r\n")
+	}
+	return mw.Close()
+}
@@ -0,0 +1,56 @@
+package mirror
+
+import "strings"
+
+// srcsetCandidate is one image of a srcset attribute, such as
+// "photo-2x.jpg 2x" or "photo-800.jpg 800w".
+type srcsetCandidate struct {
+	url        string
+	descriptor string // Empty when the candidate has none
+}
+
+// parseSrcset splits a srcset attribute into its image candidates. A URL is
+// a run of non-space characters, so commas inside it (as in data: URLs) are
+// kept unless they end it; the descriptor runs to the next comma.
+func parseSrcset(val string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	for val != "" {
+		val = strings.TrimLeft(val, " \t\n\r\f,")
+		if val == "" {
+			break
+		}
+		end := strings.IndexAny(val, " \t\n\r\f")
+		if end < 0 {
+			end = len(val)
+		}
+		candidate := srcsetCandidate{url: val[:end]}
+		val = val[end:]
+
+		if trimmed := strings.TrimRight(candidate.url, ","); trimmed != candidate.url {
+			// A comma right after the URL ends a candidate without descriptor.
+			candidate.url = trimmed
+		} else if comma := strings.IndexByte(val, ','); comma >= 0 {
+			candidate.descriptor = strings.TrimSpace(val[:comma])
+			val = val[comma+1:]
+		} else {
+			candidate.descriptor = strings.TrimSpace(val)
+			val = ""
+		}
+		if candidate.url != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// formatSrcset joins image candidates back into a srcset attribute.
+func formatSrcset(candidates []srcsetCandidate) string {
+	parts := make([]string, len(candidates))
+	for i, c := range candidates {
+		parts[i] = c.url
+		if c.descriptor != "" {
+			parts[i] += " " + c.descriptor
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,103 @@
+package mirror
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+
+	"wget/utils"
+)
+
+// crawlStats collects the number and size of saved files per content type
+// and per directory, so users can see what dominated a mirror.
+type crawlStats struct {
+	mu     sync.Mutex
+	byType map[string]*statEntry
+	byDir  map[string]*statEntry
+	bytes  int64 // Size of all the files
+}
+
+type statEntry struct {
+	name  string
+	count int
+	bytes int64
+}
+
+// record adds a saved file to the statistics.
+func (s *crawlStats) record(u *url.URL, contentType string, size int64) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" {
+		mediaType = "unknown"
+	}
+
+	dir := path.Dir(u.Path)
+	if dir == "." || dir == "" {
+		dir = "/"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.byType == nil {
+		s.byType = make(map[string]*statEntry)
+		s.byDir = make(map[string]*statEntry)
+	}
+	addStat(s.byType, mediaType, size)
+	addStat(s.byDir, dir, size)
+	s.bytes += size
+}
+
+// total returns the size of the files recorded so far.
+func (s *crawlStats) total() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+func addStat(stats map[string]*statEntry, name string, size int64) {
+	entry, ok := stats[name]
+	if !ok {
+		entry = &statEntry{name: name}
+		stats[name] = entry
+	}
+	entry.count++
+	entry.bytes += size
+}
+
+// sortedStats returns the entries ordered by size, largest first.
+func sortedStats(stats map[string]*statEntry) []*statEntry {
+	entries := make([]*statEntry, 0, len(stats))
+	for _, entry := range stats {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].bytes != entries[j].bytes {
+			return entries[i].bytes > entries[j].bytes
+		}
+		return entries[i].name < entries[j].name
+	})
+	return entries
+}
+
+// printStats prints the per-content-type and per-directory breakdown of the
+// files saved during the crawl.
+func (m *MirrorParams) printStats() {
+	m.stats.mu.Lock()
+	defer m.stats.mu.Unlock()
+
+	if len(m.stats.byType) == 0 {
+		return
+	}
+
+	m.logf("\nBy content type:\n")
+	for _, entry := range sortedStats(m.stats.byType) {
+		m.logf("  %-30s %6d files %12s\n", entry.name, entry.count, utils.FormatBytes(entry.bytes))
+	}
+
+	m.logf("\nBy directory:\n")
+	for _, entry := range sortedStats(m.stats.byDir) {
+		m.logf("  %-30s %6d files %12s\n", entry.name, entry.count, utils.FormatBytes(entry.bytes))
+	}
+}
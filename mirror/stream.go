@@ -0,0 +1,40 @@
+package mirror
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// partSuffix marks a file still being written by the crawl.
+const partSuffix = ".part"
+
+// saveStream copies body to outputPath without holding it in memory, through
+// a .part file renamed once complete so an interrupted transfer never
+// passes for the whole file. It returns the number of bytes saved.
+func (m *MirrorParams) saveStream(u *url.URL, body io.Reader, contentType, outputPath string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return 0, err
+	}
+	partPath := outputPath + partSuffix
+	file, err := os.Create(partPath)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(m.Quota.Writer(file), body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partPath, outputPath)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return size, err
+	}
+
+	m.saved(u, outputPath, contentType, size)
+	return size, nil
+}
@@ -0,0 +1,202 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"wget/utils"
+)
+
+// Reasons URLs are skipped for, as listed in the summary of a mirror.
+const (
+	skipExternal    = "external domain"
+	skipParent      = "above the start directory (--no-parent)"
+	skipRegex       = "matches --reject-regex"
+	skipExcluded    = "excluded path (-X)"
+	skipRobots      = "disallowed by robots.txt"
+	skipRejected    = "rejected type (-R)"
+	skipNotNewer    = "not modified since --newer-than"
+	skipQuota       = "download quota exceeded"
+	skipNotAccepted = "not accepted (-A)"
+	skipTooLarge    = "larger than --max-file-size"
+)
+
+// crawlSummary collects what became of the URLs a mirror came across, to
+// judge how complete it is: those skipped and why, and the links that
+// turned out broken.
+type crawlSummary struct {
+	mu      sync.Mutex
+	started time.Time
+	skipped []skippedURL
+	broken  []brokenLink
+
+	referrers sync.Map // Page each URL was first found on, by urlKey
+}
+
+// skippedURL is a URL the crawl didn't save.
+type skippedURL struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// brokenLink is a URL the server answered with an error status, or that
+// couldn't be fetched at all.
+type brokenLink struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Referrer   string `json:"referrer,omitempty"` // Page the link was first found on
+}
+
+// summaryRecord is the on-disk format of the summary (--report-file).
+type summaryRecord struct {
+	URL      string         `json:"url"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Elapsed  float64        `json:"elapsed_seconds"`
+	Files    int            `json:"files"`
+	Bytes    int64          `json:"bytes"`
+	Skipped  []skippedURL   `json:"skipped"`
+	Broken   []brokenLink   `json:"broken"`
+	ByReason map[string]int `json:"skipped_by_reason,omitempty"`
+
+	Deduplicated int   `json:"deduplicated,omitempty"`      // Files replaced by links to a copy (--dedup)
+	DedupSaved   int64 `json:"dedup_saved_bytes,omitempty"` // Space the links saved
+}
+
+// skip records a URL the crawl left out, and logs it.
+func (m *MirrorParams) skip(urlStr, reason string) {
+	m.logf("Skipping %s: %s\n", urlStr, reason)
+	m.summary.mu.Lock()
+	defer m.summary.mu.Unlock()
+	m.summary.skipped = append(m.summary.skipped, skippedURL{URL: urlStr, Reason: reason})
+}
+
+// foundOn remembers the page a URL was first found on, for the broken link
+// report.
+func (m *MirrorParams) foundOn(u, pageURL *url.URL) {
+	m.summary.referrers.LoadOrStore(m.urlKey(u), pageURL.String())
+}
+
+// broken records a URL that couldn't be fetched, with the status the server
+// answered or the error of the request.
+func (m *MirrorParams) broken(u *url.URL, statusCode int, err error) {
+	link := brokenLink{URL: u.String(), StatusCode: statusCode}
+	if err != nil {
+		link.Error = err.Error()
+	}
+	if referrer, ok := m.summary.referrers.Load(m.urlKey(u)); ok {
+		link.Referrer = referrer.(string)
+	}
+	m.summary.mu.Lock()
+	defer m.summary.mu.Unlock()
+	m.summary.broken = append(m.summary.broken, link)
+}
+
+// summarize returns the summary of the crawl so far, its lists sorted by URL.
+func (m *MirrorParams) summarize() summaryRecord {
+	rec := summaryRecord{URL: m.URL, Finished: time.Now(), ByReason: make(map[string]int)}
+
+	m.stats.mu.Lock()
+	for _, entry := range m.stats.byType {
+		rec.Files += entry.count
+		rec.Bytes += entry.bytes
+	}
+	m.stats.mu.Unlock()
+
+	m.summary.mu.Lock()
+	rec.Started = m.summary.started
+	rec.Skipped = append([]skippedURL{}, m.summary.skipped...)
+	rec.Broken = append([]brokenLink{}, m.summary.broken...)
+	m.summary.mu.Unlock()
+
+	m.dedup.mu.Lock()
+	rec.Deduplicated, rec.DedupSaved = m.dedup.files, m.dedup.bytes
+	m.dedup.mu.Unlock()
+
+	rec.Elapsed = rec.Finished.Sub(rec.Started).Seconds()
+	for _, s := range rec.Skipped {
+		rec.ByReason[s.Reason]++
+	}
+	sort.Slice(rec.Skipped, func(i, j int) bool { return rec.Skipped[i].URL < rec.Skipped[j].URL })
+	sort.Slice(rec.Broken, func(i, j int) bool { return rec.Broken[i].URL < rec.Broken[j].URL })
+	return rec
+}
+
+// printSummary prints the totals of the crawl, the number of URLs skipped
+// for each reason and the broken links found.
+func (m *MirrorParams) printSummary(rec summaryRecord) {
+	elapsed := time.Duration(rec.Elapsed * float64(time.Second)).Round(time.Second)
+	m.logf("\nMirrored %s in %s: %d files, %s\n", m.URL, elapsed, rec.Files, utils.FormatBytes(rec.Bytes))
+	if rec.Deduplicated > 0 {
+		m.logf("Linked %d duplicate files to their first copy, saving %s\n", rec.Deduplicated, utils.FormatBytes(rec.DedupSaved))
+	}
+	m.printSkipped(rec)
+}
+
+// printSkipped prints the number of URLs skipped for each reason and the
+// broken links found.
+func (m *MirrorParams) printSkipped(rec summaryRecord) {
+	if len(rec.Skipped) > 0 {
+		reasons := make([]string, 0, len(rec.ByReason))
+		for reason := range rec.ByReason {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			if rec.ByReason[reasons[i]] != rec.ByReason[reasons[j]] {
+				return rec.ByReason[reasons[i]] > rec.ByReason[reasons[j]]
+			}
+			return reasons[i] < reasons[j]
+		})
+		m.logf("\nSkipped %d URLs:\n", len(rec.Skipped))
+		for _, reason := range reasons {
+			m.logf("  %-42s %6d\n", reason, rec.ByReason[reason])
+		}
+	}
+
+	if len(rec.Broken) > 0 {
+		m.logf("\nBroken links (%d):\n", len(rec.Broken))
+		for _, link := range rec.Broken {
+			line := fmt.Sprintf("%d %s", link.StatusCode, link.URL)
+			if link.Error != "" {
+				line = link.URL + ": " + link.Error
+			}
+			if link.Referrer != "" {
+				line += " (linked from " + link.Referrer + ")"
+			}
+			m.logf("  %s\n", line)
+		}
+	}
+}
+
+// reportSummary prints the summary of a mirror and writes it to ReportFile.
+// Warming and link extraction have their own.
+func (m *MirrorParams) reportSummary() {
+	if !m.savesFiles() {
+		return
+	}
+	rec := m.summarize()
+	m.printSummary(rec)
+	if m.ReportFile != "" {
+		if err := writeSummary(m.ReportFile, rec); err != nil {
+			m.logf("Warning: %v\n", err)
+		}
+	}
+}
+
+// writeSummary saves the summary as JSON to path.
+func writeSummary(path string, rec summaryRecord) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %v", path, err)
+	}
+	return nil
+}
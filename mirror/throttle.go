@@ -0,0 +1,49 @@
+package mirror
+
+import (
+	"net/http"
+	"time"
+
+	"wget/httpclient"
+)
+
+// retryLater queues a URL the server answered 429 or 503 for to be fetched
+// again after the delay of its Retry-After header. It reports false once the
+// URL was retried httpclient.MaxThrottleRetries times, when the response is
+// to be treated as a failure.
+func (m *MirrorParams) retryLater(urlStr string, resp *http.Response, next *crawlLevel) bool {
+	attempt := 0
+	if n, ok := m.throttled.Load(urlStr); ok {
+		attempt = n.(int)
+	}
+	if attempt >= httpclient.MaxThrottleRetries {
+		return false
+	}
+	m.throttled.Store(urlStr, attempt+1)
+
+	delay := httpclient.RetryDelay(resp, attempt)
+	m.logf("Server busy (%s), retrying %s in %s\n", resp.Status, urlStr, delay)
+	next.retry(urlStr, time.Now().Add(delay))
+	return true
+}
+
+// retry queues a URL of the current level to be fetched again at the given
+// time. URLs retried together wait for the latest of their times.
+func (l *crawlLevel) retry(u string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retries = append(l.retries, u)
+	if at.After(l.retryAt) {
+		l.retryAt = at
+	}
+}
+
+// takeRetries returns the URLs queued by retry and the time they may be
+// fetched, and empties the queue.
+func (l *crawlLevel) takeRetries() ([]string, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	retries, at := l.retries, l.retryAt
+	l.retries, l.retryAt = nil, time.Time{}
+	return retries, at
+}
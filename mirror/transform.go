@@ -0,0 +1,301 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Actions of the --transform rules applied to saved pages.
+const (
+	TransformBanner = "banner" // Insert a banner at the top of the body
+	TransformStrip  = "strip"  // Remove the elements matching a selector
+	TransformBase   = "base"   // Insert a <base href> into the head
+)
+
+// defaultBanner is the banner text when the rule doesn't give one. {url} and
+// {date} stand for the page's URL and the day it was saved.
+const defaultBanner = "Archived copy of {url}, saved {date}"
+
+// Transform is a rule rewriting the HTML of saved pages, so offline copies
+// can be marked as archives and cleaned of ads and trackers.
+type Transform struct {
+	Action string    // One of the Transform* constants
+	Value  string    // Banner text, selector or base URL
+	match  *selector // Elements removed by TransformStrip
+}
+
+// ParseTransforms parses --transform rules of the form action[=value]:
+//
+//	banner[=TEXT]  insert a banner, TEXT may use {url} and {date}
+//	strip=SELECTOR remove elements, e.g. iframe, .ad, #promo or iframe[src*=ads]
+//	base[=URL]     insert <base href>, the page's URL by default
+func ParseTransforms(rules []string) ([]Transform, error) {
+	var transforms []Transform
+	for _, rule := range rules {
+		action, value, _ := strings.Cut(rule, "=")
+		t := Transform{Action: strings.ToLower(strings.TrimSpace(action)), Value: strings.TrimSpace(value)}
+		switch t.Action {
+		case TransformBanner:
+			if t.Value == "" {
+				t.Value = defaultBanner
+			}
+		case TransformStrip:
+			match, err := parseSelector(t.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform %q: %v", rule, err)
+			}
+			t.match = match
+		case TransformBase:
+			if t.Value != "" {
+				if u, err := url.Parse(t.Value); err != nil || !u.IsAbs() {
+					return nil, fmt.Errorf("invalid transform %q: base needs an absolute URL", rule)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown transform %q, expected banner, strip or base", rule)
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
+
+// selector is the subset of CSS selectors strip rules support: a tag name,
+// class or ID, optionally followed by one attribute condition.
+type selector struct {
+	tag, class, id string
+	attr, op, val  string // op is "" (attribute present), "=" or "*=" (contains)
+}
+
+// parseSelector parses selectors like iframe, div.ad, #banner or
+// iframe[src*=doubleclick].
+func parseSelector(s string) (*selector, error) {
+	sel := &selector{}
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated [ in selector %q", s)
+		}
+		cond := s[i+1 : len(s)-1]
+		s = s[:i]
+		switch {
+		case strings.Contains(cond, "*="):
+			sel.attr, sel.val, _ = strings.Cut(cond, "*=")
+			sel.op = "*="
+		case strings.Contains(cond, "="):
+			sel.attr, sel.val, _ = strings.Cut(cond, "=")
+			sel.op = "="
+		default:
+			sel.attr = cond
+		}
+		sel.attr = strings.ToLower(strings.TrimSpace(sel.attr))
+		sel.val = strings.Trim(strings.TrimSpace(sel.val), `"'`)
+		if sel.attr == "" {
+			return nil, fmt.Errorf("missing attribute name in selector %q", s)
+		}
+	}
+	if i := strings.IndexAny(s, ".#"); i >= 0 {
+		if s[i] == '.' {
+			sel.class = s[i+1:]
+		} else {
+			sel.id = s[i+1:]
+		}
+		s = s[:i]
+	}
+	sel.tag = strings.ToLower(s)
+	if sel.tag == "" && sel.class == "" && sel.id == "" && sel.attr == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return sel, nil
+}
+
+// matches reports whether a start tag matches the selector.
+func (s *selector) matches(token html.Token) bool {
+	if s.tag != "" && token.Data != s.tag {
+		return false
+	}
+	if class, _ := attrValue(token, "class"); s.class != "" && !containsField(class, s.class) {
+		return false
+	}
+	if id, _ := attrValue(token, "id"); s.id != "" && id != s.id {
+		return false
+	}
+	if s.attr == "" {
+		return true
+	}
+	val, ok := attrValue(token, s.attr)
+	switch s.op {
+	case "=":
+		return ok && val == s.val
+	case "*=":
+		return ok && strings.Contains(val, s.val)
+	}
+	return ok
+}
+
+// containsField reports whether the space separated list contains word.
+func containsField(list, word string) bool {
+	for _, field := range strings.Fields(list) {
+		if field == word {
+			return true
+		}
+	}
+	return false
+}
+
+// attrValue returns the value of a tag's attribute and whether it is set.
+func attrValue(token html.Token, key string) (string, bool) {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// voidElements have no end tag, so stripping one removes just the tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// transformHTML applies the --transform rules (and those removing consent
+// dialogs) and then the --transform-exec command to a page about to be saved. Like rewriteHTML, it copies the markup
+// it doesn't change byte for byte. A failing command is reported and the
+// page is saved without its changes.
+func (m *MirrorParams) transformHTML(pageURL *url.URL, outputPath string, body []byte) []byte {
+	transforms := m.Transforms
+	if m.ConsentBypass {
+		transforms = append(append([]Transform(nil), consentTransforms...), transforms...)
+	}
+	if len(transforms) > 0 {
+		body = applyTransforms(transforms, pageURL, body)
+	}
+	if m.TransformExec != "" {
+		out, err := runTransformExec(m.TransformExec, pageURL, outputPath, body)
+		if err != nil {
+			m.logf("%v\n", err)
+		} else {
+			body = out
+		}
+	}
+	return body
+}
+
+// applyTransforms rewrites a page with the rules: elements matched by strip
+// rules are dropped, the base is added to the head and the banner after
+// <body>, or at the end of pages without one. Pages the tokenizer fails on
+// are returned unchanged.
+func applyTransforms(transforms []Transform, pageURL *url.URL, body []byte) []byte {
+	var base, banner strings.Builder
+	for _, t := range transforms {
+		switch t.Action {
+		case TransformBase:
+			if base.Len() == 0 { // Only the first <base> counts
+				href := t.Value
+				if href == "" {
+					href = pageURL.String()
+				}
+				fmt.Fprintf(&base, `<base href="%s">`, html.EscapeString(href))
+			}
+		case TransformBanner:
+			text := strings.NewReplacer("{url}", pageURL.String(), "{date}", time.Now().Format("2006-01-02")).Replace(t.Value)
+			fmt.Fprintf(&banner, `<div class="wget-archive-banner" style="padding:8px;background:#ffd;border-bottom:1px solid #cc9;font:14px sans-serif;color:#000">%s</div>`, html.EscapeString(text))
+		}
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	var out bytes.Buffer
+	out.Grow(len(body) + base.Len() + banner.Len())
+	skipping, skipDepth := "", 0 // Tag name and nesting of the element being stripped
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return body
+			}
+			break
+		}
+		raw := append([]byte(nil), z.Raw()...)
+
+		if skipping != "" {
+			name, _ := z.TagName()
+			switch {
+			case tt == html.StartTagToken && string(name) == skipping:
+				skipDepth++
+			case tt == html.EndTagToken && string(name) == skipping:
+				if skipDepth--; skipDepth == 0 {
+					skipping = ""
+				}
+			}
+			continue
+		}
+
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(raw)
+			continue
+		}
+		token := z.Token()
+		if stripped(transforms, token) {
+			if tt == html.StartTagToken && !voidElements[token.Data] {
+				skipping, skipDepth = token.Data, 1
+			}
+			continue
+		}
+		// Without a <head>, the base goes before the first element, which
+		// the browser then puts in the implied head.
+		if token.Data != "html" && token.Data != "head" {
+			out.WriteString(base.String())
+			base.Reset()
+		}
+		out.Write(raw)
+		switch token.Data {
+		case "head":
+			out.WriteString(base.String())
+			base.Reset()
+		case "body":
+			out.WriteString(banner.String())
+			banner.Reset()
+		}
+	}
+
+	result := append([]byte(base.String()), out.Bytes()...)
+	return append(result, banner.String()...)
+}
+
+// stripped reports whether a strip rule matches a start tag.
+func stripped(transforms []Transform, token html.Token) bool {
+	for _, t := range transforms {
+		if t.match != nil && t.match.matches(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// runTransformExec pipes a page through a shell command, which gets the URL
+// and the file the page is saved as in WGET_URL and WGET_FILE, and returns
+// what the command printed.
+func runTransformExec(command string, pageURL *url.URL, outputPath string, body []byte) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "WGET_FILE="+outputPath, "WGET_URL="+pageURL.String())
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = os.Stderr
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("transform command %q failed for %s: %v", command, pageURL, err)
+	}
+	if out.Len() == 0 {
+		return nil, fmt.Errorf("transform command %q printed nothing for %s", command, pageURL)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// validatorsName is the file in the output directory holding the
+// validators of the mirrored files (--incremental).
+const validatorsName = "wget-validators.json"
+
+// validatorEntry holds the validators the server sent with a mirrored file,
+// sent back on the next run to only fetch it again if it changed.
+type validatorEntry struct {
+	URL          string `json:"url"` // urlKey of the file's URL
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validatorCache holds the validators of the files of a mirror, those of
+// earlier runs updated with the responses of this one.
+type validatorCache struct {
+	mu      sync.Mutex
+	entries map[string]validatorEntry // By urlKey
+}
+
+// incremental reports whether the crawl sends conditional requests for the
+// files of earlier runs. Warming, link extraction and dry runs save no
+// files.
+func (m *MirrorParams) incremental() bool {
+	return m.Incremental && m.savesFiles()
+}
+
+// loadValidators reads the validators saved by the previous run.
+func (m *MirrorParams) loadValidators() {
+	m.validators.mu.Lock()
+	defer m.validators.mu.Unlock()
+	m.validators.entries = make(map[string]validatorEntry)
+
+	data, err := os.ReadFile(filepath.Join(m.OutputDir, validatorsName))
+	if err != nil {
+		return
+	}
+	var entries []validatorEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		m.logf("Warning: ignoring %s: %v\n", validatorsName, err)
+		return
+	}
+	for _, entry := range entries {
+		m.validators.entries[entry.URL] = entry
+	}
+}
+
+// setConditional makes req conditional on the validators saved for its URL,
+// when the file at outputPath is still there to fall back on. It reports
+// whether it did.
+func (m *MirrorParams) setConditional(req *http.Request, u *url.URL, outputPath string) bool {
+	m.validators.mu.Lock()
+	entry, ok := m.validators.entries[m.urlKey(u)]
+	m.validators.mu.Unlock()
+	if !ok || !fileExists(m.originalPath(outputPath)) {
+		return false
+	}
+
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+	return true
+}
+
+// recordValidators saves the validators of a response for the next run.
+func (m *MirrorParams) recordValidators(u *url.URL, resp *http.Response) {
+	key := m.urlKey(u)
+	entry := validatorEntry{URL: key, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+
+	m.validators.mu.Lock()
+	defer m.validators.mu.Unlock()
+	if entry.ETag == "" && entry.LastModified == "" {
+		delete(m.validators.entries, key)
+		return
+	}
+	m.validators.entries[key] = entry
+}
+
+// writeValidators saves the validators to the output directory.
+func (m *MirrorParams) writeValidators() error {
+	m.validators.mu.Lock()
+	defer m.validators.mu.Unlock()
+
+	list := make([]validatorEntry, 0, len(m.validators.entries))
+	for _, entry := range m.validators.entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(m.OutputDir, validatorsName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write validators: %v", err)
+	}
+	return nil
+}
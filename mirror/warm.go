@@ -0,0 +1,47 @@
+package mirror
+
+import (
+	"net/http"
+	"sync"
+
+	"wget/httpclient"
+	"wget/utils"
+)
+
+// warmStats counts the responses of a crawl warming caches, by cache status.
+type warmStats struct {
+	mu                   sync.Mutex
+	warmed, hits, misses int
+}
+
+// warmed reports a response fetched to warm the caches, size bytes long.
+func (m *MirrorParams) warmed(urlStr string, resp *http.Response, size int64) {
+	cache := httpclient.CacheStatus(resp)
+	m.warm.mu.Lock()
+	m.warm.warmed++
+	switch cache {
+	case httpclient.CacheHit:
+		m.warm.hits++
+	case httpclient.CacheMiss:
+		m.warm.misses++
+	}
+	m.warm.mu.Unlock()
+
+	if cache == "" {
+		cache = "unknown"
+	}
+	m.logf("[WARM] %s: %s, %s, cache %s\n", urlStr, resp.Status, utils.FormatBytes(size), cache)
+}
+
+// warmCrawl crawls the site like a mirror, reading every response without
+// saving anything, so the caches in front of the site store it.
+func (m *MirrorParams) warmCrawl() error {
+	m.logf("Warming caches from %s\n", m.URL)
+	err := m.ProcessUrlWrapper(m.URL)
+
+	m.warm.mu.Lock()
+	defer m.warm.mu.Unlock()
+	m.logf("\nWarmed %d URLs (%d cache hits, %d misses, %d unknown)\n",
+		m.warm.warmed, m.warm.hits, m.warm.misses, m.warm.warmed-m.warm.hits-m.warm.misses)
+	return err
+}
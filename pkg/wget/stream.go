@@ -0,0 +1,157 @@
+package wget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"wget/download"
+	"wget/utils"
+)
+
+// ProgressOption configures the reports of a ProgressReader or ProgressWriter.
+type ProgressOption func(*progressTracker)
+
+// WithName sets the File field of the reports, to tell streams apart when
+// several share a ProgressFunc.
+func WithName(name string) ProgressOption {
+	return func(t *progressTracker) { t.progress.File = name }
+}
+
+// WithOffset starts the count at offset, for streams continuing a transfer
+// of which offset bytes were already handled.
+func WithOffset(offset int64) ProgressOption {
+	return func(t *progressTracker) { t.progress.Downloaded = offset }
+}
+
+// WithInterval reports the progress at most once per interval instead of on
+// every read or write. The final report is always made.
+func WithInterval(interval time.Duration) ProgressOption {
+	return func(t *progressTracker) { t.interval = interval }
+}
+
+// progressTracker counts the bytes of a stream and reports them.
+type progressTracker struct {
+	report   ProgressFunc
+	progress Progress
+	interval time.Duration
+	last     time.Time // Time of the previous report
+}
+
+func newProgressTracker(total int64, report ProgressFunc, opts []ProgressOption) *progressTracker {
+	if total < 0 {
+		total = -1
+	}
+	t := &progressTracker{report: report, progress: Progress{Total: total}}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// add counts n more bytes and reports them unless the last report is too recent.
+func (t *progressTracker) add(n int) {
+	t.progress.Downloaded += int64(n)
+	if t.interval > 0 && time.Since(t.last) < t.interval {
+		return
+	}
+	t.last = time.Now()
+	t.report(t.progress)
+}
+
+// finish makes the final report, once.
+func (t *progressTracker) finish() {
+	if t.progress.Done {
+		return
+	}
+	t.progress.Done = true
+	t.report(t.progress)
+}
+
+// ProgressReader reports the progress of reading from a stream to a
+// ProgressFunc, the way downloads report theirs.
+type ProgressReader struct {
+	reader  io.Reader
+	tracker *progressTracker
+}
+
+// NewProgressReader returns a reader reading from r and reporting each read
+// to report. total is the expected size, -1 when unknown. The last report,
+// with Done set, is made when r returns io.EOF.
+func NewProgressReader(r io.Reader, total int64, report ProgressFunc, opts ...ProgressOption) *ProgressReader {
+	return &ProgressReader{reader: r, tracker: newProgressTracker(total, report, opts)}
+}
+
+// Read reads from the underlying reader and reports the progress.
+func (p *ProgressReader) Read(data []byte) (int, error) {
+	n, err := p.reader.Read(data)
+	if n > 0 {
+		p.tracker.add(n)
+	}
+	if errors.Is(err, io.EOF) {
+		p.tracker.finish()
+	}
+	return n, err
+}
+
+// ProgressWriter reports the progress of writing to a stream to a
+// ProgressFunc, the way downloads report theirs.
+type ProgressWriter struct {
+	writer  io.Writer
+	tracker *progressTracker
+}
+
+// NewProgressWriter returns a writer writing to w and reporting each write
+// to report. total is the expected size, -1 when unknown. Close makes the
+// last report, with Done set.
+func NewProgressWriter(w io.Writer, total int64, report ProgressFunc, opts ...ProgressOption) *ProgressWriter {
+	return &ProgressWriter{writer: w, tracker: newProgressTracker(total, report, opts)}
+}
+
+// Write writes to the underlying writer and reports the progress.
+func (p *ProgressWriter) Write(data []byte) (int, error) {
+	n, err := p.writer.Write(data)
+	if n > 0 {
+		p.tracker.add(n)
+	}
+	return n, err
+}
+
+// Close reports the completed transfer. The underlying writer is left open.
+func (p *ProgressWriter) Close() error {
+	p.tracker.finish()
+	return nil
+}
+
+// NewRateLimitedReader returns a reader reading from r no faster than limit,
+// given as with Options.RateLimit (e.g., 200k, 2M).
+func NewRateLimitedReader(r io.Reader, limit string) (io.Reader, error) {
+	bandwidth, err := parseLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	return download.NewRateLimitedReader(r, bandwidth), nil
+}
+
+// NewRateLimitedWriter returns a writer writing to w no faster than limit,
+// given as with Options.RateLimit (e.g., 200k, 2M).
+func NewRateLimitedWriter(w io.Writer, limit string) (io.Writer, error) {
+	bandwidth, err := parseLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	return download.NewRateLimitedWriter(w, bandwidth), nil
+}
+
+// parseLimit returns the bytes per second of a rate limit.
+func parseLimit(limit string) (int64, error) {
+	bandwidth, err := utils.ParseRateLimit(limit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate limit %q: %v", limit, err)
+	}
+	if bandwidth <= 0 {
+		return 0, fmt.Errorf("invalid rate limit %q: must be positive", limit)
+	}
+	return bandwidth, nil
+}
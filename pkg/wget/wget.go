@@ -0,0 +1,200 @@
+// Package wget is the API for using the downloader from other Go programs.
+// Nothing is printed: progress is reported through a ProgressFunc and
+// messages are only written when a Log writer is given.
+package wget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"wget/download"
+	"wget/httpclient"
+	"wget/mirror"
+)
+
+// Progress describes how far a transfer has come.
+type Progress = download.Progress
+
+// ProgressFunc is called with the progress of a transfer each time data is
+// received. Concurrent downloads call it from several goroutines.
+type ProgressFunc = download.ProgressFunc
+
+// Result describes the outcome of a download.
+type Result = download.DownloadResult
+
+// Phase is the stage at which a download failed, as in Result.Failure.
+type Phase = download.Phase
+
+// Phases of failed downloads, telling network problems from server errors.
+const (
+	PhaseDNS         = download.PhaseDNS         // The host name couldn't be resolved
+	PhaseConnect     = download.PhaseConnect     // The TCP connection couldn't be established
+	PhaseTLS         = download.PhaseTLS         // The TLS handshake or certificate check failed
+	PhaseHTTP        = download.PhaseHTTP        // The server answered with an error status
+	PhaseBody        = download.PhaseBody        // The connection failed while the body was read
+	PhaseInterrupted = download.PhaseInterrupted // The context was cancelled or its deadline passed
+	PhaseOther       = download.PhaseOther       // Anything else, e.g. a full disk or a checksum mismatch
+)
+
+// FailurePhase returns the phase at which an error of a download function
+// happened, or "" when err is nil.
+func FailurePhase(err error) Phase {
+	return download.FailurePhase(err)
+}
+
+// Errors returned by the download functions, to be checked with errors.Is.
+var (
+	ErrInterrupted      = download.ErrInterrupted      // The context was cancelled or its deadline passed
+	ErrChecksumMismatch = download.ErrChecksumMismatch // The data doesn't match Options.Checksum
+	ErrBlockedAddress   = httpclient.ErrBlockedAddress // SafeMode refused to connect to a non-public address
+)
+
+// UnlimitedDepth makes Mirror follow links at any depth.
+const UnlimitedDepth = mirror.UnlimitedDepth
+
+// Options holds the settings applied to downloads.
+type Options struct {
+	OutputDir     string       // Directory files are saved in, the working directory when empty
+	OutputFile    string       // Name to save a single file under, derived from the URL when empty
+	RateLimit     string       // Maximum download speed (e.g., 200k, 2M)
+	Headers       []string     // Extra request headers in "Name: value" form
+	Checksum      string       // Expected digests as comma separated "algorithm:hex"
+	Continue      bool         // Resume partially downloaded files
+	TempDir       string       // Directory partial files are kept in until complete, next to the file when empty
+	Fsync         bool         // Flush each file and its directory to disk before reporting it saved
+	MaxConcurrent int          // Number of files DownloadAll fetches at once, one when unset
+	StateFile     string       // Lets DownloadAll resume the batch after a crash, see the --state-file flag
+	URLDB         string       // Lets DownloadAll skip the URLs earlier calls saved, see the --url-db flag
+	StripTracking bool         // Drop tracking parameters (utm_*, fbclid, ...) from URLs, see the --strip-tracking flag
+	Client        *http.Client // Client used for all requests, http.DefaultClient when nil
+	SafeMode      bool         // Only connect to public addresses, for untrusted URLs (can't be combined with Client)
+
+	Progress ProgressFunc // Receives the progress of every transfer
+	Log      io.Writer    // Receives the messages the command line tool prints, discarded when nil
+}
+
+// downloadOptions converts the options to those of the download package.
+func (o Options) downloadOptions() (download.Options, error) {
+	client, err := httpClient(o.Client, o.SafeMode, o.Log)
+	if err != nil {
+		return download.Options{}, err
+	}
+	return download.Options{
+		OutputFile:    o.OutputFile,
+		OutputDir:     outputDir(o.OutputDir),
+		RateLimit:     o.RateLimit,
+		Headers:       o.Headers,
+		Checksum:      o.Checksum,
+		Continue:      o.Continue,
+		TempDir:       o.TempDir,
+		Fsync:         o.Fsync,
+		MaxConcurrent: o.MaxConcurrent,
+		StateFile:     o.StateFile,
+		URLDB:         o.URLDB,
+		StripTracking: o.StripTracking,
+		Client:        client,
+		ProgressMode:  download.ProgressNone,
+		OnProgress:    o.Progress,
+		Log:           logOutput(o.Log),
+	}, nil
+}
+
+// Download saves the file at fileURL. When ctx ends, the data received so
+// far is kept in a .part file that a later call with Continue resumes.
+func Download(ctx context.Context, fileURL string, opts Options) (*Result, error) {
+	downloadOpts, err := opts.downloadOptions()
+	if err != nil {
+		return nil, err
+	}
+	return download.DownloadFileResult(ctx, fileURL, downloadOpts)
+}
+
+// DownloadAll saves the files at urls, opts.MaxConcurrent at a time. Each
+// file is named after its URL, opts.OutputFile is ignored. opts.Checksum
+// can't be set for more than one URL. It returns an error if any of the
+// downloads failed.
+func DownloadAll(ctx context.Context, urls []string, opts Options) error {
+	if opts.Checksum != "" && len(urls) > 1 {
+		return errors.New("Checksum verifies a single file, it can't be set for several URLs")
+	}
+	opts.OutputFile = ""
+	downloadOpts, err := opts.downloadOptions()
+	if err != nil {
+		return err
+	}
+	return download.DownloadMultipleFilesContext(ctx, urls, downloadOpts)
+}
+
+// MirrorOptions holds the settings applied to mirroring a site.
+type MirrorOptions struct {
+	OutputDir    string       // Directory the site is saved in, below a directory named after the host (the working directory when empty)
+	ConvertLinks bool         // Rewrite links in saved pages to point to the local copies
+	RejectTypes  []string     // File names or extensions not to save
+	ExcludePaths []string     // URL path prefixes not to crawl
+	Depth        int          // Levels of links followed from siteURL, 5 when 0 (UnlimitedDepth for no limit)
+	Concurrency  int          // Number of requests in flight at once, 8 when 0
+	Client       *http.Client // Client used for all requests, one keeping a connection per concurrent request open when nil
+	SafeMode     bool         // Only connect to public addresses, for untrusted URLs (can't be combined with Client)
+
+	Progress ProgressFunc // Called once for each saved file
+	Log      io.Writer    // Receives the messages the command line tool prints, discarded when nil
+}
+
+// Mirror saves the pages of the site at siteURL and the resources they link
+// to on the same host. Mirroring can't be cancelled yet.
+func Mirror(siteURL string, opts MirrorOptions) error {
+	if _, err := url.Parse(siteURL); err != nil {
+		return fmt.Errorf("invalid URL %s: %v", siteURL, err)
+	}
+	client, err := httpClient(opts.Client, opts.SafeMode, opts.Log)
+	if err != nil {
+		return err
+	}
+	params := mirror.GetMirrorParams(siteURL, outputDir(opts.OutputDir), opts.ConvertLinks, opts.RejectTypes, opts.ExcludePaths)
+	params.Client = client
+	if opts.Depth != 0 {
+		params.MaxDepth = opts.Depth
+	}
+	if opts.Concurrency > 0 {
+		params.MaxConcurrent = opts.Concurrency
+	}
+	params.OnProgress = opts.Progress
+	params.Log = logOutput(opts.Log)
+	return params.Mirror()
+}
+
+// httpClient returns the client requests are sent with. Safe mode needs a
+// client of its own, as the address check happens when connecting.
+func httpClient(client *http.Client, safeMode bool, log io.Writer) (*http.Client, error) {
+	if !safeMode {
+		return client, nil
+	}
+	if client != nil {
+		return nil, errors.New("SafeMode can't be combined with a custom Client")
+	}
+	return httpclient.New(httpclient.Config{
+		Log:         logOutput(log),
+		MaxRedirect: 20,
+		SafeMode:    true,
+	})
+}
+
+// outputDir returns the directory files are saved in.
+func outputDir(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
+// logOutput returns the writer messages go to, discarding them when log is nil.
+func logOutput(log io.Writer) io.Writer {
+	if log == nil {
+		return io.Discard
+	}
+	return log
+}
@@ -0,0 +1,102 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxIndexDepth limits how deep nested sitemap indexes are followed.
+const maxIndexDepth = 3
+
+// Entry is a single page listed in a sitemap.
+type Entry struct {
+	Loc     string
+	LastMod time.Time // Zero when the sitemap doesn't provide a lastmod
+}
+
+// document covers both <urlset> sitemaps and <sitemapindex> indexes, which
+// differ only in their element names.
+type document struct {
+	XMLName  xml.Name
+	URLs     []location `xml:"url"`
+	Sitemaps []location `xml:"sitemap"`
+}
+
+type location struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// Fetch downloads the sitemap at sitemapURL and returns every page it lists,
+// following nested sitemap indexes.
+func Fetch(client *http.Client, sitemapURL string) ([]Entry, error) {
+	return fetch(client, sitemapURL, 0)
+}
+
+func fetch(client *http.Client, sitemapURL string, depth int) ([]Entry, error) {
+	resp, err := client.Get(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: status %s", sitemapURL, resp.Status)
+	}
+
+	doc, err := parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %v", sitemapURL, err)
+	}
+
+	var entries []Entry
+	for _, u := range doc.URLs {
+		loc := strings.TrimSpace(u.Loc)
+		if loc == "" {
+			continue
+		}
+		entries = append(entries, Entry{Loc: loc, LastMod: parseLastMod(u.LastMod)})
+	}
+
+	if depth >= maxIndexDepth {
+		return entries, nil
+	}
+	for _, child := range doc.Sitemaps {
+		loc := strings.TrimSpace(child.Loc)
+		if loc == "" {
+			continue
+		}
+		childEntries, err := fetch(client, loc, depth+1)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			continue
+		}
+		entries = append(entries, childEntries...)
+	}
+
+	return entries, nil
+}
+
+func parse(r io.Reader) (*document, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// parseLastMod parses the W3C datetime formats allowed in <lastmod>,
+// returning the zero time when the value is missing or malformed.
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
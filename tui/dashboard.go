@@ -0,0 +1,413 @@
+// Package tui implements the --tui dashboard: a full-screen view of a batch
+// of downloads with a sortable transfer list, a detail pane for the selected
+// transfer, keys to pause and cancel transfers and the tail of the log.
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"wget/download"
+	"wget/utils"
+
+	"golang.org/x/term"
+)
+
+// States of a transfer.
+const (
+	stateQueued    = "queued"
+	stateActive    = "active"
+	statePaused    = "paused"
+	stateDone      = "done"
+	stateFailed    = "failed"
+	stateCancelled = "cancelled"
+	stateSkipped   = "skipped"
+)
+
+const (
+	maxLogLines    = 200                    // Log lines kept for the log pane
+	redrawInterval = 250 * time.Millisecond // How often the screen is refreshed
+	speedInterval  = 500 * time.Millisecond // Minimum time between speed samples
+)
+
+// transfer is the state of one file of the batch.
+type transfer struct {
+	index      int // Position in the batch
+	url        string
+	file       string
+	downloaded int64
+	total      int64
+	state      string
+	err        error
+	started    time.Time
+	finished   time.Time
+
+	speed       float64 // Bytes per second, smoothed
+	sampleTime  time.Time
+	sampleBytes int64
+
+	cancel context.CancelFunc
+	resume chan struct{} // Closed when a paused transfer is resumed
+}
+
+// Dashboard shows the progress of a batch of downloads on the terminal.
+// Everything else the program prints is shown in its log pane.
+type Dashboard struct {
+	in  *os.File // Terminal keys are read from
+	out *os.File // Terminal the dashboard is drawn on
+
+	logReader *os.File
+	logWriter *os.File
+	logDone   chan struct{} // Closed once all the output was read
+
+	mu        sync.Mutex
+	transfers []*transfer
+	byURL     map[string]*transfer
+	selected  string // URL of the selected transfer
+	sortBy    int    // Index into sortModes
+	logLines  []string
+	partial   string // Log output after the last newline
+	finished  bool   // The batch is over
+}
+
+// New creates a dashboard drawing on out and reading keys from in, which
+// must both be terminals.
+func New(in, out *os.File) (*Dashboard, error) {
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return nil, errors.New("--tui needs a terminal")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log pipe: %v", err)
+	}
+	d := &Dashboard{
+		in:        in,
+		out:       out,
+		logReader: r,
+		logWriter: w,
+		logDone:   make(chan struct{}),
+		byURL:     make(map[string]*transfer),
+	}
+	go d.readLog()
+	return d, nil
+}
+
+// Output returns the file the program's output should be written to while
+// the dashboard runs, shown in the log pane.
+func (d *Dashboard) Output() *os.File {
+	return d.logWriter
+}
+
+// readLog collects the lines written to the log pipe.
+func (d *Dashboard) readLog() {
+	defer close(d.logDone)
+	buf := make([]byte, 4096)
+	for {
+		n, err := d.logReader.Read(buf)
+		if n > 0 {
+			d.addLog(string(buf[:n]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// addLog appends output to the log pane, keeping the last maxLogLines lines.
+// Carriage returns start the line over, as progress lines use them.
+func (d *Dashboard) addLog(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := strings.Split(d.partial+text, "\n")
+	d.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if i := strings.LastIndex(line, "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		d.logLines = append(d.logLines, line)
+	}
+	if len(d.logLines) > maxLogLines {
+		d.logLines = d.logLines[len(d.logLines)-maxLogLines:]
+	}
+}
+
+// Run downloads entries with opts while showing the dashboard, and returns
+// the result of the batch. Pressing q stops the whole batch; once it is over,
+// the dashboard stays up until q is pressed.
+func (d *Dashboard) Run(ctx context.Context, entries []download.Entry, opts download.Options) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for i, entry := range entries {
+		url := entry.URL
+		if _, ok := d.byURL[url]; ok {
+			continue
+		}
+		t := &transfer{index: i, url: url, total: -1, state: stateQueued}
+		d.transfers = append(d.transfers, t)
+		d.byURL[url] = t
+	}
+	if len(d.transfers) > 0 {
+		d.selected = d.transfers[0].url
+	}
+
+	opts.ProgressMode = download.ProgressNone
+	opts.Log = d.logWriter
+	opts.JobContext = d.jobContext
+	opts.OnJobDone = d.jobDone
+	report := opts.OnProgress
+	opts.OnProgress = func(p download.Progress) {
+		d.progress(p)
+		if report != nil {
+			report(p)
+		}
+	}
+
+	state, err := term.MakeRaw(int(d.in.Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to set up terminal: %v", err)
+	}
+	defer term.Restore(int(d.in.Fd()), state)
+	fmt.Fprint(d.out, "\033[?1049h\033[?25l") // Alternate screen, hidden cursor
+	defer fmt.Fprint(d.out, "\033[?25h\033[?1049l")
+
+	result := make(chan error, 1)
+	go func() {
+		result <- download.DownloadEntriesContext(ctx, entries, opts)
+	}()
+	keys := make(chan byte)
+	go readKeys(d.in, keys)
+
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+
+	var batchErr error
+	done := false
+	for {
+		d.draw()
+		select {
+		case batchErr = <-result:
+			done = true
+			d.mu.Lock()
+			d.finished = true
+			d.mu.Unlock()
+		case key := <-keys:
+			if key == 'q' || key == 3 { // 3 is Ctrl-C, which raw mode doesn't turn into a signal
+				if done {
+					return batchErr
+				}
+				cancel()
+			} else {
+				d.handleKey(key)
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops collecting output and prints the end of the log, so the
+// summary of the batch stays visible after the dashboard is gone.
+func (d *Dashboard) Close() {
+	d.logWriter.Close()
+	<-d.logDone
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tail := d.logLines
+	if len(tail) > 10 {
+		tail = tail[len(tail)-10:]
+	}
+	for _, line := range tail {
+		fmt.Fprintln(d.out, line)
+	}
+}
+
+// jobContext gives each transfer a context of its own, for cancelling it.
+func (d *Dashboard) jobContext(ctx context.Context, url string) context.Context {
+	jobCtx, cancel := context.WithCancel(ctx)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := d.transfer(url)
+	t.cancel = cancel
+	t.state = stateActive
+	t.started = time.Now()
+	return jobCtx
+}
+
+// jobDone records the outcome of a transfer.
+func (d *Dashboard) jobDone(url string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := d.transfer(url)
+	t.finished = time.Now()
+	t.speed = 0
+	t.err = err
+	switch {
+	case err == nil:
+		t.state = stateDone
+	case errors.Is(err, utils.ErrQuotaExceeded):
+		t.state = stateSkipped
+	case errors.Is(err, download.ErrInterrupted):
+		t.state = stateCancelled
+	default:
+		t.state = stateFailed
+	}
+	if t.cancel != nil {
+		t.cancel()
+	}
+	if t.resume != nil {
+		close(t.resume)
+		t.resume = nil
+	}
+}
+
+// progress updates a transfer, and blocks while it is paused.
+func (d *Dashboard) progress(p download.Progress) {
+	d.mu.Lock()
+	t := d.transfer(p.URL)
+	t.file = p.File
+	t.downloaded = p.Downloaded
+	t.total = p.Total
+
+	now := time.Now()
+	if t.sampleTime.IsZero() {
+		// Resumed downloads start at the size of the partial file.
+		t.sampleTime = now
+		t.sampleBytes = t.downloaded
+	} else if elapsed := now.Sub(t.sampleTime); elapsed >= speedInterval {
+		current := float64(t.downloaded-t.sampleBytes) / elapsed.Seconds()
+		if t.speed == 0 {
+			t.speed = current
+		} else {
+			t.speed = 0.7*t.speed + 0.3*current
+		}
+		t.sampleTime = now
+		t.sampleBytes = t.downloaded
+	}
+	resume := t.resume
+	d.mu.Unlock()
+
+	if resume != nil {
+		<-resume
+		d.mu.Lock()
+		t.sampleTime = time.Now()
+		t.sampleBytes = t.downloaded
+		d.mu.Unlock()
+	}
+}
+
+// transfer returns the transfer of a URL, adding it when it isn't part of
+// the batch (as can happen after a redirect). The caller must hold d.mu.
+func (d *Dashboard) transfer(url string) *transfer {
+	t, ok := d.byURL[url]
+	if !ok {
+		t = &transfer{index: len(d.transfers), url: url, total: -1, state: stateQueued}
+		d.transfers = append(d.transfers, t)
+		d.byURL[url] = t
+	}
+	return t
+}
+
+// handleKey acts on a key press.
+func (d *Dashboard) handleKey(key byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	view := d.sorted()
+	pos := 0
+	for i, t := range view {
+		if t.url == d.selected {
+			pos = i
+		}
+	}
+	if len(view) == 0 {
+		return
+	}
+
+	switch key {
+	case keyUp, 'k':
+		if pos > 0 {
+			d.selected = view[pos-1].url
+		}
+	case keyDown, 'j':
+		if pos < len(view)-1 {
+			d.selected = view[pos+1].url
+		}
+	case 's':
+		d.sortBy = (d.sortBy + 1) % len(sortModes)
+	case 'p', ' ':
+		d.togglePause(view[pos])
+	case 'c':
+		d.cancelTransfer(view[pos])
+	}
+}
+
+// togglePause pauses an active transfer or resumes a paused one. The caller
+// must hold d.mu.
+func (d *Dashboard) togglePause(t *transfer) {
+	switch t.state {
+	case stateActive:
+		t.state = statePaused
+		t.speed = 0
+		t.resume = make(chan struct{})
+	case statePaused:
+		t.state = stateActive
+		close(t.resume)
+		t.resume = nil
+	}
+}
+
+// cancelTransfer stops an active or paused transfer, keeping what was
+// received in its .part file. The caller must hold d.mu.
+func (d *Dashboard) cancelTransfer(t *transfer) {
+	if t.state != stateActive && t.state != statePaused {
+		return
+	}
+	t.state = stateCancelled
+	t.cancel()
+	if t.resume != nil {
+		close(t.resume)
+		t.resume = nil
+	}
+}
+
+// Keys read from the terminal, with the arrow keys mapped to bytes that
+// can't be typed.
+const (
+	keyUp   = 0x80
+	keyDown = 0x81
+)
+
+// readKeys sends the keys pressed on the terminal to keys.
+func readKeys(in io.Reader, keys chan<- byte) {
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		input := buf[:n]
+		for len(input) > 0 {
+			switch {
+			case strings.HasPrefix(string(input), "\033[A"):
+				keys <- keyUp
+				input = input[3:]
+			case strings.HasPrefix(string(input), "\033[B"):
+				keys <- keyDown
+				input = input[3:]
+			default:
+				keys <- input[0]
+				input = input[1:]
+			}
+		}
+	}
+}
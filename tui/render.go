@@ -0,0 +1,231 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"wget/utils"
+
+	"golang.org/x/term"
+)
+
+// sortModes are the orders the transfer list can be shown in, cycled with s.
+var sortModes = []struct {
+	name string
+	less func(a, b *transfer) bool
+}{
+	{"added", func(a, b *transfer) bool { return a.index < b.index }},
+	{"name", func(a, b *transfer) bool { return displayName(a) < displayName(b) }},
+	{"progress", func(a, b *transfer) bool { return fraction(a) > fraction(b) }},
+	{"speed", func(a, b *transfer) bool { return a.speed > b.speed }},
+	{"status", func(a, b *transfer) bool { return stateRank[a.state] < stateRank[b.state] }},
+}
+
+// stateRank orders the states when sorting by status, the ones needing
+// attention first.
+var stateRank = map[string]int{
+	stateFailed:    0,
+	statePaused:    1,
+	stateActive:    2,
+	stateQueued:    3,
+	stateCancelled: 4,
+	stateSkipped:   5,
+	stateDone:      6,
+}
+
+// sorted returns the transfers in the current sort order. The caller must
+// hold d.mu.
+func (d *Dashboard) sorted() []*transfer {
+	view := append([]*transfer(nil), d.transfers...)
+	less := sortModes[d.sortBy].less
+	sort.SliceStable(view, func(i, j int) bool { return less(view[i], view[j]) })
+	return view
+}
+
+// draw renders the dashboard: a header, the transfer list, the details of
+// the selected transfer and the end of the log.
+func (d *Dashboard) draw() {
+	width, height, err := term.GetSize(int(d.out.Fd()))
+	if err != nil || width < 20 || height < 10 {
+		width, height = 80, 24
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	view := d.sorted()
+	counts := make(map[string]int)
+	pos := 0
+	for i, t := range view {
+		counts[t.state]++
+		if t.url == d.selected {
+			pos = i
+		}
+	}
+
+	var lines []string
+	status := fmt.Sprintf("%d active, %d paused, %d queued, %d done, %d failed",
+		counts[stateActive], counts[statePaused], counts[stateQueued], counts[stateDone], counts[stateFailed]+counts[stateCancelled])
+	if d.finished {
+		status += " - finished"
+	}
+	lines = append(lines, "\033[1m"+fit("wget  "+status+"  (sort: "+sortModes[d.sortBy].name+")", width)+"\033[0m")
+	lines = append(lines, "\033[2m"+fit("↑/↓ select  p pause/resume  c cancel  s sort  q quit", width)+"\033[0m")
+
+	// The list gets half of the remaining rows, the details five and the log the rest.
+	listRows := (height - 2 - 7) / 2
+	if listRows < 3 {
+		listRows = 3
+	}
+	lines = append(lines, "\033[7m"+fit(fmt.Sprintf("  %-9s %-22s %10s %11s  %s", "STATUS", "PROGRESS", "SIZE", "SPEED", "FILE"), width)+"\033[0m")
+
+	first := 0
+	if pos >= listRows {
+		first = pos - listRows + 1
+	}
+	for i := first; i < first+listRows; i++ {
+		if i >= len(view) {
+			lines = append(lines, "")
+			continue
+		}
+		t := view[i]
+		row := fmt.Sprintf("  %-9s %-22s %10s %11s  %s", t.state, progressBar(t, 14), size(t), speed(t), displayName(t))
+		if i == pos {
+			row = "\033[1m>" + fit(row, width)[1:] + "\033[0m"
+		} else {
+			row = fit(row, width)
+		}
+		lines = append(lines, row)
+	}
+
+	lines = append(lines, "\033[7m"+fit(" Details", width)+"\033[0m")
+	if len(view) > 0 {
+		lines = append(lines, details(view[pos], width)...)
+	}
+
+	lines = append(lines, "\033[7m"+fit(" Log", width)+"\033[0m")
+	logRows := height - len(lines)
+	if logRows > 0 {
+		tail := d.logLines
+		if len(tail) > logRows {
+			tail = tail[len(tail)-logRows:]
+		}
+		for _, line := range tail {
+			lines = append(lines, fit(line, width))
+		}
+	}
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, line := range lines {
+		b.WriteString(line)
+		b.WriteString("\033[K")
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\033[J")
+	fmt.Fprint(d.out, b.String())
+}
+
+// details returns the lines of the detail pane for a transfer.
+func details(t *transfer, width int) []string {
+	file := t.file
+	if file == "" {
+		file = "-"
+	}
+	transferred := utils.FormatBytes(t.downloaded)
+	if t.total > 0 {
+		transferred += fmt.Sprintf(" of %s (%.1f%%)", utils.FormatBytes(t.total), 100*fraction(t))
+	}
+
+	timing := "-"
+	switch {
+	case !t.finished.IsZero():
+		timing = "took " + t.finished.Sub(t.started).Round(time.Second).String()
+	case !t.started.IsZero():
+		timing = "running for " + time.Since(t.started).Round(time.Second).String()
+		if t.total > 0 && t.speed > 0 && t.state == stateActive {
+			left := time.Duration(float64(t.total-t.downloaded) / t.speed * float64(time.Second))
+			timing += ", " + left.Round(time.Second).String() + " left"
+		}
+	}
+
+	outcome := t.state
+	if t.err != nil {
+		outcome += ": " + t.err.Error()
+	}
+	return []string{
+		fit(" URL:      "+t.url, width),
+		fit(" File:     "+file, width),
+		fit(" Received: "+transferred+"  Speed: "+speed(t), width),
+		fit(" Time:     "+timing, width),
+		fit(" Status:   "+outcome, width),
+	}
+}
+
+// displayName returns the name a transfer is listed under.
+func displayName(t *transfer) string {
+	if t.file != "" {
+		return filepath.Base(t.file)
+	}
+	return t.url
+}
+
+// fraction returns how much of a transfer is done, from 0 to 1.
+func fraction(t *transfer) float64 {
+	if t.state == stateDone {
+		return 1
+	}
+	if t.total <= 0 {
+		return 0
+	}
+	return float64(t.downloaded) / float64(t.total)
+}
+
+// progressBar renders the progress of a transfer with a bar of the given width.
+func progressBar(t *transfer, width int) string {
+	if t.total <= 0 && t.state != stateDone {
+		if t.state == stateQueued {
+			return ""
+		}
+		return "[" + strings.Repeat("?", width) + "]"
+	}
+	filled := int(fraction(t) * float64(width))
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), 100*fraction(t))
+}
+
+// size returns the size column of a transfer.
+func size(t *transfer) string {
+	switch {
+	case t.total > 0:
+		return utils.FormatBytes(t.total)
+	case t.downloaded > 0:
+		return utils.FormatBytes(t.downloaded)
+	}
+	return "-"
+}
+
+// speed returns the speed column of a transfer.
+func speed(t *transfer) string {
+	if t.state != stateActive || t.speed <= 0 {
+		return "-"
+	}
+	return utils.FormatBytes(int64(t.speed)) + "/s"
+}
+
+// fit cuts s to width runes, so long lines don't wrap and break the layout.
+func fit(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width])
+}
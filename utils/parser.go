@@ -3,32 +3,42 @@ package utils
 import (
     "fmt"
     "strings"
+    "time"
 )
 
 // ParseRateLimit takes a rate limit string (e.g., "10k", "5m") and converts it 
 // to an integer value in bytes (e.g., 10240 for "10k", 5242880 for "5m").
 func ParseRateLimit(rateLimit string) (int64, error) {
-    rateLimit = strings.ToLower(rateLimit)  // Normalize to lowercase to handle both "K" and "k"
+    return ParseSize(rateLimit)
+}
+
+// ParseSize takes a size string (e.g., "10k", "5m", "1g") and converts it
+// to an integer value in bytes (e.g., 10240 for "10k", 1073741824 for "1g").
+func ParseSize(size string) (int64, error) {
+    size = strings.ToLower(size)  // Normalize to lowercase to handle both "K" and "k"
     var multiplier int64 = 1  // Default multiplier for no suffix (1)
 
-    // Check for rate limit suffixes like 'k' for kilobytes and 'm' for megabytes.
+    // Check for size suffixes like 'k' for kilobytes, 'm' for megabytes and 'g' for gigabytes.
     switch {
-    case strings.HasSuffix(rateLimit, "k"):
+    case strings.HasSuffix(size, "k"):
         multiplier = 1024  // 1k = 1024 bytes
-        rateLimit = strings.TrimSuffix(rateLimit, "k")  // Remove the 'k' suffix
-    case strings.HasSuffix(rateLimit, "m"):
+        size = strings.TrimSuffix(size, "k")  // Remove the 'k' suffix
+    case strings.HasSuffix(size, "m"):
         multiplier = 1024 * 1024  // 1m = 1024 * 1024 bytes
-        rateLimit = strings.TrimSuffix(rateLimit, "m")  // Remove the 'm' suffix
+        size = strings.TrimSuffix(size, "m")  // Remove the 'm' suffix
+    case strings.HasSuffix(size, "g"):
+        multiplier = 1024 * 1024 * 1024  // 1g = 1024 * 1024 * 1024 bytes
+        size = strings.TrimSuffix(size, "g")  // Remove the 'g' suffix
     }
     
-    // Parse the remaining part of the rate limit string as an integer.
-    rate, err := ParseInt(rateLimit)
+    // Parse the remaining part of the size string as an integer.
+    value, err := ParseInt(size)
     if err != nil {
         return 0, err  
     }
 
     
-    return rate * multiplier, nil
+    return value * multiplier, nil
 }
 
 // ParseInt converts a string to an integer, returning an error if parsing fails.
@@ -37,3 +47,16 @@ func ParseInt(s string) (int64, error) {
     _, err := fmt.Sscanf(s, "%d", &result)  
     return result, err  
 }
+
+// ParseDate parses a date given on the command line, either as a plain
+// date (e.g., "2024-01-01") or as a full RFC 3339 timestamp.
+func ParseDate(s string) (time.Time, error) {
+    if t, err := time.Parse("2006-01-02", s); err == nil {
+        return t, nil
+    }
+    t, err := time.Parse(time.RFC3339, s)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", s)
+    }
+    return t, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrackingParams are the query parameters analytics and ad platforms add
+// to links, which don't change the page they point to (--strip-tracking).
+// They are shell patterns, as --strip-query-params takes them.
+var TrackingParams = []string{
+	"utm_*",   // Google Analytics campaigns
+	"fbclid",  // Facebook
+	"gclid",   // Google Ads
+	"dclid",   // Google Display ads
+	"gbraid",  // Google Ads on iOS
+	"wbraid",  // Google Ads on iOS
+	"msclkid", // Microsoft Ads
+	"mc_cid",  // Mailchimp campaign
+	"mc_eid",  // Mailchimp subscriber
+	"igshid",  // Instagram
+	"yclid",   // Yandex
+	"_ga",     // Google Analytics cross-domain linking
+	"_gl",     // Google Analytics cross-domain linking
+}
+
+// IsTrackingParam reports whether a query parameter is one of the
+// TrackingParams.
+func IsTrackingParam(name string) bool {
+	for _, pattern := range TrackingParams {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StripTracking returns a URL without its tracking parameters. The other
+// parameters are kept as written, in their order.
+func StripTracking(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	params := strings.Split(u.RawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !IsTrackingParam(name) {
+			kept = append(kept, param)
+		}
+	}
+	if len(kept) == len(params) {
+		return rawURL
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String()
+}
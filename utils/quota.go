@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// ErrQuotaExceeded is returned when a download isn't started because the
+// download quota has been used up.
+var ErrQuotaExceeded = errors.New("download quota exceeded")
+
+// Quota tracks the bytes downloaded across a batch of downloads against a
+// maximum. Downloads already in progress when the quota runs out are allowed
+// to finish; only new downloads are refused. A nil Quota is unlimited.
+type Quota struct {
+	limit int64
+	used  int64
+}
+
+// NewQuota creates a quota allowing limit bytes to be downloaded.
+func NewQuota(limit int64) *Quota {
+	return &Quota{limit: limit}
+}
+
+// Add records n downloaded bytes.
+func (q *Quota) Add(n int64) {
+	if q != nil {
+		atomic.AddInt64(&q.used, n)
+	}
+}
+
+// Exceeded reports whether the quota has been used up.
+func (q *Quota) Exceeded() bool {
+	return q != nil && atomic.LoadInt64(&q.used) >= q.limit
+}
+
+// Limit returns the maximum number of bytes allowed by the quota.
+func (q *Quota) Limit() int64 {
+	return q.limit
+}
+
+// Used returns the number of bytes downloaded so far.
+func (q *Quota) Used() int64 {
+	return atomic.LoadInt64(&q.used)
+}
+
+// Writer returns a writer that counts the bytes written to w against the quota.
+func (q *Quota) Writer(w io.Writer) io.Writer {
+	if q == nil {
+		return w
+	}
+	return &quotaWriter{writer: w, quota: q}
+}
+
+type quotaWriter struct {
+	writer io.Writer
+	quota  *Quota
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.quota.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// SetIfModifiedSince adds an If-Modified-Since header based on the
+// modification time of the local file at path, if it exists.
+func SetIfModifiedSince(req *http.Request, path string) {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+}
+
+// IsLocalCopyCurrent reports whether the local file at path is at least as
+// new as the remote file described by resp and has the same size, matching
+// GNU wget's -N semantics for servers that ignore If-Modified-Since. The
+// size of a response decoded on the fly (--compression) is unknown, as its
+// ContentLength is the compressed size, so only the dates are compared.
+func IsLocalCopyCurrent(path string, resp *http.Response) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	lastMod, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil || lastMod.After(info.ModTime()) {
+		return false
+	}
+
+	return resp.Uncompressed || resp.ContentLength < 0 || resp.ContentLength == info.Size()
+}
+
+// SetModTime sets the modification time of the file at path to the
+// Last-Modified time reported by the server, if any.
+func SetModTime(path string, resp *http.Response) error {
+	lastMod, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return nil
+	}
+	return os.Chtimes(path, time.Now(), lastMod)
+}